@@ -80,6 +80,11 @@ type Descriptor struct {
 	// This should only be used when referring to a manifest.
 	Platform *v1.Platform `json:"platform,omitempty"`
 
+	// ArtifactType is the IANA media type of the artifact this descriptor
+	// refers to. It is only set on descriptors of manifests, most notably
+	// those returned from the referrers API.
+	ArtifactType string `json:"artifactType,omitempty"`
+
 	// NOTE: Before adding a field here, please ensure that all
 	// other options have been exhausted. Much of the type relationships
 	// depend on the simplicity of this type.
@@ -212,6 +212,13 @@ type Configuration struct {
 			// the class in authorized resources.
 			Classes []string `yaml:"classes"`
 		} `yaml:"repository,omitempty"`
+
+		// Retention configures the periodic removal of tags according to
+		// retention rules.
+		Retention Retention `yaml:"retention,omitempty"`
+
+		// Quotas limit the content stored in the repositories of namespaces.
+		Quotas []Quota `yaml:"quotas,omitempty"`
 	} `yaml:"policy,omitempty"`
 }
 
@@ -587,15 +594,66 @@ type Notifications struct {
 // Endpoint describes the configuration of an http webhook notification
 // endpoint.
 type Endpoint struct {
-	Name              string        `yaml:"name"`              // identifies the endpoint in the registry instance.
-	Disabled          bool          `yaml:"disabled"`          // disables the endpoint
-	URL               string        `yaml:"url"`               // post url for the endpoint.
-	Headers           http.Header   `yaml:"headers"`           // static headers that should be added to all requests
-	Timeout           time.Duration `yaml:"timeout"`           // HTTP timeout
-	Threshold         int           `yaml:"threshold"`         // circuit breaker threshold before backing off on failure
-	Backoff           time.Duration `yaml:"backoff"`           // backoff duration
-	IgnoredMediaTypes []string      `yaml:"ignoredmediatypes"` // target media types to ignore
-	Ignore            Ignore        `yaml:"ignore"`            // ignore event types
+	Name              string            `yaml:"name"`                  // identifies the endpoint in the registry instance.
+	Disabled          bool              `yaml:"disabled"`              // disables the endpoint
+	Type              string            `yaml:"type,omitempty"`        // type of the endpoint, http (default) or file
+	URL               string            `yaml:"url"`                   // post url for the endpoint.
+	File              FileEndpoint      `yaml:"file,omitempty"`        // configuration of a file endpoint
+	Format            string            `yaml:"format,omitempty"`      // format of the events, envelope (default) or cloudevents
+	CloudEvents       CloudEventsFormat `yaml:"cloudevents,omitempty"` // options of the cloudevents format
+	Headers           http.Header       `yaml:"headers"`               // static headers that should be added to all requests
+	Secret            string            `yaml:"secret,omitempty"`      // shared secret signing the requests
+	Timeout           time.Duration     `yaml:"timeout"`               // HTTP timeout
+	Threshold         int               `yaml:"threshold"`             // circuit breaker threshold before backing off on failure
+	Backoff           time.Duration     `yaml:"backoff"`               // backoff duration
+	IgnoredMediaTypes []string          `yaml:"ignoredmediatypes"`     // target media types to ignore
+	Ignore            Ignore            `yaml:"ignore"`                // ignore event types
+	Queue             EndpointQueue     `yaml:"queue,omitempty"`       // persistent queue of the events
+	Filters           EventFilters      `yaml:"filters,omitempty"`     // repositories, tags and actors of the events
+}
+
+// FileEndpoint configures a notification endpoint appending the events to a
+// local file, one JSON envelope per line.
+type FileEndpoint struct {
+	Path       string        `yaml:"path"`                 // path of the file
+	MaxSize    int64         `yaml:"maxsize,omitempty"`    // size in bytes after which the file is rotated
+	MaxAge     time.Duration `yaml:"maxage,omitempty"`     // age after which the file is rotated
+	MaxBackups int           `yaml:"maxbackups,omitempty"` // number of rotated files kept, all if zero
+	Fsync      bool          `yaml:"fsync,omitempty"`      // sync the file to disk after each event
+}
+
+// EventFilters configures which events are sent to a notification endpoint.
+// An event is sent if it matches the include rules, if any, and none of the
+// exclude rules.
+type EventFilters struct {
+	Include EventFilter `yaml:"include,omitempty"` // rules the events must match
+	Exclude EventFilter `yaml:"exclude,omitempty"` // rules the events must not match
+}
+
+// EventFilter matches events by repository, tag and actor name. The patterns
+// are globs, or regular expressions if prefixed with "regexp:". An event
+// matches a list of patterns if it matches any of them.
+type EventFilter struct {
+	Repositories []string `yaml:"repositories,omitempty"` // patterns of the repository names
+	Tags         []string `yaml:"tags,omitempty"`         // patterns of the tags, events without a tag are not filtered on tags
+	Actors       []string `yaml:"actors,omitempty"`       // patterns of the actor names
+}
+
+// CloudEventsFormat configures how the events of a notification endpoint are
+// sent as CloudEvents.
+type CloudEventsFormat struct {
+	Mode  string `yaml:"mode,omitempty"`  // HTTP binding mode, structured (default) or binary
+	Batch bool   `yaml:"batch,omitempty"` // send structured events in a batch
+}
+
+// EndpointQueue configures a queue of the events of a notification endpoint
+// persisted across restarts, either in a local directory or in the storage of
+// the registry. The queue is kept in memory if neither is set.
+type EndpointQueue struct {
+	Directory   string `yaml:"directory,omitempty"`   // local directory of the queue
+	StoragePath string `yaml:"storagepath,omitempty"` // path of the queue in the registry storage
+	MaxSize     int    `yaml:"maxsize,omitempty"`     // maximum number of queued events
+	MaxRetries  int    `yaml:"maxretries,omitempty"`  // failed deliveries after which an event is dead-lettered, unlimited if zero
 }
 
 // Events configures notification events.
@@ -630,10 +688,185 @@ type Proxy struct {
 	// Password of the hub user
 	Password string `yaml:"password"`
 
+	// Credentials configures where the credentials of the remote registry
+	// are read from, instead of Username and Password
+	Credentials ProxyCredentials `yaml:"credentials,omitempty"`
+
 	// TTL is the expiry time of the content and will be cleaned up when it expires
 	// if not set, defaults to 7 * 24 hours
 	// If set to zero, will never expire cache
 	TTL *time.Duration `yaml:"ttl,omitempty"`
+
+	// MaxSize is the maximum total size in bytes of the cached content of all
+	// remotes. When it is exceeded, the least recently pulled blobs and
+	// manifests are removed. Zero means unlimited.
+	MaxSize int64 `yaml:"maxsize,omitempty"`
+
+	// NegativeCacheTTL is the time for which manifests and tags unknown to
+	// a remote registry are not requested from it again. If not set,
+	// defaults to 30 seconds. If set to zero, unknown content is always
+	// requested.
+	NegativeCacheTTL *time.Duration `yaml:"negativecachettl,omitempty"`
+
+	// TagListTTL is the time for which the tag list of a remote repository
+	// is served from the cache without being requested again. Zero, the
+	// default, requests it every time, and only serves the cached list when
+	// the remote registry is unavailable.
+	TagListTTL time.Duration `yaml:"taglistttl,omitempty"`
+
+	// Remotes are remote registries serving the repositories whose name
+	// starts with their prefix. RemoteURL, if set, serves the repositories
+	// matching none of them.
+	Remotes []ProxyRemote `yaml:"remotes,omitempty"`
+
+	// CircuitBreaker stops sending requests to remote registries which keep
+	// failing, serving content from the cache instead.
+	CircuitBreaker ProxyCircuitBreaker `yaml:"circuitbreaker,omitempty"`
+
+	// Scheduler configures where the expiries of the cached content are
+	// stored.
+	Scheduler ProxyScheduler `yaml:"scheduler,omitempty"`
+}
+
+// ProxyScheduler configures the scheduler expiring the content of a pull
+// through cache.
+type ProxyScheduler struct {
+	// Backend stores the expiries. "storage", the default, stores them in
+	// the storage driver, which must then not be shared by several registry
+	// instances. "redis" stores them in the redis configured in the redis
+	// section, shared by the registry instances using it.
+	Backend string `yaml:"backend,omitempty"`
+
+	// Lease is the time for which a registry instance using the redis
+	// backend locks an expiry it runs. Defaults to one minute.
+	Lease time.Duration `yaml:"lease,omitempty"`
+}
+
+// ProxyCircuitBreaker configures the circuit breaker of each remote registry
+// of a pull through cache.
+type ProxyCircuitBreaker struct {
+	// Disabled sends every request to the remote registries, regardless of
+	// previous failures.
+	Disabled bool `yaml:"disabled,omitempty"`
+
+	// Threshold is the number of consecutive failed requests after which no
+	// more requests are sent to a remote registry. Defaults to 5.
+	Threshold int `yaml:"threshold,omitempty"`
+
+	// Cooldown is the time after which a request is sent again to a remote
+	// registry, to probe whether it recovered. Defaults to 30 seconds.
+	Cooldown time.Duration `yaml:"cooldown,omitempty"`
+}
+
+// Enabled returns whether the registry is configured as a pull through cache.
+func (proxy Proxy) Enabled() bool {
+	return proxy.RemoteURL != "" || len(proxy.Remotes) > 0
+}
+
+// ProxyCredentials configures where the credentials of a remote registry are
+// read from. At most one of DockerConfig, Helper and PasswordFile may be set.
+// The credentials are read again at the refresh interval, so that they can be
+// rotated without restarting the registry.
+type ProxyCredentials struct {
+	// DockerConfig is the path of a docker config.json, whose credentials
+	// or credential helper for the remote registry are used.
+	DockerConfig string `yaml:"dockerconfig,omitempty"`
+
+	// Helper is the name of a docker credential helper, such as
+	// "ecr-login" for the docker-credential-ecr-login executable.
+	Helper string `yaml:"helper,omitempty"`
+
+	// UsernameFile is the path of a file holding the username, such as a
+	// mounted secret. Defaults to the configured username.
+	UsernameFile string `yaml:"usernamefile,omitempty"`
+
+	// PasswordFile is the path of a file holding the password or token.
+	PasswordFile string `yaml:"passwordfile,omitempty"`
+
+	// Refresh is the interval at which the credentials are read again.
+	// Defaults to one minute.
+	Refresh time.Duration `yaml:"refresh,omitempty"`
+}
+
+// ProxyRemote is a remote registry of a pull through cache.
+type ProxyRemote struct {
+	// Prefix is the prefix of the names of the repositories pulled through
+	// from the remote registry, such as "ghcr/". It is removed from the name
+	// of the repositories in the remote registry.
+	Prefix string `yaml:"prefix"`
+
+	// RemoteURL is the URL of the remote registry
+	RemoteURL string `yaml:"remoteurl"`
+
+	// Username of the remote registry user
+	Username string `yaml:"username,omitempty"`
+
+	// Password of the remote registry user
+	Password string `yaml:"password,omitempty"`
+
+	// Credentials configures where the credentials of the remote registry
+	// are read from, instead of Username and Password
+	Credentials ProxyCredentials `yaml:"credentials,omitempty"`
+
+	// TTL is the expiry time of the content pulled through from the remote
+	// registry, with the same defaults as Proxy.TTL.
+	TTL *time.Duration `yaml:"ttl,omitempty"`
+}
+
+// Retention configures the periodic removal of tags according to retention
+// rules.
+type Retention struct {
+	// Enabled enables the enforcement of the rules.
+	Enabled bool `yaml:"enabled,omitempty"`
+
+	// DryRun only reports the tags which would be removed.
+	DryRun bool `yaml:"dryrun,omitempty"`
+
+	// Interval is the time between two enforcements of the rules. Defaults
+	// to 24 hours.
+	Interval time.Duration `yaml:"interval,omitempty"`
+
+	// Rules are the retention rules. A tag is removed if any rule selects it.
+	Rules []RetentionRule `yaml:"rules,omitempty"`
+}
+
+// RetentionRule selects tags of repositories for removal. At least one of
+// KeepLast and MaxAge must be set.
+type RetentionRule struct {
+	// Repositories are regular expressions restricting the rule to the
+	// repositories matching any of them. If empty, the rule applies to all
+	// repositories.
+	Repositories []string `yaml:"repositories,omitempty"`
+
+	// Tags are regular expressions restricting the rule to the tags matching
+	// any of them. If empty, the rule applies to all tags.
+	Tags []string `yaml:"tags,omitempty"`
+
+	// Keep are regular expressions of tags which the rule never removes.
+	Keep []string `yaml:"keep,omitempty"`
+
+	// KeepLast is the number of most recently updated tags the rule keeps.
+	KeepLast int `yaml:"keeplast,omitempty"`
+
+	// MaxAge is the time since they were last updated after which tags are
+	// removed. If not set, tags are removed regardless of their age.
+	MaxAge time.Duration `yaml:"maxage,omitempty"`
+}
+
+// Quota limits the content stored in the repositories of a namespace.
+type Quota struct {
+	// Namespace is the path prefix of the names of the repositories the
+	// quota applies to. A repository is accounted to the quota with the
+	// longest matching namespace.
+	Namespace string `yaml:"namespace"`
+
+	// MaxBytes is the maximum total size of the layers linked into the
+	// repositories. Zero means unlimited.
+	MaxBytes int64 `yaml:"maxbytes,omitempty"`
+
+	// MaxManifests is the maximum number of manifests stored in the
+	// repositories. Zero means unlimited.
+	MaxManifests int64 `yaml:"maxmanifests,omitempty"`
 }
 
 // Parse parses an input configuration yaml document into a Configuration struct
@@ -33,6 +33,27 @@ func (err ErrTagUnknown) Error() string {
 	return fmt.Sprintf("unknown tag=%s", err.Tag)
 }
 
+// ErrTagImmutable is returned if a tag which may not be moved to another
+// manifest already exists.
+type ErrTagImmutable struct {
+	Tag string
+}
+
+func (err ErrTagImmutable) Error() string {
+	return fmt.Sprintf("tag %s is immutable", err.Tag)
+}
+
+// ErrQuotaExceeded is returned if storing content would exceed the quota of
+// the namespace of a repository.
+type ErrQuotaExceeded struct {
+	Namespace string
+	Reason    string
+}
+
+func (err ErrQuotaExceeded) Error() string {
+	return fmt.Sprintf("quota of namespace %q exceeded: %s", err.Namespace, err.Reason)
+}
+
 // ErrRepositoryUnknown is returned if the named repository is not known by
 // the registry.
 type ErrRepositoryUnknown struct {
@@ -107,6 +128,17 @@ func (err ErrManifestBlobUnknown) Error() string {
 	return fmt.Sprintf("unknown blob %v on manifest", err.Digest)
 }
 
+// ErrManifestSubjectInvalid is returned when the subject of a manifest is
+// not a valid descriptor of another manifest.
+type ErrManifestSubjectInvalid struct {
+	Digest digest.Digest
+	Reason error
+}
+
+func (err ErrManifestSubjectInvalid) Error() string {
+	return fmt.Sprintf("invalid subject %v on manifest: %v", err.Digest, err.Reason)
+}
+
 // ErrManifestNameInvalid should be used to denote an invalid manifest
 // name. Reason may set, indicating the cause of invalidity.
 type ErrManifestNameInvalid struct {
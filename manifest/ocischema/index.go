@@ -57,6 +57,13 @@ type ImageIndex struct {
 	// Manifests references a list of manifests
 	Manifests []distribution.Descriptor `json:"manifests"`
 
+	// Subject references another manifest this index refers to.
+	Subject *distribution.Descriptor `json:"subject,omitempty"`
+
+	// ArtifactType is the IANA media type of the artifact when the index is
+	// used for an artifact rather than a multi-platform image.
+	ArtifactType string `json:"artifactType,omitempty"`
+
 	// Annotations is an optional field that contains arbitrary metadata for the
 	// image index
 	Annotations map[string]string `json:"annotations,omitempty"`
@@ -54,6 +54,14 @@ type Manifest struct {
 	// configuration.
 	Layers []distribution.Descriptor `json:"layers"`
 
+	// Subject references another manifest this manifest refers to, such as
+	// the image a signature or SBOM is attached to.
+	Subject *distribution.Descriptor `json:"subject,omitempty"`
+
+	// ArtifactType is the IANA media type of the artifact when the manifest
+	// is used for an artifact rather than an image.
+	ArtifactType string `json:"artifactType,omitempty"`
+
 	// Annotations contains arbitrary metadata for the image manifest.
 	Annotations map[string]string `json:"annotations,omitempty"`
 }
@@ -172,6 +172,39 @@ func TestManifestUnmarshal(t *testing.T) {
 	}
 }
 
+func TestManifestSubject(t *testing.T) {
+	mfst := makeTestManifest(v1.MediaTypeImageManifest)
+	mfst.ArtifactType = "application/vnd.example.signature.v1+json"
+	mfst.Subject = &distribution.Descriptor{
+		MediaType: v1.MediaTypeImageManifest,
+		Digest:    "sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b",
+		Size:      1234,
+	}
+
+	deserialized, err := FromStruct(mfst)
+	if err != nil {
+		t.Fatalf("error creating DeserializedManifest: %v", err)
+	}
+
+	unmarshalled, _, err := distribution.UnmarshalManifest(v1.MediaTypeImageManifest, deserialized.canonical)
+	if err != nil {
+		t.Fatalf("error unmarshaling manifest: %v", err)
+	}
+
+	asManifest := unmarshalled.(*DeserializedManifest)
+	if !reflect.DeepEqual(asManifest.Subject, mfst.Subject) {
+		t.Fatalf("subject not equal:\nexpected:\n%v\nactual:\n%v\n", mfst.Subject, asManifest.Subject)
+	}
+	if asManifest.ArtifactType != mfst.ArtifactType {
+		t.Fatalf("unexpected artifact type: %q", asManifest.ArtifactType)
+	}
+
+	// the subject is not a dependency of the manifest
+	if len(asManifest.References()) != 2 {
+		t.Fatalf("unexpected number of references: %d", len(asManifest.References()))
+	}
+}
+
 func manifestMediaTypeTest(mediaType string, shouldError bool) func(*testing.T) {
 	return func(t *testing.T) {
 		mfst := makeTestManifest(mediaType)
@@ -21,7 +21,18 @@ type bridge struct {
 	sink              events.Sink
 }
 
-var _ Listener = &bridge{}
+var (
+	_ Listener       = &bridge{}
+	_ TagListener    = &bridge{}
+	_ SystemListener = &bridge{}
+)
+
+// SystemListener combines the events of operations which are not triggered by
+// a request.
+type SystemListener interface {
+	Listener
+	SweepListener
+}
 
 // URLBuilder defines a subset of url builder to be used by the event listener.
 type URLBuilder interface {
@@ -44,6 +55,19 @@ func NewBridge(ub URLBuilder, source SourceRecord, actor ActorRecord, request Re
 	}
 }
 
+// NewSystemBridge returns a notification listener for operations which are
+// not triggered by a request, such as garbage collection, whose events are
+// attributed to the actor named SystemActorName and carry no request.
+func NewSystemBridge(ub URLBuilder, source SourceRecord, sink events.Sink, includeReferences bool) SystemListener {
+	return &bridge{
+		ub:                ub,
+		includeReferences: includeReferences,
+		actor:             ActorRecord{Name: SystemActorName},
+		source:            source,
+		sink:              sink,
+	}
+}
+
 // NewRequestRecord builds a RequestRecord for use in NewBridge from an
 // http.Request, associating it with a request id.
 func NewRequestRecord(id string, r *http.Request) RequestRecord {
@@ -119,6 +143,49 @@ func (b *bridge) TagDeleted(repo reference.Named, tag string) error {
 	return b.sink.Write(*event)
 }
 
+func (b *bridge) TagCreated(repo reference.Named, tag string, desc distribution.Descriptor) error {
+	event, err := b.createTagEvent(EventActionTag, repo, tag, desc)
+	if err != nil {
+		return err
+	}
+
+	return b.sink.Write(*event)
+}
+
+func (b *bridge) TagMoved(repo reference.Named, tag string, previous, desc distribution.Descriptor) error {
+	event, err := b.createTagEvent(EventActionRetag, repo, tag, desc)
+	if err != nil {
+		return err
+	}
+	event.Target.Previous = &previous
+
+	return b.sink.Write(*event)
+}
+
+func (b *bridge) TagUntagged(repo reference.Named, tag string, previous distribution.Descriptor) error {
+	event := b.createEvent(EventActionDelete)
+	event.Target.Repository = repo.Name()
+	event.Target.Tag = tag
+	event.Target.Previous = &previous
+
+	return b.sink.Write(*event)
+}
+
+func (b *bridge) BlobSwept(dgst digest.Digest) error {
+	event := b.createEvent(EventActionDelete)
+	event.Target.Digest = dgst
+
+	return b.sink.Write(*event)
+}
+
+func (b *bridge) UploadPurged(repo reference.Named, id string) error {
+	event := b.createEvent(EventActionDelete)
+	event.Target.Repository = repo.Name()
+	event.Target.Upload = id
+
+	return b.sink.Write(*event)
+}
+
 func (b *bridge) RepoDeleted(repo reference.Named) error {
 	event := b.createEvent(EventActionDelete)
 	event.Target.Repository = repo.Name()
@@ -170,6 +237,28 @@ func (b *bridge) createManifestEvent(action string, repo reference.Named, sm dis
 	return event, nil
 }
 
+func (b *bridge) createTagEvent(action string, repo reference.Named, tag string, desc distribution.Descriptor) (*Event, error) {
+	event := b.createEvent(action)
+	event.Target.MediaType = desc.MediaType
+	event.Target.Digest = desc.Digest
+	event.Target.Size = desc.Size
+	event.Target.Length = desc.Size
+	event.Target.Repository = repo.Name()
+	event.Target.Tag = tag
+
+	ref, err := reference.WithDigest(repo, desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	event.Target.URL, err = b.ub.BuildManifestURL(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
 func (b *bridge) createBlobDeleteEventAndWrite(action string, repo reference.Named, dgst digest.Digest) error {
 	event := b.createEvent(action)
 	event.Target.Digest = dgst
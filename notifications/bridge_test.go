@@ -130,6 +130,45 @@ func TestEventBridgeTagDeleted(t *testing.T) {
 	}
 }
 
+func TestEventBridgeTagMoved(t *testing.T) {
+	previous := distribution.Descriptor{MediaType: ociMediaType, Digest: "sha256:previous", Size: 3}
+	l := createTestEnv(t, testSinkFn(func(event events.Event) error {
+		checkCommonManifest(t, EventActionRetag, event)
+		if event.(Event).Target.Tag != tag {
+			t.Fatalf("unexpected tag on event target: %q != %q", event.(Event).Target.Tag, tag)
+		}
+		if p := event.(Event).Target.Previous; p == nil || p.Digest != previous.Digest {
+			t.Fatalf("unexpected previous descriptor: %v != %v", p, previous)
+		}
+		return nil
+	}))
+
+	repoRef, _ := reference.WithName(repo)
+	desc := distribution.Descriptor{MediaType: ociMediaType, Digest: dgst, Size: int64(len(payload))}
+	if err := l.(TagListener).TagMoved(repoRef, tag, previous, desc); err != nil {
+		t.Fatalf("unexpected error notifying tag move: %v", err)
+	}
+}
+
+func TestEventBridgeTagUntagged(t *testing.T) {
+	previous := distribution.Descriptor{MediaType: ociMediaType, Digest: "sha256:previous", Size: 3}
+	l := createTestEnv(t, testSinkFn(func(event events.Event) error {
+		checkDeleted(t, EventActionDelete, event)
+		if event.(Event).Target.Tag != tag {
+			t.Fatalf("unexpected tag on event target: %q != %q", event.(Event).Target.Tag, tag)
+		}
+		if p := event.(Event).Target.Previous; p == nil || p.Digest != previous.Digest {
+			t.Fatalf("unexpected previous descriptor: %v != %v", p, previous)
+		}
+		return nil
+	}))
+
+	repoRef, _ := reference.WithName(repo)
+	if err := l.(TagListener).TagUntagged(repoRef, tag, previous); err != nil {
+		t.Fatalf("unexpected error notifying tag deletion: %v", err)
+	}
+}
+
 func TestEventBridgeRepoDeleted(t *testing.T) {
 	l := createTestEnv(t, testSinkFn(func(event events.Event) error {
 		checkDeleted(t, EventActionDelete, event)
@@ -142,6 +181,40 @@ func TestEventBridgeRepoDeleted(t *testing.T) {
 	}
 }
 
+func TestSystemBridge(t *testing.T) {
+	var written []Event
+	l := NewSystemBridge(ub, source, testSinkFn(func(event events.Event) error {
+		written = append(written, event.(Event))
+		return nil
+	}), false)
+
+	repoRef, _ := reference.WithName(repo)
+	if err := l.BlobSwept(dgst); err != nil {
+		t.Fatalf("unexpected error notifying blob sweep: %v", err)
+	}
+	if err := l.UploadPurged(repoRef, "upload-id"); err != nil {
+		t.Fatalf("unexpected error notifying upload purge: %v", err)
+	}
+
+	if len(written) != 2 {
+		t.Fatalf("unexpected events: %v", written)
+	}
+	for _, event := range written {
+		if event.Action != EventActionDelete {
+			t.Fatalf("unexpected event action: %q", event.Action)
+		}
+		if event.Actor.Name != SystemActorName || event.Request != (RequestRecord{}) || event.Source != source {
+			t.Fatalf("unexpected actor, request or source: %+v", event)
+		}
+	}
+	if swept := written[0].Target; swept.Digest != dgst || swept.Repository != "" {
+		t.Fatalf("unexpected target of swept blob: %+v", swept)
+	}
+	if purged := written[1].Target; purged.Repository != repo || purged.Upload != "upload-id" {
+		t.Fatalf("unexpected target of purged upload: %+v", purged)
+	}
+}
+
 func createTestEnv(t *testing.T, fn testSinkFn) Listener {
 	manifest := schema2.Manifest{
 		Versioned: manifest.Versioned{
@@ -0,0 +1,188 @@
+package notifications
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	events "github.com/docker/go-events"
+)
+
+// Formats of the events sent to endpoints.
+const (
+	// FormatEnvelope sends the events in an Envelope.
+	FormatEnvelope = "envelope"
+
+	// FormatCloudEvents sends each event as a CloudEvent.
+	FormatCloudEvents = "cloudevents"
+)
+
+// Modes of the CloudEvents HTTP binding.
+const (
+	// CloudEventsModeStructured sends the attributes and the data of a
+	// CloudEvent in the body of the request.
+	CloudEventsModeStructured = "structured"
+
+	// CloudEventsModeBinary sends the attributes of a CloudEvent in
+	// ce- headers, and its data as the body of the request.
+	CloudEventsModeBinary = "binary"
+)
+
+const (
+	// CloudEventsMediaType is the media type of a structured CloudEvent.
+	CloudEventsMediaType = "application/cloudevents+json"
+
+	// CloudEventsBatchMediaType is the media type of a batch of structured
+	// CloudEvents.
+	CloudEventsBatchMediaType = "application/cloudevents-batch+json"
+
+	// CloudEventsTypePrefix prefixes the action of an event in the type of
+	// its CloudEvent, such as "io.distribution.registry.push".
+	CloudEventsTypePrefix = "io.distribution.registry."
+
+	cloudEventsSpecVersion = "1.0"
+)
+
+// cloudEvent is the structured CloudEvent of an Event, whose data is the
+// Event.
+type cloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"`
+	Time            time.Time `json:"time,omitempty"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            Event     `json:"data"`
+}
+
+// newCloudEvent maps the event to a CloudEvent: its action to the type, its
+// registry and repository to the source, and its tag, or digest if untagged,
+// to the subject.
+func newCloudEvent(event Event) cloudEvent {
+	source := "/" + event.Target.Repository
+	if event.Source.Addr != "" {
+		source = "//" + event.Source.Addr + source
+	}
+
+	subject := event.Target.Tag
+	if subject == "" {
+		subject = event.Target.Digest.String()
+	}
+
+	return cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              event.ID,
+		Source:          source,
+		Type:            CloudEventsTypePrefix + event.Action,
+		Subject:         subject,
+		Time:            event.Timestamp,
+		DataContentType: "application/json",
+		Data:            event,
+	}
+}
+
+// eventEncoder encodes an event into the body of a notification, and the
+// headers describing it.
+type eventEncoder func(event events.Event) ([]byte, http.Header, error)
+
+// newEventEncoder returns the encoder of the format. In binary mode, a
+// CloudEvent cannot be batched.
+func newEventEncoder(format, mode string, batch bool) (eventEncoder, error) {
+	switch format {
+	case "", FormatEnvelope:
+		return encodeEnvelope, nil
+	case FormatCloudEvents:
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+
+	switch mode {
+	case "", CloudEventsModeStructured:
+		if batch {
+			return encodeCloudEventsBatch, nil
+		}
+		return encodeCloudEvent, nil
+	case CloudEventsModeBinary:
+		if batch {
+			return nil, fmt.Errorf("cloudevents cannot be batched in binary mode")
+		}
+		return encodeBinaryCloudEvent, nil
+	default:
+		return nil, fmt.Errorf("unknown cloudevents mode %q", mode)
+	}
+}
+
+func encodeEnvelope(event events.Event) ([]byte, http.Header, error) {
+	envelope := Envelope{
+		Events: []events.Event{event},
+	}
+
+	p, err := json.MarshalIndent(envelope, "", "   ")
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, http.Header{"Content-Type": []string{EventsMediaType}}, nil
+}
+
+func toCloudEvent(event events.Event) (cloudEvent, error) {
+	e, ok := event.(Event)
+	if !ok {
+		return cloudEvent{}, fmt.Errorf("unexpected event %T", event)
+	}
+	return newCloudEvent(e), nil
+}
+
+func encodeCloudEvent(event events.Event) ([]byte, http.Header, error) {
+	ce, err := toCloudEvent(event)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p, err := json.Marshal(ce)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, http.Header{"Content-Type": []string{CloudEventsMediaType}}, nil
+}
+
+func encodeCloudEventsBatch(event events.Event) ([]byte, http.Header, error) {
+	ce, err := toCloudEvent(event)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p, err := json.Marshal([]cloudEvent{ce})
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, http.Header{"Content-Type": []string{CloudEventsBatchMediaType}}, nil
+}
+
+func encodeBinaryCloudEvent(event events.Event) ([]byte, http.Header, error) {
+	ce, err := toCloudEvent(event)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p, err := json.Marshal(ce.Data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := http.Header{
+		"Content-Type":   []string{ce.DataContentType},
+		"Ce-Specversion": []string{ce.SpecVersion},
+		"Ce-Id":          []string{ce.ID},
+		"Ce-Source":      []string{ce.Source},
+		"Ce-Type":        []string{ce.Type},
+	}
+	if ce.Subject != "" {
+		header.Set("Ce-Subject", ce.Subject)
+	}
+	if !ce.Time.IsZero() {
+		header.Set("Ce-Time", ce.Time.UTC().Format(time.RFC3339Nano))
+	}
+	return p, header, nil
+}
@@ -0,0 +1,127 @@
+package notifications
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+)
+
+func TestCloudEvents(t *testing.T) {
+	event := createTestEvent("push", "library/test", schema2.MediaTypeManifest)
+	event.Target.Tag = "latest"
+	event.Source.Addr = "registry.example.com:5000"
+
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		header, body = r.Header.Clone(), p
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	checkCloudEvent := func(ce cloudEvent) {
+		t.Helper()
+		if ce.SpecVersion != "1.0" || ce.ID != event.ID || ce.DataContentType != "application/json" {
+			t.Fatalf("unexpected attributes: %+v", ce)
+		}
+		if ce.Type != "io.distribution.registry.push" {
+			t.Fatalf("unexpected type: %q", ce.Type)
+		}
+		if ce.Source != "//registry.example.com:5000/library/test" {
+			t.Fatalf("unexpected source: %q", ce.Source)
+		}
+		if ce.Subject != "latest" {
+			t.Fatalf("unexpected subject: %q", ce.Subject)
+		}
+		if ce.Data.Target.Digest != event.Target.Digest || ce.Data.Target.Repository != event.Target.Repository {
+			t.Fatalf("unexpected data: %+v", ce.Data)
+		}
+	}
+
+	write := func(mode string, batch bool) {
+		t.Helper()
+		encode, err := newEventEncoder(FormatCloudEvents, mode, batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sink := newHTTPSink(server.URL, 0, nil, "", encode, nil)
+		if err := sink.Write(event); err != nil {
+			t.Fatalf("unexpected error writing event: %v", err)
+		}
+		checkClose(t, sink)
+	}
+
+	write(CloudEventsModeStructured, false)
+	if header.Get("Content-Type") != CloudEventsMediaType {
+		t.Fatalf("unexpected content type: %q", header.Get("Content-Type"))
+	}
+	var ce cloudEvent
+	if err := json.Unmarshal(body, &ce); err != nil {
+		t.Fatal(err)
+	}
+	checkCloudEvent(ce)
+
+	write(CloudEventsModeStructured, true)
+	if header.Get("Content-Type") != CloudEventsBatchMediaType {
+		t.Fatalf("unexpected content type: %q", header.Get("Content-Type"))
+	}
+	var batch []cloudEvent
+	if err := json.Unmarshal(body, &batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(batch) != 1 {
+		t.Fatalf("unexpected batch: %+v", batch)
+	}
+	checkCloudEvent(batch[0])
+
+	write(CloudEventsModeBinary, false)
+	ce = cloudEvent{
+		SpecVersion:     header.Get("Ce-Specversion"),
+		ID:              header.Get("Ce-Id"),
+		Source:          header.Get("Ce-Source"),
+		Type:            header.Get("Ce-Type"),
+		Subject:         header.Get("Ce-Subject"),
+		DataContentType: header.Get("Content-Type"),
+	}
+	if err := json.Unmarshal(body, &ce.Data); err != nil {
+		t.Fatal(err)
+	}
+	checkCloudEvent(ce)
+	if header.Get("Ce-Time") == "" {
+		t.Fatal("missing time")
+	}
+}
+
+func TestEndpointConfigValidate(t *testing.T) {
+	for _, tc := range []struct {
+		config EndpointConfig
+		valid  bool
+	}{
+		{config: EndpointConfig{}, valid: true},
+		{config: EndpointConfig{Format: FormatCloudEvents, CloudEvents: configuration.CloudEventsFormat{Mode: CloudEventsModeBinary}}, valid: true},
+		{config: EndpointConfig{Type: EndpointTypeFile, File: configuration.FileEndpoint{Path: "events.json"}, Format: FormatCloudEvents}, valid: true},
+		{config: EndpointConfig{Format: "xml"}},
+		{config: EndpointConfig{Format: FormatCloudEvents, CloudEvents: configuration.CloudEventsFormat{Mode: CloudEventsModeBinary, Batch: true}}},
+		{config: EndpointConfig{Type: EndpointTypeFile, File: configuration.FileEndpoint{Path: "events.json"}, Format: FormatCloudEvents, CloudEvents: configuration.CloudEventsFormat{Mode: CloudEventsModeBinary}}},
+		{config: EndpointConfig{Type: EndpointTypeFile}},
+		{config: EndpointConfig{Type: "queue"}},
+		{config: EndpointConfig{Queue: configuration.EndpointQueue{Directory: "/queue", MaxSize: 10, MaxRetries: 3}}, valid: true},
+		{config: EndpointConfig{Queue: configuration.EndpointQueue{MaxSize: 10}}},
+		{config: EndpointConfig{Queue: configuration.EndpointQueue{MaxRetries: 3}}},
+		{config: EndpointConfig{Queue: configuration.EndpointQueue{StoragePath: "/queue", MaxRetries: -1}}},
+	} {
+		if err := tc.config.Validate(); (err == nil) != tc.valid {
+			t.Errorf("unexpected validation of %+v: %v", tc.config, err)
+		}
+	}
+}
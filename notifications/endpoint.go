@@ -1,27 +1,86 @@
 package notifications
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/distribution/distribution/v3/configuration"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	events "github.com/docker/go-events"
+	"github.com/sirupsen/logrus"
+)
+
+// Endpoint types
+const (
+	// EndpointTypeHTTP is the type of the endpoints posting events to a url.
+	EndpointTypeHTTP = "http"
+
+	// EndpointTypeFile is the type of the endpoints appending events to a
+	// local file.
+	EndpointTypeFile = "file"
 )
 
 // EndpointConfig covers the optional configuration parameters for an active
 // endpoint.
 type EndpointConfig struct {
+	Type              string
+	File              configuration.FileEndpoint
+	Format            string
+	CloudEvents       configuration.CloudEventsFormat
 	Headers           http.Header
+	Secret            string `json:"-"`
 	Timeout           time.Duration
 	Threshold         int
 	Backoff           time.Duration
 	IgnoredMediaTypes []string
 	Transport         *http.Transport `json:"-"`
 	Ignore            configuration.Ignore
+	Filters           configuration.EventFilters
+	Queue             configuration.EndpointQueue
+
+	// QueueDriver persists the queue of the endpoint under
+	// Queue.StoragePath. The queue is kept in memory if nil.
+	QueueDriver storagedriver.StorageDriver `json:"-"`
+}
+
+// Validate returns an error if the type, the format, the queue or the filters
+// of the endpoint are invalid.
+func (ec *EndpointConfig) Validate() error {
+	switch ec.Type {
+	case "", EndpointTypeHTTP:
+	case EndpointTypeFile:
+		if ec.File.Path == "" {
+			return fmt.Errorf("file endpoint requires a path")
+		}
+		if ec.CloudEvents.Mode == CloudEventsModeBinary {
+			return fmt.Errorf("file endpoint cannot write cloudevents in binary mode")
+		}
+	default:
+		return fmt.Errorf("unknown endpoint type %q", ec.Type)
+	}
+
+	if _, err := newEventEncoder(ec.Format, ec.CloudEvents.Mode, ec.CloudEvents.Batch); err != nil {
+		return err
+	}
+
+	if ec.Queue.MaxSize < 0 || ec.Queue.MaxRetries < 0 {
+		return fmt.Errorf("queue maxsize and maxretries must not be negative")
+	}
+	if (ec.Queue.MaxSize != 0 || ec.Queue.MaxRetries != 0) && ec.Queue.Directory == "" && ec.Queue.StoragePath == "" {
+		return fmt.Errorf("queue maxsize and maxretries require a directory or storagepath")
+	}
+
+	_, err := newFilteredSink(nil, ec.Filters)
+	return err
 }
 
 // defaults set any zero-valued fields to a reasonable default.
 func (ec *EndpointConfig) defaults() {
+	if ec.Type == "" {
+		ec.Type = EndpointTypeHTTP
+	}
+
 	if ec.Timeout <= 0 {
 		ec.Timeout = time.Second
 	}
@@ -52,7 +111,8 @@ type Endpoint struct {
 	metrics *safeMetrics
 }
 
-// NewEndpoint returns a running endpoint, ready to receive events.
+// NewEndpoint returns a running endpoint, ready to receive events. The url of
+// a file endpoint is the path of its file.
 func NewEndpoint(name, url string, config EndpointConfig) *Endpoint {
 	var endpoint Endpoint
 	endpoint.name = name
@@ -61,12 +121,41 @@ func NewEndpoint(name, url string, config EndpointConfig) *Endpoint {
 	endpoint.defaults()
 	endpoint.metrics = newSafeMetrics(name)
 
-	// Configures the inmemory queue, retry, http pipeline.
-	endpoint.Sink = newHTTPSink(
-		endpoint.url, endpoint.Timeout, endpoint.Headers,
-		endpoint.Transport, endpoint.metrics.httpStatusListener())
-	endpoint.Sink = events.NewRetryingSink(endpoint.Sink, events.NewBreaker(endpoint.Threshold, endpoint.Backoff))
-	endpoint.Sink = newEventQueue(endpoint.Sink, endpoint.metrics.eventQueueListener())
+	// an invalid format, which Validate reports, falls back to envelopes
+	encode, err := newEventEncoder(endpoint.Format, endpoint.CloudEvents.Mode, endpoint.CloudEvents.Batch)
+	if err != nil {
+		encode = encodeEnvelope
+	}
+
+	// Configures the inmemory or persistent queue, retry, http or file
+	// pipeline.
+	switch endpoint.Type {
+	case EndpointTypeFile:
+		endpoint.url = endpoint.File.Path
+		endpoint.Sink = newFileSink(
+			endpoint.File.Path, endpoint.File.MaxSize, endpoint.File.MaxAge,
+			endpoint.File.MaxBackups, endpoint.File.Fsync, encode, endpoint.metrics.fileSinkListener())
+	default:
+		endpoint.Sink = newHTTPSink(
+			endpoint.url, endpoint.Timeout, endpoint.Headers, endpoint.Secret, encode,
+			endpoint.Transport, endpoint.metrics.httpStatusListener())
+	}
+	if endpoint.QueueDriver != nil {
+		endpoint.Sink = newPersistentQueue(
+			endpoint.Sink, endpoint.QueueDriver, endpoint.Queue.StoragePath, events.NewBreaker(endpoint.Threshold, endpoint.Backoff),
+			endpoint.Queue.MaxSize, endpoint.Queue.MaxRetries, endpoint.metrics.eventQueueListener())
+	} else {
+		endpoint.Sink = events.NewRetryingSink(endpoint.Sink, events.NewBreaker(endpoint.Threshold, endpoint.Backoff))
+		endpoint.Sink = newEventQueue(endpoint.Sink, endpoint.metrics.eventQueueListener())
+	}
+	// invalid filters, which Validate reports, drop every event rather than
+	// sending events the endpoint is not meant to receive
+	filtered, err := newFilteredSink(endpoint.Sink, config.Filters, endpoint.metrics.filterListener())
+	if err != nil {
+		logrus.Errorf("endpoint %s: %v, dropping all events", name, err)
+		filtered = &filteredSink{Sink: endpoint.Sink, invalid: true, listeners: []filterListener{endpoint.metrics.filterListener()}}
+	}
+	endpoint.Sink = filtered
 	mediaTypes := append(config.Ignore.MediaTypes, config.IgnoredMediaTypes...)
 	endpoint.Sink = newIgnoredSink(endpoint.Sink, mediaTypes, config.Ignore.Actions)
 
@@ -14,6 +14,13 @@ const (
 	EventActionPush   = "push"
 	EventActionMount  = "mount"
 	EventActionDelete = "delete"
+
+	// EventActionTag is the action of the events of tags created.
+	EventActionTag = "tag"
+
+	// EventActionRetag is the action of the events of tags moved to another
+	// manifest.
+	EventActionRetag = "retag"
 )
 
 const (
@@ -75,6 +82,14 @@ type Event struct {
 
 		// References provides the references descriptors.
 		References []distribution.Descriptor `json:"references,omitempty"`
+
+		// Previous describes the manifest a tag referred to before a tag
+		// event: the manifest it was moved from, or the manifest it referred
+		// to when it was deleted.
+		Previous *distribution.Descriptor `json:"previous,omitempty"`
+
+		// Upload identifies the upload purged in delete events of uploads.
+		Upload string `json:"upload,omitempty"`
 	} `json:"target,omitempty"`
 
 	// Request covers the request that generated the event.
@@ -90,6 +105,11 @@ type Event struct {
 	Source SourceRecord `json:"source,omitempty"`
 }
 
+// SystemActorName is the name of the actor of the events of operations which
+// are not triggered by a request, such as garbage collection, retention, upload
+// purging and the expiry of the content of a pull through cache.
+const SystemActorName = "system"
+
 // ActorRecord specifies the agent that initiated the event. For most
 // situations, this could be from the authorization context of the request.
 // Data in this record can refer to both the initiating client and the
@@ -0,0 +1,241 @@
+package notifications
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	events "github.com/docker/go-events"
+)
+
+// rotatedFileTimeFormat is the suffix of the name of rotated event files,
+// which sorts them in the order they were rotated.
+const rotatedFileTimeFormat = "20060102T150405.000000000Z"
+
+// fileSink appends events to a local file, one envelope per line, so that
+// they can be tailed by a log shipper. The file is rotated once it exceeds a
+// size or an age. Like the http sink, it makes a single attempt at writing
+// each event: reliability should be provided by the caller.
+type fileSink struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	fsync      bool
+	encode     eventEncoder
+
+	mu        sync.Mutex
+	closed    bool
+	file      eventFile
+	size      int64
+	opened    time.Time
+	listeners []fileSinkListener
+}
+
+// eventFile is the file events are appended to.
+type eventFile interface {
+	io.Writer
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// fileSinkListener is called on the outcomes of writing events to a file.
+type fileSinkListener interface {
+	success(event events.Event)
+	err(err error, event events.Event)
+}
+
+// newFileSink returns a sink appending events to the file at path. The file
+// is opened on the first write. The events are written in an envelope if
+// encode is nil, and the headers of the encoding are discarded.
+func newFileSink(path string, maxSize int64, maxAge time.Duration, maxBackups int, fsync bool, encode eventEncoder, listeners ...fileSinkListener) *fileSink {
+	if encode == nil {
+		encode = encodeEnvelope
+	}
+	return &fileSink{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+		fsync:      fsync,
+		encode:     encode,
+		listeners:  listeners,
+	}
+}
+
+// Write appends the event to the file, rotating it first if needed.
+func (fs *fileSink) Write(event events.Event) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.closed {
+		return ErrSinkClosed
+	}
+
+	if err := fs.write(event); err != nil {
+		for _, listener := range fs.listeners {
+			listener.err(err, event)
+		}
+		return fmt.Errorf("%v: %v", fs, err)
+	}
+
+	for _, listener := range fs.listeners {
+		listener.success(event)
+	}
+	return nil
+}
+
+func (fs *fileSink) write(event events.Event) error {
+	body, _, err := fs.encode(event)
+	if err != nil {
+		return fmt.Errorf("error encoding event: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, body); err != nil {
+		return fmt.Errorf("error encoding event: %v", err)
+	}
+	buf.WriteByte('\n')
+	p := buf.Bytes()
+
+	if fs.file != nil && fs.rotationDue(int64(len(p))) {
+		if err := fs.rotate(); err != nil {
+			return fmt.Errorf("error rotating: %v", err)
+		}
+	}
+	if fs.file == nil {
+		if err := fs.open(); err != nil {
+			return fmt.Errorf("error opening: %v", err)
+		}
+	}
+
+	n, err := fs.file.Write(p)
+	if err != nil {
+		// drop the partial line, so that writing the event again does not
+		// leave a torn line in the file
+		if n > 0 {
+			if err := fs.file.Truncate(fs.size); err != nil {
+				// the file is reopened with its actual size
+				fs.closeFile()
+			}
+		}
+		return fmt.Errorf("error writing: %v", err)
+	}
+	fs.size += int64(n)
+	if fs.fsync {
+		if err := fs.file.Sync(); err != nil {
+			return fmt.Errorf("error syncing: %v", err)
+		}
+	}
+	return nil
+}
+
+// rotationDue returns whether the file is to be rotated before appending n
+// bytes. A file is never rotated empty.
+func (fs *fileSink) rotationDue(n int64) bool {
+	if fs.size == 0 {
+		return false
+	}
+	if fs.maxSize > 0 && fs.size+n > fs.maxSize {
+		return true
+	}
+	return fs.maxAge > 0 && time.Since(fs.opened) >= fs.maxAge
+}
+
+func (fs *fileSink) open() error {
+	if err := os.MkdirAll(filepath.Dir(fs.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fs.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	fs.file = f
+	fs.size = fi.Size()
+	fs.opened = time.Now()
+	if fs.size > 0 {
+		// the age of a file appended to since a restart starts from its
+		// last write, as its creation time is unknown
+		fs.opened = fi.ModTime()
+	}
+	return nil
+}
+
+// rotate closes the file, renames it with the time of the rotation and
+// removes the oldest rotated files beyond maxBackups.
+func (fs *fileSink) rotate() error {
+	if err := fs.closeFile(); err != nil {
+		return err
+	}
+	rotated := fs.path + "." + time.Now().UTC().Format(rotatedFileTimeFormat)
+	if err := os.Rename(fs.path, rotated); err != nil {
+		return err
+	}
+
+	if fs.maxBackups <= 0 {
+		return nil
+	}
+	matches, err := filepath.Glob(fs.path + ".*")
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, match := range matches {
+		suffix := strings.TrimPrefix(match, fs.path+".")
+		if _, err := time.Parse(rotatedFileTimeFormat, suffix); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > fs.maxBackups {
+		if err := os.Remove(backups[0]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+func (fs *fileSink) closeFile() error {
+	if fs.file == nil {
+		return nil
+	}
+	f := fs.file
+	fs.file = nil
+	fs.size = 0
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Close the file sink
+func (fs *fileSink) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.closed {
+		return fmt.Errorf("filesink: already closed")
+	}
+
+	fs.closed = true
+	return fs.closeFile()
+}
+
+func (fs *fileSink) String() string {
+	return fmt.Sprintf("fileSink{%s}", fs.path)
+}
@@ -0,0 +1,157 @@
+package notifications
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	events "github.com/docker/go-events"
+)
+
+// fileEnvelope is an envelope decoded from an event file.
+type fileEnvelope struct {
+	Events []Event `json:"events"`
+}
+
+func readEventFile(t *testing.T, path string) []fileEnvelope {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var envelopes []fileEnvelope
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var envelope fileEnvelope
+		if err := json.Unmarshal(scanner.Bytes(), &envelope); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		envelopes = append(envelopes, envelope)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return envelopes
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events", "events.json")
+	metrics := newSafeMetrics("file")
+	sink := newFileSink(path, 0, 0, 0, true, nil, metrics.fileSinkListener())
+
+	for _, repo := range []string{"foo/bar", "foo/baz"} {
+		if err := sink.Write(createTestEvent("push", repo, schema2.MediaTypeManifest)); err != nil {
+			t.Fatalf("unexpected error writing event: %v", err)
+		}
+	}
+	checkClose(t, sink)
+
+	// events are appended to an existing file
+	sink = newFileSink(path, 0, 0, 0, false, nil)
+	if err := sink.Write(createTestEvent("pull", "foo/bar", schema2.MediaTypeManifest)); err != nil {
+		t.Fatalf("unexpected error writing event: %v", err)
+	}
+	checkClose(t, sink)
+
+	envelopes := readEventFile(t, path)
+	if len(envelopes) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(envelopes))
+	}
+	for i, expected := range []string{"foo/bar", "foo/baz", "foo/bar"} {
+		if len(envelopes[i].Events) != 1 || envelopes[i].Events[0].Target.Repository != expected {
+			t.Fatalf("unexpected envelope %d: %+v", i, envelopes[i])
+		}
+	}
+
+	if metrics.Successes != 2 || metrics.Errors != 0 {
+		t.Fatalf("unexpected metrics: %+v", metrics.EndpointMetrics)
+	}
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.json")
+
+	event := createTestEvent("push", "foo/bar", schema2.MediaTypeManifest)
+	p, err := json.Marshal(Envelope{Events: []events.Event{event}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every file holds two events, and two rotated files are kept
+	sink := newFileSink(path, int64(2*(len(p)+1)), 0, 2, false, nil)
+	for i := 0; i < 7; i++ {
+		if err := sink.Write(event); err != nil {
+			t.Fatalf("unexpected error writing event: %v", err)
+		}
+	}
+	checkClose(t, sink)
+
+	if envelopes := readEventFile(t, path); len(envelopes) != 1 {
+		t.Fatalf("expected 1 event in the current file, got %d", len(envelopes))
+	}
+
+	rotated, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 2 {
+		t.Fatalf("expected 2 rotated files, got %v", rotated)
+	}
+	for _, path := range rotated {
+		if envelopes := readEventFile(t, path); len(envelopes) != 2 {
+			t.Fatalf("expected 2 events in %s, got %d", path, len(envelopes))
+		}
+	}
+}
+
+// shortWriteFile writes half of the next line and fails.
+type shortWriteFile struct {
+	eventFile
+	failed bool
+}
+
+func (f *shortWriteFile) Write(p []byte) (int, error) {
+	if f.failed {
+		return f.eventFile.Write(p)
+	}
+	f.failed = true
+	n, _ := f.eventFile.Write(p[:len(p)/2])
+	return n, io.ErrShortWrite
+}
+
+func TestFileSinkShortWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.json")
+	sink := newFileSink(path, 0, 0, 0, false, nil)
+
+	if err := sink.Write(createTestEvent("push", "foo/bar", schema2.MediaTypeManifest)); err != nil {
+		t.Fatalf("unexpected error writing event: %v", err)
+	}
+	sink.file = &shortWriteFile{eventFile: sink.file}
+
+	event := createTestEvent("push", "foo/baz", schema2.MediaTypeManifest)
+	if err := sink.Write(event); err == nil {
+		t.Fatal("expected an error writing event")
+	}
+	if err := sink.Write(event); err != nil {
+		t.Fatalf("unexpected error writing event again: %v", err)
+	}
+	checkClose(t, sink)
+
+	envelopes := readEventFile(t, path)
+	if len(envelopes) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(envelopes))
+	}
+	for i, expected := range []string{"foo/bar", "foo/baz"} {
+		if len(envelopes[i].Events) != 1 || envelopes[i].Events[0].Target.Repository != expected {
+			t.Fatalf("unexpected envelope %d: %+v", i, envelopes[i])
+		}
+	}
+}
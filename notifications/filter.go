@@ -0,0 +1,169 @@
+package notifications
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/distribution/distribution/v3/configuration"
+	events "github.com/docker/go-events"
+)
+
+// regexpPrefix marks the filter patterns which are regular expressions rather
+// than globs.
+const regexpPrefix = "regexp:"
+
+// compilePattern compiles a filter pattern, which is either a regular
+// expression prefixed with "regexp:", or a glob where "*" matches any
+// characters but "/", "**" any characters and "?" any single character but
+// "/". Both must match the whole value.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if expr, ok := strings.CutPrefix(pattern, regexpPrefix); ok {
+		return regexp.Compile("^(?:" + expr + ")$")
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			expr.WriteString("[^/]*")
+		case pattern[i] == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := compilePattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter pattern %q: %v", pattern, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func matchAny(res []*regexp.Regexp, value string) bool {
+	for _, re := range res {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// eventFilter matches the repository, tag and actor of events against
+// patterns.
+type eventFilter struct {
+	repositories []*regexp.Regexp
+	tags         []*regexp.Regexp
+	actors       []*regexp.Regexp
+}
+
+func newEventFilter(config configuration.EventFilter) (eventFilter, error) {
+	var ef eventFilter
+	var err error
+	if ef.repositories, err = compilePatterns(config.Repositories); err != nil {
+		return eventFilter{}, err
+	}
+	if ef.tags, err = compilePatterns(config.Tags); err != nil {
+		return eventFilter{}, err
+	}
+	if ef.actors, err = compilePatterns(config.Actors); err != nil {
+		return eventFilter{}, err
+	}
+	return ef, nil
+}
+
+func (ef eventFilter) empty() bool {
+	return len(ef.repositories) == 0 && len(ef.tags) == 0 && len(ef.actors) == 0
+}
+
+// filterListener is called with the events matched and dropped by the
+// filters of an endpoint.
+type filterListener interface {
+	matched(event events.Event)
+	dropped(event events.Event)
+}
+
+// filteredSink passes along the events matching the include rules of an
+// endpoint, if any, and none of its exclude rules, and discards the others.
+// Events without a tag are not filtered on tags. An invalid filteredSink, whose
+// rules could not be compiled, discards every event.
+type filteredSink struct {
+	events.Sink
+	include   eventFilter
+	exclude   eventFilter
+	invalid   bool
+	listeners []filterListener
+}
+
+// newFilteredSink returns a sink filtering the events written to sink, or sink
+// if there are no rules.
+func newFilteredSink(sink events.Sink, config configuration.EventFilters, listeners ...filterListener) (events.Sink, error) {
+	include, err := newEventFilter(config.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := newEventFilter(config.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	if include.empty() && exclude.empty() {
+		return sink, nil
+	}
+
+	return &filteredSink{
+		Sink:      sink,
+		include:   include,
+		exclude:   exclude,
+		listeners: listeners,
+	}, nil
+}
+
+// Write passes the event along if it matches the rules.
+func (fs *filteredSink) Write(event events.Event) error {
+	if !fs.matches(event.(Event)) {
+		for _, listener := range fs.listeners {
+			listener.dropped(event)
+		}
+		return nil
+	}
+
+	for _, listener := range fs.listeners {
+		listener.matched(event)
+	}
+	return fs.Sink.Write(event)
+}
+
+func (fs *filteredSink) matches(event Event) bool {
+	if fs.invalid {
+		return false
+	}
+
+	repository, tag, actor := event.Target.Repository, event.Target.Tag, event.Actor.Name
+
+	if len(fs.include.repositories) > 0 && !matchAny(fs.include.repositories, repository) {
+		return false
+	}
+	if len(fs.include.tags) > 0 && tag != "" && !matchAny(fs.include.tags, tag) {
+		return false
+	}
+	if len(fs.include.actors) > 0 && !matchAny(fs.include.actors, actor) {
+		return false
+	}
+
+	return !matchAny(fs.exclude.repositories, repository) &&
+		(tag == "" || !matchAny(fs.exclude.tags, tag)) &&
+		!matchAny(fs.exclude.actors, actor)
+}
@@ -0,0 +1,94 @@
+package notifications
+
+import (
+	"testing"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+)
+
+func TestCompilePattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		value   string
+		match   bool
+	}{
+		{pattern: "team-a/*", value: "team-a/app", match: true},
+		{pattern: "team-a/*", value: "team-a/sub/app"},
+		{pattern: "team-a/**", value: "team-a/sub/app", match: true},
+		{pattern: "team-a/**", value: "team-b/app"},
+		{pattern: "v1.?", value: "v1.2", match: true},
+		{pattern: "v1.?", value: "v1x2"},
+		{pattern: "regexp:v[0-9]+", value: "v12", match: true},
+		{pattern: "regexp:v[0-9]+", value: "v12-rc"},
+		{pattern: "regexp:team-(a|b)/.+", value: "team-b/app", match: true},
+	} {
+		re, err := compilePattern(tc.pattern)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.pattern, err)
+		}
+		if re.MatchString(tc.value) != tc.match {
+			t.Errorf("unexpected match of %q by %q: %v", tc.value, tc.pattern, !tc.match)
+		}
+	}
+
+	if _, err := compilePattern("regexp:("); err == nil {
+		t.Error("expected an error for an invalid regular expression")
+	}
+}
+
+func TestFilteredSink(t *testing.T) {
+	event := func(repo, tag, actor string) Event {
+		e := createTestEvent("push", repo, schema2.MediaTypeManifest)
+		e.Target.Tag = tag
+		e.Actor.Name = actor
+		return e
+	}
+
+	config := configuration.EventFilters{
+		Include: configuration.EventFilter{
+			Repositories: []string{"team-a/**"},
+			Tags:         []string{"v*", "latest"},
+		},
+		Exclude: configuration.EventFilter{
+			Repositories: []string{"team-a/scratch/**"},
+			Actors:       []string{"regexp:ci-.*"},
+		},
+	}
+
+	ts := &testSink{}
+	metrics := newSafeMetrics("test")
+	sink, err := newFilteredSink(ts, config, metrics.filterListener())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		event Event
+		match bool
+	}{
+		{event: event("team-a/app", "v1", "alice"), match: true},
+		{event: event("team-a/app", "", "alice"), match: true},
+		{event: event("team-a/app", "dev", "alice")},
+		{event: event("team-b/app", "v1", "alice")},
+		{event: event("team-a/scratch/app", "latest", "alice")},
+		{event: event("team-a/app", "latest", "ci-bot")},
+	} {
+		before := ts.count
+		if err := sink.Write(tc.event); err != nil {
+			t.Fatalf("error writing event: %v", err)
+		}
+		if (ts.count > before) != tc.match {
+			t.Errorf("unexpected filtering of %s:%s by %s", tc.event.Target.Repository, tc.event.Target.Tag, tc.event.Actor.Name)
+		}
+	}
+
+	if metrics.Matched != 2 || metrics.Dropped != 4 {
+		t.Fatalf("unexpected metrics: %+v", metrics.EndpointMetrics)
+	}
+
+	// without rules, the sink is not filtered
+	if sink, err := newFilteredSink(ts, configuration.EventFilters{}); err != nil || sink != ts {
+		t.Fatalf("unexpected sink without rules: %v, %v", sink, err)
+	}
+}
@@ -2,38 +2,43 @@ package notifications
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"sync"
 	"time"
 
 	events "github.com/docker/go-events"
+	"github.com/google/uuid"
 )
 
 // httpSink implements a single-flight, http notification endpoint. This is
 // very lightweight in that it only makes an attempt at an http request.
 // Reliability should be provided by the caller.
 type httpSink struct {
-	url string
+	url    string
+	secret []byte
+	encode eventEncoder
 
 	mu        sync.Mutex
 	closed    bool
 	client    *http.Client
 	listeners []httpStatusListener
-
-	// TODO(stevvooe): Allow one to configure the media type accepted by this
-	// sink and choose the serialization based on that.
 }
 
 // newHTTPSink returns an unreliable, single-flight http sink. Wrap in other
-// sinks for increased reliability.
-func newHTTPSink(u string, timeout time.Duration, headers http.Header, transport *http.Transport, listeners ...httpStatusListener) *httpSink {
+// sinks for increased reliability. If secret is not empty, the requests are
+// signed with it. The events are sent in an envelope if encode is nil.
+func newHTTPSink(u string, timeout time.Duration, headers http.Header, secret string, encode eventEncoder, transport *http.Transport, listeners ...httpStatusListener) *httpSink {
 	if transport == nil {
 		transport = http.DefaultTransport.(*http.Transport)
 	}
+	if encode == nil {
+		encode = encodeEnvelope
+	}
 	return &httpSink{
 		url:       u,
+		secret:    []byte(secret),
+		encode:    encode,
 		listeners: listeners,
 		client: &http.Client{
 			Transport: &headerRoundTripper{
@@ -64,24 +69,33 @@ func (hs *httpSink) Write(event events.Event) error {
 		return ErrSinkClosed
 	}
 
-	envelope := Envelope{
-		Events: []events.Event{event},
-	}
-
 	// TODO(stevvooe): It is not ideal to keep re-encoding the request body on
 	// retry but we are going to do it to keep the code simple. It is likely
 	// we could change the event struct to manage its own buffer.
 
-	p, err := json.MarshalIndent(envelope, "", "   ")
+	p, header, err := hs.encode(event)
+	if err != nil {
+		for _, listener := range hs.listeners {
+			listener.err(err, event)
+		}
+		return fmt.Errorf("%v: error encoding event: %v", hs, err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, hs.url, bytes.NewReader(p))
 	if err != nil {
 		for _, listener := range hs.listeners {
 			listener.err(err, event)
 		}
-		return fmt.Errorf("%v: error marshaling event envelope: %v", hs, err)
+		return fmt.Errorf("%v: error creating request: %v", hs, err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if len(hs.secret) > 0 {
+		setSignature(req.Header, hs.secret, uuid.NewString(), time.Now(), p)
 	}
 
-	body := bytes.NewReader(p)
-	resp, err := hs.client.Post(hs.url, EventsMediaType, body)
+	resp, err := hs.client.Do(req)
 	if err != nil {
 		for _, listener := range hs.listeners {
 			listener.err(err, event)
@@ -65,7 +65,7 @@ func TestHTTPSink(t *testing.T) {
 	server := httptest.NewTLSServer(serverHandler)
 
 	metrics := newSafeMetrics("")
-	sink := newHTTPSink(server.URL, 0, nil, nil,
+	sink := newHTTPSink(server.URL, 0, nil, "", nil, nil,
 		&endpointMetricsHTTPStatusListener{safeMetrics: metrics})
 
 	// first make sure that the default transport gives x509 untrusted cert error
@@ -82,7 +82,7 @@ func TestHTTPSink(t *testing.T) {
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
-	sink = newHTTPSink(server.URL, 0, nil, tr,
+	sink = newHTTPSink(server.URL, 0, nil, "", nil, tr,
 		&endpointMetricsHTTPStatusListener{safeMetrics: metrics})
 	err = sink.Write(event)
 	if err != nil {
@@ -92,7 +92,7 @@ func TestHTTPSink(t *testing.T) {
 	// reset server to standard http server and sink to a basic sink
 	metrics = newSafeMetrics("")
 	server = httptest.NewServer(serverHandler)
-	sink = newHTTPSink(server.URL, 0, nil, nil,
+	sink = newHTTPSink(server.URL, 0, nil, "", nil, nil,
 		&endpointMetricsHTTPStatusListener{safeMetrics: metrics})
 	var expectedMetrics EndpointMetrics
 	expectedMetrics.Statuses = make(map[string]int)
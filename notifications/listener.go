@@ -33,6 +33,26 @@ type RepoListener interface {
 	RepoDeleted(repo reference.Named) error
 }
 
+// TagListener describes a listener that can respond to tag events with the
+// descriptors of the manifests the tag referred to before and after them. It
+// is optional: the tag services of the repositories of Listen only dispatch
+// these events to listeners implementing it, which are notified of untagging
+// through TagUntagged rather than TagDeleted.
+type TagListener interface {
+	TagCreated(repo reference.Named, tag string, desc distribution.Descriptor) error
+	TagMoved(repo reference.Named, tag string, previous, desc distribution.Descriptor) error
+	TagUntagged(repo reference.Named, tag string, previous distribution.Descriptor) error
+}
+
+// SweepListener describes a listener that can respond to the removal of
+// content from the storage of the registry by background operations: blobs
+// deleted from the registry as a whole rather than from a repository, and
+// abandoned uploads.
+type SweepListener interface {
+	BlobSwept(dgst digest.Digest) error
+	UploadPurged(repo reference.Named, id string) error
+}
+
 // Listener combines all repository events into a single interface.
 type Listener interface {
 	ManifestListener
@@ -252,11 +272,61 @@ func (rl *repositoryListener) Tags(ctx context.Context) distribution.TagService
 	}
 }
 
+func (tagSL *tagServiceListener) Tag(ctx context.Context, tag string, desc distribution.Descriptor) error {
+	tl, ok := tagSL.parent.listener.(TagListener)
+	if !ok {
+		return tagSL.TagService.Tag(ctx, tag, desc)
+	}
+
+	previous, err := tagSL.TagService.Get(ctx, tag)
+	existed := err == nil
+	if err != nil {
+		if _, ok := err.(distribution.ErrTagUnknown); !ok {
+			dcontext.GetLogger(ctx).Errorf("error resolving previous descriptor of tag %s in tag listener: %v", tag, err)
+		}
+	}
+
+	if err := tagSL.TagService.Tag(ctx, tag, desc); err != nil {
+		return err
+	}
+
+	switch {
+	case !existed:
+		err = tl.TagCreated(tagSL.parent.Repository.Named(), tag, desc)
+	case previous.Digest != desc.Digest:
+		err = tl.TagMoved(tagSL.parent.Repository.Named(), tag, previous, desc)
+	}
+	if err != nil {
+		dcontext.GetLogger(ctx).Errorf("error dispatching tag to listener: %v", err)
+	}
+	return nil
+}
+
 func (tagSL *tagServiceListener) Untag(ctx context.Context, tag string) error {
+	// listeners of tag events are notified with the descriptor the tag
+	// referred to, if it can be resolved
+	tl, ok := tagSL.parent.listener.(TagListener)
+	var previous distribution.Descriptor
+	if ok {
+		var err error
+		if previous, err = tagSL.TagService.Get(ctx, tag); err != nil {
+			ok = false
+		}
+	}
+
 	if err := tagSL.TagService.Untag(ctx, tag); err != nil {
 		return err
 	}
-	if err := tagSL.parent.listener.TagDeleted(tagSL.parent.Repository.Named(), tag); err != nil {
+
+	dispatch := func() error {
+		return tagSL.parent.listener.TagDeleted(tagSL.parent.Repository.Named(), tag)
+	}
+	if ok {
+		dispatch = func() error {
+			return tl.TagUntagged(tagSL.parent.Repository.Named(), tag, previous)
+		}
+	}
+	if err := dispatch(); err != nil {
 		dcontext.GetLogger(ctx).Errorf("error dispatching tag deleted to listener: %v", err)
 		return err
 	}
@@ -60,10 +60,71 @@ func TestListener(t *testing.T) {
 	}
 }
 
+func TestTagListener(t *testing.T) {
+	ctx := dcontext.Background()
+
+	registry, err := storage.NewRegistry(ctx, inmemory.New(), storage.EnableDelete)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	repoRef, _ := reference.WithName("foo/bar")
+	repository, err := registry.Repository(ctx, repoRef)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	tl := &testTagListener{testListener: testListener{ops: make(map[string]int)}}
+	repository, _ = Listen(repository, nil, tl)
+	tags := repository.Tags(ctx)
+
+	first := distribution.Descriptor{MediaType: schema2.MediaTypeManifest, Digest: digest.FromString("first"), Size: 5}
+	second := distribution.Descriptor{MediaType: schema2.MediaTypeManifest, Digest: digest.FromString("second"), Size: 6}
+	for _, desc := range []distribution.Descriptor{first, first, second} {
+		if err := tags.Tag(ctx, "latest", desc); err != nil {
+			t.Fatalf("unexpected error tagging: %v", err)
+		}
+	}
+	if err := tags.Untag(ctx, "latest"); err != nil {
+		t.Fatalf("unexpected error untagging: %v", err)
+	}
+
+	expected := []string{
+		"created latest " + first.Digest.String(),
+		"moved latest " + first.Digest.String() + " " + second.Digest.String(),
+		"untagged latest " + second.Digest.String(),
+	}
+	if !reflect.DeepEqual(tl.events, expected) {
+		t.Fatalf("unexpected tag events:\n%v\n !=\n%v", tl.events, expected)
+	}
+	if tl.ops["tag:delete"] != 0 {
+		t.Fatalf("tag deleted should not be dispatched to tag listeners")
+	}
+}
+
 type testListener struct {
 	ops map[string]int
 }
 
+type testTagListener struct {
+	testListener
+	events []string
+}
+
+func (tl *testTagListener) TagCreated(repo reference.Named, tag string, desc distribution.Descriptor) error {
+	tl.events = append(tl.events, "created "+tag+" "+desc.Digest.String())
+	return nil
+}
+
+func (tl *testTagListener) TagMoved(repo reference.Named, tag string, previous, desc distribution.Descriptor) error {
+	tl.events = append(tl.events, "moved "+tag+" "+previous.Digest.String()+" "+desc.Digest.String())
+	return nil
+}
+
+func (tl *testTagListener) TagUntagged(repo reference.Named, tag string, previous distribution.Descriptor) error {
+	tl.events = append(tl.events, "untagged "+tag+" "+previous.Digest.String())
+	return nil
+}
+
 func (tl *testListener) ManifestPushed(repo reference.Named, m distribution.Manifest, options ...distribution.ManifestServiceOption) error {
 	tl.ops["manifest:push"]++
 	return nil
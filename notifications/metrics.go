@@ -75,12 +75,15 @@ func init() {
 // number of events. The goal of this to export it via expvar but we may find
 // some other future solution to be better.
 type EndpointMetrics struct {
-	Pending   int            // events pending in queue
-	Events    int            // total events incoming
-	Successes int            // total events written successfully
-	Failures  int            // total events failed
-	Errors    int            // total events errored
-	Statuses  map[string]int // status code histogram, per call event
+	Pending      int            // events pending in queue
+	Events       int            // total events incoming
+	Successes    int            // total events written successfully
+	Failures     int            // total events failed
+	Errors       int            // total events errored
+	DeadLettered int            // total events moved to the dead-letter area
+	Matched      int            // total events matching the filters
+	Dropped      int            // total events dropped by the filters
+	Statuses     map[string]int // status code histogram, per call event
 }
 
 // safeMetrics guards the metrics implementation with a lock and provides a
@@ -107,8 +110,24 @@ func (sm *safeMetrics) httpStatusListener() httpStatusListener {
 	}
 }
 
+// fileSinkListener returns the listener for the file sink that updates the
+// relevant counters.
+func (sm *safeMetrics) fileSinkListener() fileSinkListener {
+	return &endpointMetricsFileSinkListener{
+		safeMetrics: sm,
+	}
+}
+
+// filterListener returns the listener for the filters that updates the
+// relevant counters.
+func (sm *safeMetrics) filterListener() filterListener {
+	return &endpointMetricsFilterListener{
+		safeMetrics: sm,
+	}
+}
+
 // eventQueueListener returns a listener that maintains queue related counters.
-func (sm *safeMetrics) eventQueueListener() eventQueueListener {
+func (sm *safeMetrics) eventQueueListener() persistentQueueListener {
 	return &endpointMetricsEventQueueListener{
 		safeMetrics: sm,
 	}
@@ -150,6 +169,54 @@ func (emsl *endpointMetricsHTTPStatusListener) err(err error, event events.Event
 	eventsCounter.WithValues("Errors", emsl.EndpointName).Inc(1)
 }
 
+// endpointMetricsFileSinkListener increments counters related to file sinks
+// for the relevant events.
+type endpointMetricsFileSinkListener struct {
+	*safeMetrics
+}
+
+var _ fileSinkListener = &endpointMetricsFileSinkListener{}
+
+func (emfl *endpointMetricsFileSinkListener) success(event events.Event) {
+	emfl.safeMetrics.Lock()
+	defer emfl.safeMetrics.Unlock()
+	emfl.Successes++
+
+	eventsCounter.WithValues("Successes", emfl.EndpointName).Inc(1)
+}
+
+func (emfl *endpointMetricsFileSinkListener) err(err error, event events.Event) {
+	emfl.safeMetrics.Lock()
+	defer emfl.safeMetrics.Unlock()
+	emfl.Errors++
+
+	eventsCounter.WithValues("Errors", emfl.EndpointName).Inc(1)
+}
+
+// endpointMetricsFilterListener counts the events matched and dropped by the
+// filters.
+type endpointMetricsFilterListener struct {
+	*safeMetrics
+}
+
+var _ filterListener = &endpointMetricsFilterListener{}
+
+func (emfl *endpointMetricsFilterListener) matched(event events.Event) {
+	emfl.safeMetrics.Lock()
+	defer emfl.safeMetrics.Unlock()
+	emfl.Matched++
+
+	eventsCounter.WithValues("Matched", emfl.EndpointName).Inc(1)
+}
+
+func (emfl *endpointMetricsFilterListener) dropped(event events.Event) {
+	emfl.safeMetrics.Lock()
+	defer emfl.safeMetrics.Unlock()
+	emfl.Dropped++
+
+	eventsCounter.WithValues("Dropped", emfl.EndpointName).Inc(1)
+}
+
 // endpointMetricsEventQueueListener maintains the incoming events counter and
 // the queues pending count.
 type endpointMetricsEventQueueListener struct {
@@ -174,6 +241,14 @@ func (eqc *endpointMetricsEventQueueListener) egress(event events.Event) {
 	pendingGauge.WithValues(eqc.EndpointName).Dec(1)
 }
 
+func (eqc *endpointMetricsEventQueueListener) deadLettered(event events.Event) {
+	eqc.Lock()
+	defer eqc.Unlock()
+	eqc.DeadLettered++
+
+	eventsCounter.WithValues("DeadLettered", eqc.EndpointName).Inc(1)
+}
+
 // register places the endpoint into expvar so that stats are tracked.
 func register(e *Endpoint) {
 	endpoints.mu.Lock()
@@ -0,0 +1,433 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	events "github.com/docker/go-events"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultQueueMaxSize = 10000
+
+	// queueRecoveryBackoff is the time after which the queue is read again
+	// after a storage error.
+	queueRecoveryBackoff = 10 * time.Second
+)
+
+// persistentQueue accepts events into a queue persisted through a storage
+// driver, so that the events not yet delivered survive restarts. Events are
+// written to the sink one at a time, in order, and retried until the sink
+// accepts them or their retry budget is exceeded, after which they are moved
+// to the dead-letter area.
+//
+// The queue holds at most maxSize events. Events written to a full queue are
+// moved straight to the dead-letter area. Events which cannot be persisted are
+// kept in memory, and persisting them is retried until they are delivered or
+// the queue is closed.
+type persistentQueue struct {
+	sink       events.Sink
+	driver     storagedriver.StorageDriver
+	root       string
+	strategy   events.RetryStrategy
+	maxSize    int
+	maxRetries int
+	listeners  []persistentQueueListener
+
+	mu          sync.Mutex
+	cond        *sync.Cond
+	pending     []string          // keys of the queued events, oldest first
+	unpersisted map[string][]byte // records of the queued events not persisted yet
+	last        int64
+	closed      bool
+	closing     chan struct{}
+	done        chan struct{}
+}
+
+// persistentQueueListener is called when events enter and leave the queue,
+// and when they are moved to the dead-letter area.
+type persistentQueueListener interface {
+	eventQueueListener
+	deadLettered(event events.Event)
+}
+
+// queuedEvent is the record of an event in the queue and in the dead-letter
+// area.
+type queuedEvent struct {
+	Event     Event  `json:"event"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// newPersistentQueue returns a queue to the provided sink, persisted through
+// driver under root. The events persisted by a previous run are recovered in
+// the background, ahead of the events written since.
+func newPersistentQueue(sink events.Sink, driver storagedriver.StorageDriver, root string, strategy events.RetryStrategy, maxSize, maxRetries int, listeners ...persistentQueueListener) *persistentQueue {
+	if maxSize <= 0 {
+		maxSize = defaultQueueMaxSize
+	}
+	if root == "" {
+		root = "/"
+	}
+	pq := persistentQueue{
+		sink:        sink,
+		driver:      driver,
+		root:        root,
+		strategy:    strategy,
+		maxSize:     maxSize,
+		maxRetries:  maxRetries,
+		listeners:   listeners,
+		unpersisted: make(map[string][]byte),
+		closing:     make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	pq.cond = sync.NewCond(&pq.mu)
+	go pq.run()
+	return &pq
+}
+
+func (pq *persistentQueue) queuePath(key string) string {
+	return path.Join(pq.root, "queue", key)
+}
+
+func (pq *persistentQueue) deadLetterPath(key string) string {
+	return path.Join(pq.root, "deadletter", key)
+}
+
+// Write queues the event, only failing if the queue has been closed. The
+// event is persisted outside of the lock of the queue, and kept in memory if
+// that fails.
+func (pq *persistentQueue) Write(event events.Event) error {
+	e, ok := event.(Event)
+	if !ok {
+		return fmt.Errorf("persistentqueue: unexpected event %T", event)
+	}
+	p, err := json.Marshal(queuedEvent{Event: e})
+	if err != nil {
+		return fmt.Errorf("persistentqueue: error marshaling event: %v", err)
+	}
+
+	pq.mu.Lock()
+	if pq.closed {
+		pq.mu.Unlock()
+		return ErrSinkClosed
+	}
+
+	key := pq.nextKey()
+	if len(pq.pending) >= pq.maxSize {
+		pq.mu.Unlock()
+		logrus.Warnf("persistentqueue: queue of %v is full, moving event %s to the dead-letter area", pq.sink, e.ID)
+		if err := pq.driver.PutContent(context.Background(), pq.deadLetterPath(key), p); err != nil {
+			logrus.Errorf("persistentqueue: error writing dead letter %s: %v", key, err)
+		}
+		for _, listener := range pq.listeners {
+			listener.deadLettered(event)
+		}
+		return nil
+	}
+
+	pq.pending = append(pq.pending, key)
+	pq.unpersisted[key] = p
+	for _, listener := range pq.listeners {
+		listener.ingress(event)
+	}
+	pq.cond.Signal()
+	pq.mu.Unlock()
+
+	if err := pq.persist(key, p); err != nil {
+		logrus.Warnf("persistentqueue: error persisting event %s, keeping it in memory: %v", e.ID, err)
+	}
+	return nil
+}
+
+// persist writes the record of the queued event with the key. A record which
+// cannot be written is kept in memory, if the event is not persisted yet.
+func (pq *persistentQueue) persist(key string, p []byte) error {
+	ctx := context.Background()
+	err := pq.driver.PutContent(ctx, pq.queuePath(key), p)
+
+	pq.mu.Lock()
+	if !pq.queued(key) {
+		pq.mu.Unlock()
+		if err == nil {
+			// the event was delivered while being persisted
+			if err := pq.driver.Delete(ctx, pq.queuePath(key)); err != nil {
+				if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+					logrus.Errorf("persistentqueue: error removing event %s of %v: %v", key, pq.sink, err)
+				}
+			}
+		}
+		return nil
+	}
+	defer pq.mu.Unlock()
+
+	if _, ok := pq.unpersisted[key]; ok {
+		if err != nil {
+			pq.unpersisted[key] = p
+		} else {
+			delete(pq.unpersisted, key)
+		}
+	}
+	return err
+}
+
+// persistPending retries persisting the records kept in memory, giving up at
+// the first failure.
+func (pq *persistentQueue) persistPending() {
+	pq.mu.Lock()
+	records := make(map[string][]byte, len(pq.unpersisted))
+	for key, p := range pq.unpersisted {
+		records[key] = p
+	}
+	pq.mu.Unlock()
+
+	for key, p := range records {
+		if err := pq.persist(key, p); err != nil {
+			logrus.Errorf("persistentqueue: error persisting %d events of %v kept in memory: %v", len(records), pq.sink, err)
+			return
+		}
+	}
+}
+
+// queued returns whether the event with the key is in the queue. The keys of
+// the queued events are sorted. The lock of the queue must be held.
+func (pq *persistentQueue) queued(key string) bool {
+	i := sort.SearchStrings(pq.pending, key)
+	return i < len(pq.pending) && pq.pending[i] == key
+}
+
+// nextKey returns the key of a new event, which sorts after the keys of the
+// events written before, including by a previous run.
+func (pq *persistentQueue) nextKey() string {
+	now := time.Now().UnixNano()
+	if now <= pq.last {
+		now = pq.last + 1
+	}
+	pq.last = now
+	return fmt.Sprintf("%020d", now)
+}
+
+// Close stops the delivery of the events, which are delivered after a
+// restart, persisting those kept in memory, and closes the sink.
+func (pq *persistentQueue) Close() error {
+	pq.mu.Lock()
+	if pq.closed {
+		pq.mu.Unlock()
+		return fmt.Errorf("persistentqueue: already closed")
+	}
+	pq.closed = true
+	close(pq.closing)
+	pq.cond.Broadcast()
+	pq.mu.Unlock()
+
+	<-pq.done
+	pq.persistPending()
+	return pq.sink.Close()
+}
+
+// run is the main goroutine to deliver events to the target sink.
+func (pq *persistentQueue) run() {
+	defer close(pq.done)
+
+	for !pq.recover() {
+		select {
+		case <-time.After(queueRecoveryBackoff):
+		case <-pq.closing:
+			return
+		}
+	}
+
+	var persisted time.Time
+	for {
+		key, ok := pq.next()
+		if !ok {
+			return // the queue is closed
+		}
+		if time.Since(persisted) >= queueRecoveryBackoff {
+			pq.persistPending()
+			persisted = time.Now()
+		}
+		if !pq.deliver(key) {
+			return
+		}
+	}
+}
+
+// recover queues the events persisted by a previous run, returning whether
+// they could be listed.
+func (pq *persistentQueue) recover() bool {
+	keys, err := pq.driver.List(context.Background(), path.Join(pq.root, "queue"))
+	if err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return true
+		}
+		logrus.Errorf("persistentqueue: error recovering the queue of %v, retrying: %v", pq.sink, err)
+		return false
+	}
+
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+
+	queued := make(map[string]struct{}, len(pq.pending))
+	for _, key := range pq.pending {
+		queued[key] = struct{}{}
+	}
+	for _, p := range keys {
+		key := path.Base(p)
+		if _, ok := queued[key]; ok {
+			continue
+		}
+		// new events sort after the recovered ones, even if the clock
+		// went back since the previous run
+		if n, err := strconv.ParseInt(key, 10, 64); err == nil && n > pq.last {
+			pq.last = n
+		}
+		for _, listener := range pq.listeners {
+			listener.ingress(nil)
+		}
+		pq.pending = append(pq.pending, key)
+	}
+	sort.Strings(pq.pending)
+	pq.cond.Signal()
+	return true
+}
+
+// next blocks until an event is queued, returning its key, or until the queue
+// is closed.
+func (pq *persistentQueue) next() (string, bool) {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+
+	for len(pq.pending) < 1 {
+		if pq.closed {
+			return "", false
+		}
+
+		pq.cond.Wait()
+	}
+	if pq.closed {
+		return "", false
+	}
+	return pq.pending[0], true
+}
+
+// deliver writes the event with the key to the sink until it is accepted or
+// its retry budget is exceeded, then removes it from the queue. It returns
+// false if the queue was closed, leaving the event queued.
+func (pq *persistentQueue) deliver(key string) bool {
+	ctx := context.Background()
+
+	pq.mu.Lock()
+	p, inMemory := pq.unpersisted[key]
+	pq.mu.Unlock()
+
+	var err error
+	if !inMemory {
+		p, err = pq.driver.GetContent(ctx, pq.queuePath(key))
+	}
+	switch err.(type) {
+	case nil:
+	case storagedriver.PathNotFoundError:
+		pq.remove(key, nil, false)
+		return true
+	default:
+		logrus.Errorf("persistentqueue: error reading event %s of %v, retrying: %v", key, pq.sink, err)
+		select {
+		case <-time.After(queueRecoveryBackoff):
+			return true
+		case <-pq.closing:
+			return false
+		}
+	}
+
+	var qe queuedEvent
+	if err := json.Unmarshal(p, &qe); err != nil {
+		logrus.Errorf("persistentqueue: error reading event %s of %v, moving it to the dead-letter area: %v", key, pq.sink, err)
+		if err := pq.driver.PutContent(ctx, pq.deadLetterPath(key), p); err != nil {
+			logrus.Errorf("persistentqueue: error writing dead letter %s: %v", key, err)
+		}
+		pq.remove(key, nil, true)
+		return true
+	}
+
+	for {
+		if backoff := pq.strategy.Proceed(qe.Event); backoff > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-pq.closing:
+				return false
+			}
+		}
+
+		err := pq.sink.Write(qe.Event)
+		if err == nil {
+			pq.strategy.Success(qe.Event)
+			pq.remove(key, qe.Event, false)
+			return true
+		}
+		if err == ErrSinkClosed {
+			return false
+		}
+		pq.strategy.Failure(qe.Event, err)
+
+		qe.Attempts++
+		qe.LastError = err.Error()
+		if record, err := json.Marshal(qe); err == nil {
+			p = record
+		}
+
+		if pq.maxRetries > 0 && qe.Attempts > pq.maxRetries {
+			logrus.Errorf("persistentqueue: event %s exceeded its retry budget, moving it to the dead-letter area: %s", qe.Event.ID, qe.LastError)
+			if err := pq.driver.PutContent(ctx, pq.deadLetterPath(key), p); err != nil {
+				logrus.Errorf("persistentqueue: error writing dead letter %s: %v", key, err)
+			}
+			pq.remove(key, qe.Event, true)
+			return true
+		}
+
+		logrus.Warnf("persistentqueue: error writing event %s to %v, retrying: %s", qe.Event.ID, pq.sink, qe.LastError)
+		if err := pq.persist(key, p); err != nil {
+			logrus.Errorf("persistentqueue: error persisting attempts of event %s: %v", key, err)
+		}
+
+		select {
+		case <-pq.closing:
+			return false
+		default:
+		}
+	}
+}
+
+// remove deletes the event with the key from the queue.
+func (pq *persistentQueue) remove(key string, event events.Event, deadLettered bool) {
+	if err := pq.driver.Delete(context.Background(), pq.queuePath(key)); err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			logrus.Errorf("persistentqueue: error removing event %s of %v: %v", key, pq.sink, err)
+		}
+	}
+
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+
+	pq.pending = pq.pending[1:]
+	delete(pq.unpersisted, key)
+	for _, listener := range pq.listeners {
+		listener.egress(event)
+		if deadLettered {
+			listener.deadLettered(event)
+		}
+	}
+}
+
+func (pq *persistentQueue) String() string {
+	return fmt.Sprintf("persistentQueue{%v}", pq.sink)
+}
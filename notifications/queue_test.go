@@ -0,0 +1,205 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	events "github.com/docker/go-events"
+)
+
+// recordingSink records the repositories of the events written to it, and
+// fails while failing is set.
+type recordingSink struct {
+	mu      sync.Mutex
+	failing bool
+	repos   []string
+	closed  bool
+}
+
+func (rs *recordingSink) Write(event events.Event) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.failing {
+		return errors.New("unavailable")
+	}
+	rs.repos = append(rs.repos, event.(Event).Target.Repository)
+	return nil
+}
+
+func (rs *recordingSink) Close() error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.closed = true
+	return nil
+}
+
+func (rs *recordingSink) String() string {
+	return "recordingSink"
+}
+
+func (rs *recordingSink) written() []string {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return append([]string(nil), rs.repos...)
+}
+
+// unwritableDriver fails to write content while failing is set.
+type unwritableDriver struct {
+	storagedriver.StorageDriver
+
+	mu      sync.Mutex
+	failing bool
+}
+
+func (d *unwritableDriver) PutContent(ctx context.Context, path string, content []byte) error {
+	d.mu.Lock()
+	failing := d.failing
+	d.mu.Unlock()
+	if failing {
+		return errors.New("storage unavailable")
+	}
+	return d.StorageDriver.PutContent(ctx, path, content)
+}
+
+func (d *unwritableDriver) setFailing(failing bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failing = failing
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		if condition() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timed out")
+}
+
+func TestPersistentQueueRecovery(t *testing.T) {
+	driver := inmemory.New()
+	root := "/notifications/test"
+
+	// events are kept while the sink is failing, including across a restart
+	failing := &recordingSink{failing: true}
+	pq := newPersistentQueue(failing, driver, root, events.NewBreaker(1, time.Hour), 0, 0)
+	for _, repo := range []string{"foo/a", "foo/b", "foo/c"} {
+		if err := pq.Write(createTestEvent("push", repo, "blob")); err != nil {
+			t.Fatalf("unexpected error writing event: %v", err)
+		}
+	}
+	checkClose(t, pq)
+
+	var sink recordingSink
+	metrics := newSafeMetrics("test")
+	pq = newPersistentQueue(&sink, driver, root, events.NewBreaker(1, time.Millisecond), 0, 0, metrics.eventQueueListener())
+	if err := pq.Write(createTestEvent("push", "foo/d", "blob")); err != nil {
+		t.Fatalf("unexpected error writing event: %v", err)
+	}
+	waitFor(t, func() bool { return len(sink.written()) == 4 })
+	checkClose(t, pq)
+
+	for i, expected := range []string{"foo/a", "foo/b", "foo/c", "foo/d"} {
+		if sink.written()[i] != expected {
+			t.Fatalf("unexpected order of events: %v", sink.written())
+		}
+	}
+	if !sink.closed {
+		t.Fatal("sink should have been closed")
+	}
+	if metrics.Pending != 0 {
+		t.Fatalf("unexpected pending count: %d", metrics.Pending)
+	}
+	if keys, err := driver.List(context.Background(), root+"/queue"); err == nil && len(keys) != 0 {
+		t.Fatalf("unexpected queued events: %v", keys)
+	}
+}
+
+func TestPersistentQueueDeadLetter(t *testing.T) {
+	driver := inmemory.New()
+	sink := &recordingSink{failing: true}
+	metrics := newSafeMetrics("test")
+	pq := newPersistentQueue(sink, driver, "/", events.NewBreaker(10, time.Millisecond), 1, 2, metrics.eventQueueListener())
+
+	for _, repo := range []string{"foo/a", "foo/b"} {
+		if err := pq.Write(createTestEvent("push", repo, "blob")); err != nil {
+			t.Fatalf("unexpected error writing event: %v", err)
+		}
+	}
+
+	// foo/b is dead-lettered as the queue is full, then foo/a once it
+	// exceeds its retries
+	waitFor(t, func() bool {
+		metrics.Lock()
+		defer metrics.Unlock()
+		return metrics.DeadLettered == 2
+	})
+	checkClose(t, pq)
+
+	keys, err := driver.List(context.Background(), "/deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 dead letters, got %v", keys)
+	}
+
+	attempts := make(map[string]int)
+	for _, key := range keys {
+		p, err := driver.GetContent(context.Background(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var qe queuedEvent
+		if err := json.Unmarshal(p, &qe); err != nil {
+			t.Fatal(err)
+		}
+		attempts[qe.Event.Target.Repository] = qe.Attempts
+	}
+	if attempts["foo/a"] != 3 || attempts["foo/b"] != 0 {
+		t.Fatalf("unexpected attempts of the dead letters: %v", attempts)
+	}
+	if metrics.Pending != 0 {
+		t.Fatalf("unexpected pending count: %d", metrics.Pending)
+	}
+}
+
+func TestPersistentQueueKeepsUnpersistedEvents(t *testing.T) {
+	driver := &unwritableDriver{StorageDriver: inmemory.New(), failing: true}
+	root := "/notifications/test"
+
+	// events which cannot be persisted are still delivered
+	var sink recordingSink
+	pq := newPersistentQueue(&sink, driver, root, events.NewBreaker(1, time.Millisecond), 0, 0)
+	if err := pq.Write(createTestEvent("push", "foo/a", "blob")); err != nil {
+		t.Fatalf("unexpected error writing event: %v", err)
+	}
+	waitFor(t, func() bool { return len(sink.written()) == 1 })
+	checkClose(t, pq)
+
+	// and persisted once the storage is back, when the queue is closed
+	failing := &recordingSink{failing: true}
+	pq = newPersistentQueue(failing, driver, root, events.NewBreaker(1, time.Hour), 0, 0)
+	if err := pq.Write(createTestEvent("push", "foo/b", "blob")); err != nil {
+		t.Fatalf("unexpected error writing event: %v", err)
+	}
+	driver.setFailing(false)
+	checkClose(t, pq)
+
+	var recovered recordingSink
+	pq = newPersistentQueue(&recovered, driver, root, events.NewBreaker(1, time.Millisecond), 0, 0)
+	waitFor(t, func() bool { return len(recovered.written()) == 1 })
+	checkClose(t, pq)
+
+	if recovered.written()[0] != "foo/b" {
+		t.Fatalf("unexpected events: %v", recovered.written())
+	}
+}
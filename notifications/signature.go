@@ -0,0 +1,152 @@
+package notifications
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers of the notification requests of endpoints configured with a secret.
+const (
+	// SignatureHeader carries the HMAC-SHA256 of the delivery identifier,
+	// the timestamp and the body of the request, separated by ".", keyed by
+	// the secret of the endpoint, as "sha256=<hex>".
+	SignatureHeader = "Registry-Signature"
+
+	// TimestampHeader carries the time at which the request was sent, in
+	// seconds since the Unix epoch.
+	TimestampHeader = "Registry-Timestamp"
+
+	// DeliveryIDHeader carries a unique identifier of the request, which
+	// is new for each attempt at delivering events.
+	DeliveryIDHeader = "Registry-Delivery-Id"
+
+	signaturePrefix = "sha256="
+
+	// DefaultSignatureTolerance is the maximum age of a request accepted by
+	// VerifySignature when no tolerance is given.
+	DefaultSignatureTolerance = 5 * time.Minute
+)
+
+var (
+	// ErrInvalidSignature is returned when the signature of a request is
+	// missing or does not match its body.
+	ErrInvalidSignature = errors.New("notifications: invalid signature")
+
+	// ErrSignatureExpired is returned when the timestamp of a request is
+	// missing or outside of the tolerance.
+	ErrSignatureExpired = errors.New("notifications: signature timestamp outside of tolerance")
+
+	// ErrReplayedDelivery is returned when a request with the same delivery
+	// identifier was already verified.
+	ErrReplayedDelivery = errors.New("notifications: replayed delivery")
+)
+
+// sign returns the signature of the body delivered as deliveryID at the
+// timestamp. The delivery identifier is signed so that a captured request
+// cannot be replayed under another identifier.
+func sign(secret []byte, deliveryID, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(deliveryID))
+	mac.Write([]byte{'.'})
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// setSignature sets the signature, timestamp and delivery id headers of a
+// request with the body.
+func setSignature(header http.Header, secret []byte, deliveryID string, now time.Time, body []byte) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	header.Set(DeliveryIDHeader, deliveryID)
+	header.Set(TimestampHeader, timestamp)
+	header.Set(SignatureHeader, sign(secret, deliveryID, timestamp, body))
+}
+
+// VerifySignature verifies that the notification request with the header and
+// the body was signed with the secret less than tolerance ago, which defaults
+// to DefaultSignatureTolerance. It does not detect replayed requests; see
+// Verifier.
+func VerifySignature(secret []byte, header http.Header, body []byte, tolerance time.Duration) error {
+	if tolerance <= 0 {
+		tolerance = DefaultSignatureTolerance
+	}
+
+	timestamp := header.Get(TimestampHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrSignatureExpired
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return ErrSignatureExpired
+	}
+
+	signature := header.Get(SignatureHeader)
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(sign(secret, header.Get(DeliveryIDHeader), timestamp, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Verifier verifies the signature of notification requests, and rejects the
+// requests whose delivery identifier it already verified, so that a captured
+// request cannot be replayed within the tolerance. It is safe for concurrent
+// use.
+type Verifier struct {
+	// Secret is the secret of the endpoint.
+	Secret []byte
+
+	// Tolerance is the maximum age of the requests, defaulting to
+	// DefaultSignatureTolerance.
+	Tolerance time.Duration
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// Verify verifies the notification request with the header and the body.
+func (v *Verifier) Verify(header http.Header, body []byte) error {
+	tolerance := v.Tolerance
+	if tolerance <= 0 {
+		tolerance = DefaultSignatureTolerance
+	}
+	if err := VerifySignature(v.Secret, header, body, tolerance); err != nil {
+		return err
+	}
+
+	deliveryID := header.Get(DeliveryIDHeader)
+	if deliveryID == "" {
+		return ErrInvalidSignature
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := time.Now()
+	if v.seen == nil {
+		v.seen = make(map[string]time.Time)
+	}
+	for id, expiry := range v.seen {
+		if now.After(expiry) {
+			delete(v.seen, id)
+		}
+	}
+	if _, ok := v.seen[deliveryID]; ok {
+		return fmt.Errorf("%w: %s", ErrReplayedDelivery, deliveryID)
+	}
+	// requests are rejected as expired past twice the tolerance, given
+	// timestamps up to tolerance in the future
+	v.seen[deliveryID] = now.Add(2 * tolerance)
+	return nil
+}
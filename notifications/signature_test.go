@@ -0,0 +1,84 @@
+package notifications
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/manifest/schema2"
+)
+
+func TestHTTPSinkSignature(t *testing.T) {
+	secret := "a secret"
+	verifier := &Verifier{Secret: []byte(secret)}
+
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		header, body = r.Header.Clone(), p
+
+		if err := verifier.Verify(r.Header, p); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sink := newHTTPSink(server.URL, 0, nil, secret, nil, nil)
+	event := createTestEvent("push", "library/test", schema2.MediaTypeManifest)
+	for i := 0; i < 2; i++ {
+		if err := sink.Write(event); err != nil {
+			t.Fatalf("unexpected error writing event: %v", err)
+		}
+	}
+	checkClose(t, sink)
+
+	if header.Get(DeliveryIDHeader) == "" {
+		t.Fatal("missing delivery id")
+	}
+
+	// a captured request cannot be replayed
+	if err := verifier.Verify(header, body); !errors.Is(err, ErrReplayedDelivery) {
+		t.Fatalf("expected replayed delivery, got %v", err)
+	}
+
+	if err := VerifySignature([]byte(secret), header, body, 0); err != nil {
+		t.Fatalf("unexpected error verifying signature: %v", err)
+	}
+	if err := VerifySignature([]byte("another secret"), header, body, 0); err != ErrInvalidSignature {
+		t.Fatalf("expected invalid signature with another secret, got %v", err)
+	}
+	if err := VerifySignature([]byte(secret), header, append(body, ' '), 0); err != ErrInvalidSignature {
+		t.Fatalf("expected invalid signature of a modified body, got %v", err)
+	}
+
+	expired := header.Clone()
+	setSignature(expired, []byte(secret), "expired", time.Now().Add(-time.Hour), body)
+	if err := VerifySignature([]byte(secret), expired, body, 0); err != ErrSignatureExpired {
+		t.Fatalf("expected expired signature, got %v", err)
+	}
+
+	// a captured request cannot be replayed under another delivery id
+	replayed := header.Clone()
+	replayed.Set(DeliveryIDHeader, "another delivery")
+	if err := verifier.Verify(replayed, body); err != ErrInvalidSignature {
+		t.Fatalf("expected invalid signature with another delivery id, got %v", err)
+	}
+
+	// the timestamp is signed
+	tampered := header.Clone()
+	tampered.Set(TimestampHeader, strconv.FormatInt(time.Now().Unix()+1, 10))
+	if err := VerifySignature([]byte(secret), tampered, body, 0); err != ErrInvalidSignature {
+		t.Fatalf("expected invalid signature with another timestamp, got %v", err)
+	}
+}
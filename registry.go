@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
 )
 
 // Scope defines the set of items that match a namespace.
@@ -59,6 +60,12 @@ type RepositoryRemover interface {
 	Remove(ctx context.Context, name reference.Named) error
 }
 
+// ReferrersEnumerator describes an operation to enumerate the manifests of a
+// repository which declare a given manifest as their subject
+type ReferrersEnumerator interface {
+	EnumerateReferrers(ctx context.Context, name reference.Named, subject digest.Digest, ingester func(Descriptor) error) error
+}
+
 // ManifestServiceOption is a function argument for Manifest Service methods
 type ManifestServiceOption interface {
 	Apply(ManifestService) error
@@ -224,6 +224,31 @@ var (
 		the maximum allowed.`,
 		HTTPStatusCode: http.StatusBadRequest,
 	})
+
+	// ErrorCodeTagImmutable is returned when a manifest is pushed with an
+	// existing tag which may not be moved to another manifest, or when such a
+	// tag, its manifest or its repository is deleted.
+	ErrorCodeTagImmutable = register(errGroup, ErrorDescriptor{
+		Value:   "TAG_IMMUTABLE",
+		Message: "tag is immutable",
+		Description: `During a manifest upload, if the tag already refers to
+		another manifest and the registry does not allow the tag to be
+		overwritten, this error will be returned. It is also returned when
+		deleting such a tag, the manifest it refers to or the repository
+		holding it.`,
+		HTTPStatusCode: http.StatusConflict,
+	})
+
+	// ErrorCodeQuotaExceeded is returned when storing a blob or manifest
+	// would exceed the quota of the namespace of the repository.
+	ErrorCodeQuotaExceeded = register(errGroup, ErrorDescriptor{
+		Value:   "QUOTA_EXCEEDED",
+		Message: "quota exceeded",
+		Description: `During a blob upload or a manifest upload, if the
+		size or the number of manifests of the repositories of the namespace
+		would exceed its quota, this error will be returned.`,
+		HTTPStatusCode: http.StatusForbidden,
+	})
 )
 
 var (
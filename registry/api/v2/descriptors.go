@@ -98,6 +98,20 @@ var (
 		Format:      "<digest>",
 	}
 
+	subjectHeader = ParameterDescriptor{
+		Name:        "OCI-Subject",
+		Type:        "digest",
+		Description: "Digest of the subject of the manifest. Only set when the manifest declares a subject, acknowledging that the referrer has been recorded.",
+		Format:      "<digest>",
+	}
+
+	filtersAppliedHeader = ParameterDescriptor{
+		Name:        "OCI-Filters-Applied",
+		Type:        "string",
+		Description: "Comma separated list of the filters which were applied to the result.",
+		Format:      "artifactType",
+	}
+
 	linkHeader = ParameterDescriptor{
 		Name:        "Link",
 		Type:        "link",
@@ -219,6 +233,27 @@ var (
 			errcode.ErrorCodeTooManyRequests,
 		},
 	}
+
+	quotaExceededResponseDescriptor = ResponseDescriptor{
+		Name:        "Quota Exceeded",
+		StatusCode:  http.StatusForbidden,
+		Description: "Storing the content would exceed the quota of the namespace of the repository.",
+		Headers: []ParameterDescriptor{
+			{
+				Name:        "Content-Length",
+				Type:        "integer",
+				Description: "Length of the JSON response body.",
+				Format:      "<length>",
+			},
+		},
+		Body: BodyDescriptor{
+			ContentType: "application/json",
+			Format:      errorsBody,
+		},
+		ErrorCodes: []errcode.ErrorCode{
+			errcode.ErrorCodeQuotaExceeded,
+		},
+	}
 )
 
 const (
@@ -606,6 +641,7 @@ var routeDescriptors = []RouteDescriptor{
 									},
 									contentLengthZeroHeader,
 									digestHeader,
+									subjectHeader,
 								},
 							},
 						},
@@ -660,6 +696,19 @@ var routeDescriptors = []RouteDescriptor{
 									errcode.ErrorCodeUnsupported,
 								},
 							},
+							{
+								Name:        "Immutable Tag",
+								Description: "The tag already refers to another manifest and may not be overwritten.",
+								StatusCode:  http.StatusConflict,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeTagImmutable,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							quotaExceededResponseDescriptor,
 						},
 					},
 				},
@@ -713,6 +762,18 @@ var routeDescriptors = []RouteDescriptor{
 									Format:      errorsBody,
 								},
 							},
+							{
+								Name:        "Immutable Tag",
+								Description: "The tag, or a tag referring to the manifest, may not be overwritten and therefore may not be deleted.",
+								StatusCode:  http.StatusConflict,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeTagImmutable,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
 							{
 								Name:        "Not allowed",
 								Description: "Manifest or tag delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled.",
@@ -728,6 +789,83 @@ var routeDescriptors = []RouteDescriptor{
 		},
 	},
 
+	{
+		Name:        RouteNameReferrers,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/referrers/{digest:" + digest.DigestRegexp.String() + "}",
+		Entity:      "Referrers",
+		Description: "Retrieve the manifests which refer to a manifest through their `subject` field.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      http.MethodGet,
+				Description: "Fetch an image index listing the referrers of the manifest identified by `name` and `digest`. The manifest identified by `digest` does not need to exist.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							digestPathParameter,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "artifactType",
+								Type:        "string",
+								Format:      "<media type>",
+								Required:    false,
+								Description: "Only return referrers with the given artifact type.",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "An image index whose manifests are descriptors of the referrers.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									filtersAppliedHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/vnd.oci.image.index.v1+json",
+									Format: `{
+   "schemaVersion": 2,
+   "mediaType": "application/vnd.oci.image.index.v1+json",
+   "manifests": [
+      {
+         "mediaType": "<media type of referrer>",
+         "digest": "<digest>",
+         "size": <size>,
+         "artifactType": "<artifact type>"
+      },
+      ...
+   ]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The name or digest was invalid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeNameInvalid,
+									errcode.ErrorCodeDigestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+
 	{
 		Name:        RouteNameBlob,
 		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/{digest:" + digest.DigestRegexp.String() + "}",
@@ -1147,6 +1285,7 @@ var routeDescriptors = []RouteDescriptor{
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
+							quotaExceededResponseDescriptor,
 							tooManyRequestsDescriptor,
 						},
 					},
@@ -1472,6 +1611,7 @@ var routeDescriptors = []RouteDescriptor{
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
+							quotaExceededResponseDescriptor,
 							tooManyRequestsDescriptor,
 						},
 					},
@@ -1609,4 +1749,83 @@ var routeDescriptors = []RouteDescriptor{
 			},
 		},
 	},
+	{
+		// This route must remain last, as its name pattern would otherwise
+		// shadow the blob upload route.
+		Name:        RouteNameRepository,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/",
+		Entity:      "Repository",
+		Description: "Delete repositories.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      http.MethodDelete,
+				Description: "Delete the repository identified by `name`, along with all of its manifests, tags and blob links. The blobs themselves are left to be reclaimed by garbage collection.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode: http.StatusAccepted,
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Name",
+								Description: "The specified `name` was invalid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Unknown Repository",
+								Description: "The repository is not known to the registry.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Immutable Tag",
+								Description: "The repository holds a tag which may not be overwritten and therefore may not be deleted.",
+								StatusCode:  http.StatusConflict,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeTagImmutable,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Not allowed",
+								Description: "Repository delete is not allowed because the registry is configured as a pull-through cache, is in read-only mode or `delete` has been disabled.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
 }
@@ -23,9 +23,11 @@ import (
 	"github.com/distribution/distribution/v3/configuration"
 	"github.com/distribution/distribution/v3/manifest"
 	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
 	"github.com/distribution/distribution/v3/manifest/schema2"
 	"github.com/distribution/distribution/v3/registry/api/errcode"
 	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+	_ "github.com/distribution/distribution/v3/registry/middleware/repository/immutabletags"
 	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
 	_ "github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
@@ -33,6 +35,7 @@ import (
 	"github.com/distribution/reference"
 	"github.com/gorilla/handlers"
 	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 var headerConfig = http.Header{
@@ -1245,6 +1248,240 @@ func TestDeleteReadOnly(t *testing.T) {
 	checkResponse(t, "deleting layer in read-only mode", resp, http.StatusMethodNotAllowed)
 }
 
+func TestRepositoryAPI_Delete(t *testing.T) {
+	env := newTestEnv(t, true)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/deleteme")
+	createRepository(env, t, imageName.Name(), "latest")
+
+	repositoryURL, err := env.builder.BuildRepositoryURL(imageName)
+	if err != nil {
+		t.Fatalf("unexpected error building repository url: %v", err)
+	}
+
+	env.app.readOnly = true
+
+	resp, err := httpDelete(repositoryURL)
+	if err != nil {
+		t.Fatalf("unexpected error deleting repository: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "deleting repository in read-only mode", resp, http.StatusMethodNotAllowed)
+
+	env.app.readOnly = false
+
+	resp, err = httpDelete(repositoryURL)
+	if err != nil {
+		t.Fatalf("unexpected error deleting repository: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "deleting repository", resp, http.StatusAccepted)
+
+	tagsURL, err := env.builder.BuildTagsURL(imageName)
+	if err != nil {
+		t.Fatalf("unexpected error building tags url: %v", err)
+	}
+
+	resp, err = http.Get(tagsURL)
+	if err != nil {
+		t.Fatalf("unexpected error listing tags: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "listing tags of deleted repository", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "listing tags of deleted repository", resp, errcode.ErrorCodeNameUnknown)
+
+	resp, err = httpDelete(repositoryURL)
+	if err != nil {
+		t.Fatalf("unexpected error deleting repository: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "deleting unknown repository", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "deleting unknown repository", resp, errcode.ErrorCodeNameUnknown)
+}
+
+func TestRepositoryAPI_DeleteDisabled(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/keepme")
+	createRepository(env, t, imageName.Name(), "latest")
+
+	repositoryURL, err := env.builder.BuildRepositoryURL(imageName)
+	if err != nil {
+		t.Fatalf("unexpected error building repository url: %v", err)
+	}
+
+	resp, err := httpDelete(repositoryURL)
+	if err != nil {
+		t.Fatalf("unexpected error deleting repository: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "deleting repository with delete disabled", resp, http.StatusMethodNotAllowed)
+	checkBodyHasErrorCodes(t, "deleting repository with delete disabled", resp, errcode.ErrorCodeUnsupported)
+}
+
+func TestManifestAPI_ImmutableTags(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"delete":   configuration.Parameters{"enabled": true},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+		Middleware: map[string][]configuration.Middleware{
+			"repository": {
+				{
+					Name: "immutabletags",
+					Options: configuration.Parameters{
+						"repositories": []interface{}{"^release/"},
+						"tags":         []interface{}{`^v\d+`},
+					},
+				},
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("release/app")
+	createRepository(env, t, imageName.Name(), "v1")
+	dgst := createRepository(env, t, imageName.Name(), "latest")
+
+	// mutable tags may be overwritten
+	createRepository(env, t, imageName.Name(), "latest")
+	createRepository(env, t, "dev/app", "v1")
+	createRepository(env, t, "dev/app", "v1")
+
+	digestRef, _ := reference.WithDigest(imageName, dgst)
+	manifestDigestURL, err := env.builder.BuildManifestURL(digestRef)
+	checkErr(t, err, "building manifest url")
+
+	resp, err := http.Get(manifestDigestURL)
+	checkErr(t, err, "fetching manifest")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest", resp, http.StatusOK)
+
+	var fetched schema2.DeserializedManifest
+	if err := json.NewDecoder(resp.Body).Decode(&fetched); err != nil {
+		t.Fatalf("error decoding fetched manifest: %v", err)
+	}
+
+	tagRef, _ := reference.WithTag(imageName, "v1")
+	manifestTagURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+
+	resp = putManifest(t, "overwriting immutable tag", manifestTagURL, schema2.MediaTypeManifest, &fetched)
+	defer resp.Body.Close()
+	checkResponse(t, "overwriting immutable tag", resp, http.StatusConflict)
+	checkBodyHasErrorCodes(t, "overwriting immutable tag", resp, errcode.ErrorCodeTagImmutable)
+
+	// the tag could be pushed again with another manifest once deleted
+	resp, err = httpDelete(manifestTagURL)
+	checkErr(t, err, "deleting immutable tag")
+	defer resp.Body.Close()
+	checkResponse(t, "deleting immutable tag", resp, http.StatusConflict)
+	checkBodyHasErrorCodes(t, "deleting immutable tag", resp, errcode.ErrorCodeTagImmutable)
+
+	repositoryURL, err := env.builder.BuildRepositoryURL(imageName)
+	checkErr(t, err, "building repository url")
+	resp, err = httpDelete(repositoryURL)
+	checkErr(t, err, "deleting repository")
+	defer resp.Body.Close()
+	checkResponse(t, "deleting repository", resp, http.StatusConflict)
+	checkBodyHasErrorCodes(t, "deleting repository", resp, errcode.ErrorCodeTagImmutable)
+
+	// mutable tags may be deleted
+	latestRef, _ := reference.WithTag(imageName, "latest")
+	latestURL, err := env.builder.BuildManifestURL(latestRef)
+	checkErr(t, err, "building manifest url")
+	resp, err = httpDelete(latestURL)
+	checkErr(t, err, "deleting mutable tag")
+	defer resp.Body.Close()
+	checkResponse(t, "deleting mutable tag", resp, http.StatusAccepted)
+}
+
+func TestAPI_Quotas(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"delete":   configuration.Parameters{"enabled": true},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.Policy.Quotas = []configuration.Quota{
+		{Namespace: "quota", MaxManifests: 1},
+		{Namespace: "small", MaxBytes: 16},
+	}
+	config.HTTP.Headers = headerConfig
+
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	// blobs larger than the byte quota are rejected on completion
+	smallName, _ := reference.WithName("small/app")
+	contents := []byte("more than sixteen bytes")
+	dgst := digest.FromBytes(contents)
+	uploadURLBase, _ := startPushLayer(t, env, smallName)
+	resp, err := doPushLayer(t, env.builder, smallName, dgst, uploadURLBase, bytes.NewReader(contents))
+	checkErr(t, err, "pushing layer")
+	defer resp.Body.Close()
+	checkResponse(t, "pushing layer exceeding quota", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "pushing layer exceeding quota", resp, errcode.ErrorCodeQuotaExceeded)
+
+	imageName, _ := reference.WithName("quota/app")
+	dgst = createRepository(env, t, imageName.Name(), "latest")
+
+	digestRef, _ := reference.WithDigest(imageName, dgst)
+	manifestDigestURL, err := env.builder.BuildManifestURL(digestRef)
+	checkErr(t, err, "building manifest url")
+
+	resp, err = http.Get(manifestDigestURL)
+	checkErr(t, err, "fetching manifest")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest", resp, http.StatusOK)
+
+	var fetched schema2.DeserializedManifest
+	if err := json.NewDecoder(resp.Body).Decode(&fetched); err != nil {
+		t.Fatalf("error decoding fetched manifest: %v", err)
+	}
+
+	// tagging a manifest which is already stored does not count again
+	tagRef, _ := reference.WithTag(imageName, "stable")
+	manifestTagURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+	resp = putManifest(t, "tagging stored manifest", manifestTagURL, schema2.MediaTypeManifest, &fetched)
+	defer resp.Body.Close()
+	checkResponse(t, "tagging stored manifest", resp, http.StatusCreated)
+
+	otherName, _ := reference.WithName("quota/other")
+	tagRef, _ = reference.WithTag(otherName, "latest")
+	manifestTagURL, err = env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+	resp = putManifest(t, "pushing manifest exceeding quota", manifestTagURL, schema2.MediaTypeManifest, &fetched)
+	defer resp.Body.Close()
+	checkResponse(t, "pushing manifest exceeding quota", resp, http.StatusForbidden)
+	checkBodyHasErrorCodes(t, "pushing manifest exceeding quota", resp, errcode.ErrorCodeQuotaExceeded)
+
+	// deleting the manifest releases it from the quota
+	resp, err = httpDelete(manifestDigestURL)
+	checkErr(t, err, "deleting manifest")
+	defer resp.Body.Close()
+	checkResponse(t, "deleting manifest", resp, http.StatusAccepted)
+
+	createRepository(env, t, imageName.Name(), "latest")
+}
+
 func TestStartPushReadOnly(t *testing.T) {
 	env := newTestEnv(t, true)
 	defer env.Shutdown()
@@ -2208,6 +2445,192 @@ func testManifestDelete(t *testing.T, env *testEnv, args manifestArgs) {
 	}
 }
 
+func TestReferrersAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, err := reference.WithName("foo/referrers")
+	if err != nil {
+		t.Fatalf("unable to parse reference: %v", err)
+	}
+
+	subjectDigest := createRepository(env, t, imageName.Name(), "latest")
+	subject := distribution.Descriptor{
+		MediaType: schema2.MediaTypeManifest,
+		Digest:    subjectDigest,
+		Size:      1,
+	}
+
+	signatureType := "application/vnd.example.signature.v1+json"
+	sbomType := "application/vnd.example.sbom.v1+json"
+	signatureDigest, pushResp := pushReferrer(t, env, imageName, subject, signatureType)
+	checkHeaders(t, pushResp, http.Header{
+		"OCI-Subject": []string{subjectDigest.String()},
+	})
+	sbomDigest, _ := pushReferrer(t, env, imageName, subject, sbomType)
+
+	subjectRef, _ := reference.WithDigest(imageName, subjectDigest)
+
+	getReferrers := func(values ...url.Values) (*http.Response, ocischema.ImageIndex) {
+		referrersURL, err := env.builder.BuildReferrersURL(subjectRef, values...)
+		if err != nil {
+			t.Fatalf("unexpected error building referrers url: %v", err)
+		}
+
+		resp, err := http.Get(referrersURL)
+		if err != nil {
+			t.Fatalf("unexpected error getting referrers: %v", err)
+		}
+		defer resp.Body.Close()
+
+		checkResponse(t, "getting referrers", resp, http.StatusOK)
+		if resp.Header.Get("Content-Type") != v1.MediaTypeImageIndex {
+			t.Fatalf("unexpected content type: %q", resp.Header.Get("Content-Type"))
+		}
+
+		var index ocischema.ImageIndex
+		if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+			t.Fatalf("error decoding referrers response: %v", err)
+		}
+		return resp, index
+	}
+
+	resp, index := getReferrers()
+	if resp.Header.Get("OCI-Filters-Applied") != "" {
+		t.Fatalf("unexpected filters applied header: %q", resp.Header.Get("OCI-Filters-Applied"))
+	}
+	if index.MediaType != v1.MediaTypeImageIndex || index.SchemaVersion != 2 {
+		t.Fatalf("unexpected index version: %#v", index.Versioned)
+	}
+	if len(index.Manifests) != 2 {
+		t.Fatalf("expected 2 referrers, got %d", len(index.Manifests))
+	}
+	found := map[digest.Digest]string{}
+	for _, desc := range index.Manifests {
+		found[desc.Digest] = desc.ArtifactType
+	}
+	if found[signatureDigest] != signatureType || found[sbomDigest] != sbomType {
+		t.Fatalf("unexpected referrers: %v", found)
+	}
+
+	resp, index = getReferrers(url.Values{"artifactType": []string{sbomType}})
+	checkHeaders(t, resp, http.Header{
+		"OCI-Filters-Applied": []string{"artifactType"},
+	})
+	if len(index.Manifests) != 1 || index.Manifests[0].Digest != sbomDigest {
+		t.Fatalf("unexpected filtered referrers: %v", index.Manifests)
+	}
+
+	// a subject without referrers yields an empty index
+	unknownRef, _ := reference.WithDigest(imageName, digest.FromString("unknown"))
+	referrersURL, err := env.builder.BuildReferrersURL(unknownRef)
+	if err != nil {
+		t.Fatalf("unexpected error building referrers url: %v", err)
+	}
+	resp, err = http.Get(referrersURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting referrers: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "getting referrers of unknown subject", resp, http.StatusOK)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("error reading response body: %v", err)
+	}
+	if !bytes.Contains(body, []byte(`"manifests": []`)) {
+		t.Fatalf("expected empty manifests list, got %s", body)
+	}
+}
+
+func TestManifestAPI_InvalidSubject(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, err := reference.WithName("foo/subject")
+	if err != nil {
+		t.Fatalf("unable to parse reference: %v", err)
+	}
+
+	emptyConfig := []byte("{}")
+	emptyConfigDigest := digest.FromBytes(emptyConfig)
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	pushLayer(t, env.builder, imageName, emptyConfigDigest, uploadURLBase, bytes.NewReader(emptyConfig))
+
+	for _, subject := range []distribution.Descriptor{
+		{MediaType: v1.MediaTypeImageManifest, Size: 10},
+		{MediaType: v1.MediaTypeImageLayer, Digest: digest.FromString("layer"), Size: 10},
+		{MediaType: v1.MediaTypeImageManifest, Digest: digest.FromString("empty")},
+	} {
+		subject := subject
+		artifact := &ocischema.Manifest{
+			Versioned: ocischema.SchemaVersion,
+			Config: distribution.Descriptor{
+				MediaType: "application/vnd.oci.empty.v1+json",
+				Digest:    emptyConfigDigest,
+				Size:      int64(len(emptyConfig)),
+			},
+			Layers:  []distribution.Descriptor{},
+			Subject: &subject,
+		}
+
+		tagRef, _ := reference.WithTag(imageName, "invalid")
+		manifestURL, err := env.builder.BuildManifestURL(tagRef)
+		checkErr(t, err, "building manifest url")
+
+		resp := putManifest(t, "putting manifest with invalid subject", manifestURL, v1.MediaTypeImageManifest, artifact)
+		defer resp.Body.Close()
+		checkResponse(t, "putting manifest with invalid subject", resp, http.StatusBadRequest)
+		_, p, counts := checkBodyHasErrorCodes(t, "putting manifest with invalid subject", resp, errcode.ErrorCodeManifestInvalid)
+		if counts[errcode.ErrorCodeManifestInvalid] != 1 {
+			t.Fatalf("expected one MANIFEST_INVALID error for subject %v: %s", subject, p)
+		}
+	}
+}
+
+// pushReferrer pushes an OCI artifact manifest of the given artifact type,
+// declaring subject as its subject, and returns its digest along with the
+// response to the push.
+func pushReferrer(t *testing.T, env *testEnv, imageName reference.Named, subject distribution.Descriptor, artifactType string) (digest.Digest, *http.Response) {
+	emptyConfig := []byte("{}")
+	emptyConfigDigest := digest.FromBytes(emptyConfig)
+
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	pushLayer(t, env.builder, imageName, emptyConfigDigest, uploadURLBase, bytes.NewReader(emptyConfig))
+
+	artifact := &ocischema.Manifest{
+		Versioned:    ocischema.SchemaVersion,
+		ArtifactType: artifactType,
+		Config: distribution.Descriptor{
+			MediaType: "application/vnd.oci.empty.v1+json",
+			Digest:    emptyConfigDigest,
+			Size:      int64(len(emptyConfig)),
+		},
+		Layers:  []distribution.Descriptor{},
+		Subject: &subject,
+	}
+
+	deserialized, err := ocischema.FromStruct(*artifact)
+	if err != nil {
+		t.Fatalf("could not create DeserializedManifest: %v", err)
+	}
+	_, canonical, err := deserialized.Payload()
+	if err != nil {
+		t.Fatalf("could not get manifest payload: %v", err)
+	}
+	dgst := digest.FromBytes(canonical)
+
+	digestRef, _ := reference.WithDigest(imageName, dgst)
+	manifestDigestURL, err := env.builder.BuildManifestURL(digestRef)
+	checkErr(t, err, "building manifest url")
+
+	resp := putManifest(t, "putting referrer", manifestDigestURL, v1.MediaTypeImageManifest, artifact)
+	defer resp.Body.Close()
+	checkResponse(t, "putting referrer", resp, http.StatusCreated)
+
+	return dgst, resp
+}
+
 type testEnv struct {
 	ctx     context.Context
 	config  configuration.Configuration
@@ -2863,3 +3286,124 @@ func TestProxyManifestGetByTag(t *testing.T) {
 		"Docker-Content-Digest": []string{newDigest.String()},
 	})
 }
+
+func TestProxyManifestGetStale(t *testing.T) {
+	truthConfig := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	truthConfig.HTTP.Headers = headerConfig
+
+	imageName, _ := reference.WithName("foo/bar")
+
+	truthEnv := newTestEnvWithConfig(t, &truthConfig)
+	defer truthEnv.Shutdown()
+	dgst := createRepository(truthEnv, t, imageName.Name(), "latest")
+
+	proxyConfig := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+		Proxy: configuration.Proxy{
+			RemoteURL: truthEnv.server.URL,
+		},
+	}
+	proxyConfig.HTTP.Headers = headerConfig
+
+	proxyEnv := newTestEnvWithConfig(t, &proxyConfig)
+	defer proxyEnv.Shutdown()
+
+	tagRef, _ := reference.WithTag(imageName, "latest")
+	manifestTagURL, err := proxyEnv.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+
+	resp, err := http.Get(manifestTagURL)
+	checkErr(t, err, "fetching manifest from proxy by tag")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest from proxy by tag", resp, http.StatusOK)
+	if warning := resp.Header.Get("Warning"); warning != "" {
+		t.Fatalf("unexpected warning fetching fresh manifest: %q", warning)
+	}
+
+	// the cached manifest is served while the remote is unreachable
+	truthEnv.Shutdown()
+
+	resp, err = http.Get(manifestTagURL)
+	checkErr(t, err, "fetching stale manifest from proxy by tag")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching stale manifest from proxy by tag", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Docker-Content-Digest": []string{dgst.String()},
+		"Warning":               []string{`110 - "Response is Stale"`},
+	})
+}
+
+func TestProxyRemotes(t *testing.T) {
+	truthConfig := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	truthConfig.HTTP.Headers = headerConfig
+
+	ghcrEnv := newTestEnvWithConfig(t, &truthConfig)
+	defer ghcrEnv.Shutdown()
+	quayEnv := newTestEnvWithConfig(t, &truthConfig)
+	defer quayEnv.Shutdown()
+
+	ghcrDigest := createRepository(ghcrEnv, t, "foo/bar", "latest")
+	quayDigest := createRepository(quayEnv, t, "foo/bar", "latest")
+
+	proxyConfig := configuration.Configuration{
+		Storage: configuration.Storage{
+			"inmemory": configuration.Parameters{},
+		},
+		Proxy: configuration.Proxy{
+			Remotes: []configuration.ProxyRemote{
+				{Prefix: "ghcr/", RemoteURL: ghcrEnv.server.URL},
+				{Prefix: "quay", RemoteURL: quayEnv.server.URL},
+			},
+		},
+	}
+	proxyConfig.HTTP.Headers = headerConfig
+
+	proxyEnv := newTestEnvWithConfig(t, &proxyConfig)
+	defer proxyEnv.Shutdown()
+
+	for name, dgst := range map[string]digest.Digest{
+		"ghcr/foo/bar": ghcrDigest,
+		"quay/foo/bar": quayDigest,
+	} {
+		imageName, _ := reference.WithName(name)
+		tagRef, _ := reference.WithTag(imageName, "latest")
+		manifestTagURL, err := proxyEnv.builder.BuildManifestURL(tagRef)
+		checkErr(t, err, "building manifest url")
+
+		resp, err := http.Get(manifestTagURL)
+		checkErr(t, err, "fetching manifest from proxy by tag")
+		defer resp.Body.Close()
+		checkResponse(t, "fetching manifest from proxy by tag", resp, http.StatusOK)
+		checkHeaders(t, resp, http.Header{
+			"Docker-Content-Digest": []string{dgst.String()},
+		})
+	}
+
+	// repositories served by no remote are unknown
+	imageName, _ := reference.WithName("foo/bar")
+	tagRef, _ := reference.WithTag(imageName, "latest")
+	manifestTagURL, err := proxyEnv.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+
+	resp, err := http.Get(manifestTagURL)
+	checkErr(t, err, "fetching manifest from proxy by tag")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest of unknown remote", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching manifest of unknown remote", resp, errcode.ErrorCodeNameUnknown)
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"expvar"
 	"fmt"
+	"io"
 	"math"
 	"math/big"
 	"net"
@@ -30,11 +31,13 @@ import (
 	registrymiddleware "github.com/distribution/distribution/v3/registry/middleware/registry"
 	repositorymiddleware "github.com/distribution/distribution/v3/registry/middleware/repository"
 	"github.com/distribution/distribution/v3/registry/proxy"
+	"github.com/distribution/distribution/v3/registry/proxy/scheduler"
 	"github.com/distribution/distribution/v3/registry/storage"
 	memorycache "github.com/distribution/distribution/v3/registry/storage/cache/memory"
 	rediscache "github.com/distribution/distribution/v3/registry/storage/cache/redis"
 	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+	"github.com/distribution/distribution/v3/registry/storage/driver/filesystem"
 	storagemiddleware "github.com/distribution/distribution/v3/registry/storage/driver/middleware"
 	"github.com/distribution/distribution/v3/version"
 	"github.com/distribution/reference"
@@ -61,11 +64,13 @@ type App struct {
 
 	Config *configuration.Configuration
 
-	router           *mux.Router                    // main application router, configured with dispatchers
-	driver           storagedriver.StorageDriver    // driver maintains the app global storage driver instance.
-	registry         distribution.Namespace         // registry is the primary registry backend for the app instance.
-	repoRemover      distribution.RepositoryRemover // repoRemover provides ability to delete repos
-	accessController auth.AccessController          // main access controller for application
+	router           *mux.Router                      // main application router, configured with dispatchers
+	driver           storagedriver.StorageDriver      // driver maintains the app global storage driver instance.
+	registry         distribution.Namespace           // registry is the primary registry backend for the app instance.
+	repoRemover      distribution.RepositoryRemover   // repoRemover provides ability to delete repos
+	referrers        distribution.ReferrersEnumerator // referrers provides the referrers of manifests
+	quotas           *storage.QuotaTracker            // quotas accounts the usage of namespace quotas, if any are configured
+	accessController auth.AccessController            // main access controller for application
 
 	// httpHost is a parsed representation of the http.host parameter from
 	// the configuration. Only the Scheme and Host fields are used.
@@ -94,7 +99,7 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		Config:  config,
 		Context: ctx,
 		router:  v2.RouterWithPrefix(config.HTTP.Prefix),
-		isCache: config.Proxy.RemoteURL != "",
+		isCache: config.Proxy.Enabled(),
 	}
 
 	// Register the handler dispatchers.
@@ -102,11 +107,13 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		return http.HandlerFunc(apiBase)
 	})
 	app.register(v2.RouteNameManifest, manifestDispatcher)
+	app.register(v2.RouteNameReferrers, referrersDispatcher)
 	app.register(v2.RouteNameCatalog, catalogDispatcher)
 	app.register(v2.RouteNameTags, tagsDispatcher)
 	app.register(v2.RouteNameBlob, blobDispatcher)
 	app.register(v2.RouteNameBlobUpload, blobUploadDispatcher)
 	app.register(v2.RouteNameBlobUploadChunk, blobUploadDispatcher)
+	app.register(v2.RouteNameRepository, repositoryDispatcher)
 
 	// override the storage driver's UA string for registry outbound HTTP requests
 	storageParams := config.Storage.Parameters()
@@ -127,6 +134,7 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 	}
 
 	purgeConfig := uploadPurgeDefaultConfig()
+	gcConfig := garbageCollectDefaultConfig()
 	if mc, ok := config.Storage["maintenance"]; ok {
 		if v, ok := mc["uploadpurging"]; ok {
 			purgeConfig, ok = v.(map[interface{}]interface{})
@@ -134,6 +142,15 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 				panic("uploadpurging config key must contain additional keys")
 			}
 		}
+		if v, ok := mc["garbagecollect"]; ok {
+			gc, ok := v.(map[interface{}]interface{})
+			if !ok {
+				panic("garbagecollect config key must contain additional keys")
+			}
+			for k, v := range gc {
+				gcConfig[k] = v
+			}
+		}
 		if v, ok := mc["readonly"]; ok {
 			readOnly, ok := v.(map[interface{}]interface{})
 			if !ok {
@@ -148,7 +165,9 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		}
 	}
 
-	startUploadPurger(app, app.driver, dcontext.GetLogger(app), purgeConfig)
+	// uploads are purged from the storage itself, rather than through the
+	// storage middleware
+	purgeDriver := app.driver
 
 	app.driver, err = applyStorageMiddleware(app, app.driver, config.Middleware["storage"])
 	if err != nil {
@@ -170,6 +189,9 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		app.httpHost = *u
 	}
 
+	// the purger is started once events are configured, to notify them
+	startUploadPurger(app, purgeDriver, dcontext.GetLogger(app), purgeConfig, app.systemListener())
+
 	if app.isCache {
 		options = append(options, storage.DisableDigestResumption)
 	}
@@ -294,6 +316,22 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		}
 	}
 
+	if !config.Proxy.Enabled() {
+		app.quotas = NewQuotaTracker(app.driver, config.Policy.Quotas)
+		startGarbageCollector(app, app.driver, app.registry, dcontext.GetLogger(app), gcConfig, app.systemListener(), app.quotas)
+		startRetentionEnforcer(app, app.driver, app.backgroundNamespace(app.registry), dcontext.GetLogger(app), config.Policy.Retention)
+	} else {
+		if gcConfig["enabled"] == true {
+			dcontext.GetLogger(app).Warnf("garbage collection is not supported by a proxy cache, not starting it")
+		}
+		if config.Policy.Retention.Enabled {
+			dcontext.GetLogger(app).Warnf("retention policies are not supported by a proxy cache, not enforcing them")
+		}
+		if len(config.Policy.Quotas) > 0 {
+			dcontext.GetLogger(app).Warnf("quotas are not supported by a proxy cache, not enforcing them")
+		}
+	}
+
 	app.registry, err = applyRegistryMiddleware(app, app.registry, app.driver, config.Middleware["registry"])
 	if err != nil {
 		panic(err)
@@ -311,19 +349,42 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 	}
 
 	// configure as a pull through cache
-	if config.Proxy.RemoteURL != "" {
-		app.registry, err = proxy.NewRegistryPullThroughCache(ctx, app.registry, app.driver, config.Proxy)
+	if config.Proxy.Enabled() {
+		// expired content is deleted with events attributed to the system
+		proxyOptions := []proxy.Option{proxy.WithExpiryRegistry(app.backgroundNamespace(app.registry))}
+		switch config.Proxy.Scheduler.Backend {
+		case "", "storage":
+		case "redis":
+			if app.redis == nil {
+				panic("redis configuration required to use for proxy scheduler")
+			}
+			proxyOptions = append(proxyOptions, proxy.WithScheduler(scheduler.NewRedis(ctx, app.redis, config.Proxy.Scheduler.Lease)))
+			dcontext.GetLogger(app).Infof("using redis proxy scheduler")
+		default:
+			panic(fmt.Sprintf("unknown proxy scheduler backend: %q", config.Proxy.Scheduler.Backend))
+		}
+
+		app.registry, err = proxy.NewRegistryPullThroughCache(ctx, app.registry, app.driver, config.Proxy, proxyOptions...)
 		if err != nil {
 			panic(err.Error())
 		}
 		app.isCache = true
-		dcontext.GetLogger(app).Info("Registry configured as a proxy cache to ", config.Proxy.RemoteURL)
+		for _, remote := range config.Proxy.Remotes {
+			dcontext.GetLogger(app).Infof("Registry configured as a proxy cache of %s to %s", remote.Prefix, remote.RemoteURL)
+		}
+		if config.Proxy.RemoteURL != "" {
+			dcontext.GetLogger(app).Info("Registry configured as a proxy cache to ", config.Proxy.RemoteURL)
+		}
 	}
 	var ok bool
 	app.repoRemover, ok = app.registry.(distribution.RepositoryRemover)
 	if !ok {
 		dcontext.GetLogger(app).Warnf("Registry does not implement RepositoryRemover. Will not be able to delete repos and tags")
 	}
+	app.referrers, ok = app.registry.(distribution.ReferrersEnumerator)
+	if !ok {
+		dcontext.GetLogger(app).Warnf("Registry does not implement ReferrersEnumerator. Will not be able to serve referrers")
+	}
 
 	return app
 }
@@ -436,6 +497,17 @@ func (app *App) register(routeName string, dispatch dispatchFunc) {
 
 // configureEvents prepares the event sink for action.
 func (app *App) configureEvents(configuration *configuration.Configuration) {
+	sink, err := newEventSink(app, configuration.Notifications.Endpoints, app.driver)
+	if err != nil {
+		panic(err.Error())
+	}
+	app.events.sink = sink
+	app.events.source = newEventSource(app, configuration)
+}
+
+// newEventSink returns a sink broadcasting events to the enabled notification
+// endpoints.
+func newEventSink(ctx context.Context, endpoints []configuration.Endpoint, driver storagedriver.StorageDriver) (events.Sink, error) {
 	// Configure all of the endpoint sinks.
 	// NOTE(milosgajdos): we are disabling the linter here as
 	// if an endpoint is disabled we continue with the evaluation
@@ -443,21 +515,54 @@ func (app *App) configureEvents(configuration *configuration.Configuration) {
 	// should have at the time the iteration starts
 	// nolint:prealloc
 	var sinks []events.Sink
-	for _, endpoint := range configuration.Notifications.Endpoints {
+	for _, endpoint := range endpoints {
 		if endpoint.Disabled {
-			dcontext.GetLogger(app).Infof("endpoint %s disabled, skipping", endpoint.Name)
+			dcontext.GetLogger(ctx).Infof("endpoint %s disabled, skipping", endpoint.Name)
 			continue
 		}
 
-		dcontext.GetLogger(app).Infof("configuring endpoint %v (%v), timeout=%s, headers=%v", endpoint.Name, endpoint.URL, endpoint.Timeout, endpoint.Headers)
-		endpoint := notifications.NewEndpoint(endpoint.Name, endpoint.URL, notifications.EndpointConfig{
+		if endpoint.Type == notifications.EndpointTypeFile {
+			dcontext.GetLogger(ctx).Infof("configuring endpoint %v (file %v)", endpoint.Name, endpoint.File.Path)
+		} else {
+			dcontext.GetLogger(ctx).Infof("configuring endpoint %v (%v), timeout=%s, headers=%v", endpoint.Name, endpoint.URL, endpoint.Timeout, endpoint.Headers)
+		}
+
+		var queueDriver storagedriver.StorageDriver
+		switch {
+		case endpoint.Queue.Directory != "" && endpoint.Queue.StoragePath != "":
+			return nil, fmt.Errorf("queue of endpoint %s: only one of directory and storagepath may be set", endpoint.Name)
+		case endpoint.Queue.Directory != "":
+			var err error
+			queueDriver, err = filesystem.FromParameters(map[string]interface{}{
+				"rootdirectory": endpoint.Queue.Directory,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("queue of endpoint %s: %v", endpoint.Name, err)
+			}
+		case endpoint.Queue.StoragePath != "":
+			queueDriver = driver
+		}
+
+		endpointConfig := notifications.EndpointConfig{
+			Type:              endpoint.Type,
+			File:              endpoint.File,
+			Format:            endpoint.Format,
+			CloudEvents:       endpoint.CloudEvents,
 			Timeout:           endpoint.Timeout,
 			Threshold:         endpoint.Threshold,
 			Backoff:           endpoint.Backoff,
 			Headers:           endpoint.Headers,
+			Secret:            endpoint.Secret,
 			IgnoredMediaTypes: endpoint.IgnoredMediaTypes,
 			Ignore:            endpoint.Ignore,
-		})
+			Filters:           endpoint.Filters,
+			Queue:             endpoint.Queue,
+			QueueDriver:       queueDriver,
+		}
+		if err := endpointConfig.Validate(); err != nil {
+			return nil, fmt.Errorf("endpoint %s: %v", endpoint.Name, err)
+		}
+		endpoint := notifications.NewEndpoint(endpoint.Name, endpoint.URL, endpointConfig)
 
 		sinks = append(sinks, endpoint)
 	}
@@ -466,8 +571,11 @@ func (app *App) configureEvents(configuration *configuration.Configuration) {
 	// replacing broadcaster with a rabbitmq implementation. It's recommended
 	// that the registry instances also act as the workers to keep deployment
 	// simple.
-	app.events.sink = events.NewBroadcaster(sinks...)
+	return events.NewBroadcaster(sinks...), nil
+}
 
+// newEventSource returns the record of the registry node generating events.
+func newEventSource(ctx context.Context, configuration *configuration.Configuration) notifications.SourceRecord {
 	// Populate registry event source
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -480,19 +588,50 @@ func (app *App) configureEvents(configuration *configuration.Configuration) {
 		}
 	}
 
-	app.events.source = notifications.SourceRecord{
+	return notifications.SourceRecord{
 		Addr:       hostname,
-		InstanceID: dcontext.GetStringValue(app, "instance.id"),
+		InstanceID: dcontext.GetStringValue(ctx, "instance.id"),
 	}
 }
 
+// NewSystemListener returns a listener dispatching the events of operations
+// run outside of an App, such as the garbage-collect command, to the
+// notification endpoints of the configuration. The events are queued in
+// memory, as the persistent queues of the endpoints are delivered by the
+// running registry, and the returned sink must be closed to flush them.
+func NewSystemListener(ctx context.Context, config *configuration.Configuration, driver storagedriver.StorageDriver) (notifications.SystemListener, events.Sink, error) {
+	var host url.URL
+	if config.HTTP.Host != "" {
+		u, err := url.Parse(config.HTTP.Host)
+		if err != nil {
+			return nil, nil, fmt.Errorf(`could not parse http "host" parameter: %v`, err)
+		}
+		host = *u
+	}
+
+	endpoints := make([]configuration.Endpoint, 0, len(config.Notifications.Endpoints))
+	for _, endpoint := range config.Notifications.Endpoints {
+		endpoint.Queue = configuration.EndpointQueue{}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	sink, err := newEventSink(ctx, endpoints, driver)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ub := v2.NewURLBuilder(&host, config.HTTP.RelativeURLs)
+	listener := notifications.NewSystemBridge(ub, newEventSource(ctx, config), sink, config.Notifications.EventConfig.IncludeReferences)
+	return listener, sink, nil
+}
+
 func (app *App) configureRedis(cfg *configuration.Configuration) {
 	if cfg.Redis.Addr == "" {
 		dcontext.GetLogger(app).Infof("redis not configured")
 		return
 	}
 
-	app.redis = app.createPool(cfg.Redis)
+	app.redis = NewRedisClient(cfg.Redis)
 
 	// Enable metrics instrumentation.
 	if err := redisotel.InstrumentMetrics(app.redis); err != nil {
@@ -514,7 +653,9 @@ func (app *App) configureRedis(cfg *configuration.Configuration) {
 	}))
 }
 
-func (app *App) createPool(cfg configuration.Redis) *redis.Client {
+// NewRedisClient returns a client of the redis configured in cfg, as used by
+// the registry.
+func NewRedisClient(cfg configuration.Redis) *redis.Client {
 	return redis.NewClient(&redis.Options{
 		Addr: cfg.Addr,
 		OnConnect: func(ctx context.Context, cn *redis.Conn) error {
@@ -660,11 +801,11 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 					context.Errors = append(context.Errors, errcode.ErrorCodeNameInvalid.WithDetail(err))
 				case errcode.Error:
 					context.Errors = append(context.Errors, err)
+				default:
+					context.Errors = append(context.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 				}
 
-				if err := errcode.ServeJSON(w, context.Errors); err != nil {
-					dcontext.GetLogger(context).Errorf("error serving error json: %v (from %v)", err, context.Errors)
-				}
+				// the errors are served when the request completes
 				return
 			}
 
@@ -840,6 +981,46 @@ func (app *App) eventBridge(ctx *Context, r *http.Request) notifications.Listene
 	return notifications.NewBridge(ctx.urlBuilder, app.events.source, actor, request, app.events.sink, app.Config.Notifications.EventConfig.IncludeReferences)
 }
 
+// systemListener returns an event bridge for operations which are not
+// triggered by a request, attributing their events to the system actor.
+func (app *App) systemListener() notifications.SystemListener {
+	ub := v2.NewURLBuilder(&app.httpHost, app.Config.HTTP.RelativeURLs)
+	return notifications.NewSystemBridge(ub, app.events.source, app.events.sink, app.Config.Notifications.EventConfig.IncludeReferences)
+}
+
+// backgroundNamespace decorates the repositories of the registry with an
+// event bridge, for operations which are not triggered by a request.
+func (app *App) backgroundNamespace(registry distribution.Namespace) distribution.Namespace {
+	return &listenerNamespace{
+		Namespace: registry,
+		listener:  app.systemListener(),
+	}
+}
+
+// listenerNamespace is a namespace whose repositories dispatch events to the
+// listener.
+type listenerNamespace struct {
+	distribution.Namespace
+	listener notifications.Listener
+}
+
+func (ns *listenerNamespace) Repository(ctx context.Context, name reference.Named) (distribution.Repository, error) {
+	repository, err := ns.Namespace.Repository(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	repository, _ = notifications.Listen(repository, nil, ns.listener)
+	return repository, nil
+}
+
+func (ns *listenerNamespace) Enumerate(ctx context.Context, ingester func(string) error) error {
+	repositoryEnumerator, ok := ns.Namespace.(distribution.RepositoryEnumerator)
+	if !ok {
+		return fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+	return repositoryEnumerator.Enumerate(ctx, ingester)
+}
+
 // nameRequired returns true if the route requires a name.
 func (app *App) nameRequired(r *http.Request) bool {
 	route := mux.CurrentRoute(r)
@@ -968,8 +1149,9 @@ func badPurgeUploadConfig(reason string) {
 }
 
 // startUploadPurger schedules a goroutine which will periodically
-// check upload directories for old files and delete them
-func startUploadPurger(ctx context.Context, storageDriver storagedriver.StorageDriver, log dcontext.Logger, config map[interface{}]interface{}) {
+// check upload directories for old files and delete them, notifying
+// the listener of the deleted uploads
+func startUploadPurger(ctx context.Context, storageDriver storagedriver.StorageDriver, log dcontext.Logger, config map[interface{}]interface{}, listener storage.UploadPurgeListener) {
 	if config["enabled"] == false {
 		return
 	}
@@ -1029,9 +1211,227 @@ func startUploadPurger(ctx context.Context, storageDriver storagedriver.StorageD
 		time.Sleep(jitter)
 
 		for {
-			storage.PurgeUploads(ctx, storageDriver, time.Now().Add(-purgeAgeDuration), !dryRunBool)
+			storage.PurgeUploads(ctx, storageDriver, time.Now().Add(-purgeAgeDuration), !dryRunBool, listener)
 			log.Infof("Starting upload purge in %s", intervalDuration)
 			time.Sleep(intervalDuration)
 		}
 	}()
 }
+
+func garbageCollectDefaultConfig() map[interface{}]interface{} {
+	config := map[interface{}]interface{}{}
+	config["enabled"] = false
+	config["interval"] = "24h"
+	config["graceperiod"] = "1h"
+	config["removeuntagged"] = false
+	config["concurrency"] = 1
+	config["dryrun"] = false
+	return config
+}
+
+func badGarbageCollectConfig(reason string) {
+	panic(fmt.Sprintf("Unable to parse garbage collection configuration: %s", reason))
+}
+
+// startGarbageCollector schedules a goroutine which will periodically run an
+// online garbage collection of the registry, which does not require the
+// registry to be read-only, notifying the listener of the deleted content and
+// rebuilding the usage of the quotas, if any.
+func startGarbageCollector(ctx context.Context, storageDriver storagedriver.StorageDriver, registry distribution.Namespace, log dcontext.Logger, config map[interface{}]interface{}, listener storage.GCListener, quotas *storage.QuotaTracker) {
+	if config["enabled"] != true {
+		return
+	}
+
+	intervalStr, ok := config["interval"].(string)
+	if !ok {
+		badGarbageCollectConfig("interval is not a string")
+	}
+	intervalDuration, err := time.ParseDuration(intervalStr)
+	if err != nil {
+		badGarbageCollectConfig(fmt.Sprintf("Cannot parse interval: %s", err.Error()))
+	}
+
+	gracePeriodStr, ok := config["graceperiod"].(string)
+	if !ok {
+		badGarbageCollectConfig("graceperiod is not a string")
+	}
+	gracePeriodDuration, err := time.ParseDuration(gracePeriodStr)
+	if err != nil {
+		badGarbageCollectConfig(fmt.Sprintf("Cannot parse graceperiod: %s", err.Error()))
+	}
+	if gracePeriodDuration <= 0 {
+		badGarbageCollectConfig("graceperiod must be positive")
+	}
+
+	removeUntagged, ok := config["removeuntagged"].(bool)
+	if !ok {
+		badGarbageCollectConfig("cannot parse removeuntagged")
+	}
+
+	concurrency, err := strconv.Atoi(fmt.Sprint(config["concurrency"]))
+	if err != nil {
+		badGarbageCollectConfig(fmt.Sprintf("Cannot parse concurrency: %s", err.Error()))
+	}
+
+	dryRun, ok := config["dryrun"].(bool)
+	if !ok {
+		badGarbageCollectConfig("cannot parse dryrun")
+	}
+
+	opts := storage.GCOpts{
+		DryRun:         dryRun,
+		RemoveUntagged: removeUntagged,
+		GracePeriod:    gracePeriodDuration,
+		Concurrency:    concurrency,
+		Listener:       listener,
+		Quotas:         quotas,
+		Output:         io.Discard,
+	}
+
+	go func() {
+		randInt, err := rand.Int(rand.Reader, new(big.Int).SetInt64(math.MaxInt64))
+		if err != nil {
+			log.Infof("Failed to generate random jitter: %v", err)
+			// sleep 30min for failure case
+			randInt = big.NewInt(30)
+		}
+		jitter := time.Duration(randInt.Int64()%60) * time.Minute
+		log.Infof("Starting garbage collection in %s", jitter)
+		time.Sleep(jitter)
+
+		for {
+			if err := collectGarbage(ctx, storageDriver, registry, log, opts); err != nil {
+				log.Errorf("garbage collection failed: %v", err)
+			}
+			log.Infof("Starting garbage collection in %s", intervalDuration)
+			time.Sleep(intervalDuration)
+		}
+	}()
+}
+
+// collectGarbage runs a garbage collection, logging its plan instead of its
+// progress.
+func collectGarbage(ctx context.Context, storageDriver storagedriver.StorageDriver, registry distribution.Namespace, log dcontext.Logger, opts storage.GCOpts) error {
+	plan, err := storage.PlanGarbageCollection(ctx, storageDriver, registry, opts)
+	if err != nil {
+		return err
+	}
+	log.Infof("garbage collection: %d manifests and %d blobs (%d bytes) eligible for deletion", len(plan.Manifests), len(plan.Blobs), plan.ReclaimedBytes)
+	if opts.DryRun {
+		return nil
+	}
+	return storage.ApplyGCPlan(ctx, storageDriver, registry, plan, opts)
+}
+
+func badRetentionConfig(reason string) {
+	panic(fmt.Sprintf("Unable to parse retention configuration: %s", reason))
+}
+
+// RetentionRules compiles the configured retention rules. It panics if the
+// configuration is invalid, as the registry does.
+func RetentionRules(config configuration.Retention) []storage.RetentionRule {
+	compile := func(field string, expressions []string) []*regexp.Regexp {
+		compiled := make([]*regexp.Regexp, 0, len(expressions))
+		for _, s := range expressions {
+			re, err := regexp.Compile(s)
+			if err != nil {
+				badRetentionConfig(fmt.Sprintf("%s: %s", field, err))
+			}
+			compiled = append(compiled, re)
+		}
+		return compiled
+	}
+
+	rules := make([]storage.RetentionRule, 0, len(config.Rules))
+	for _, rule := range config.Rules {
+		if rule.KeepLast < 0 || rule.MaxAge < 0 {
+			badRetentionConfig("keeplast and maxage must not be negative")
+		}
+		if rule.KeepLast == 0 && rule.MaxAge == 0 {
+			badRetentionConfig("each rule requires keeplast or maxage")
+		}
+		rules = append(rules, storage.RetentionRule{
+			Repositories: compile("repositories", rule.Repositories),
+			Tags:         compile("tags", rule.Tags),
+			Keep:         compile("keep", rule.Keep),
+			KeepLast:     rule.KeepLast,
+			MaxAge:       rule.MaxAge,
+		})
+	}
+	return rules
+}
+
+// NewQuotaTracker returns a tracker of the configured quotas in the storage
+// driver, or nil if no quota is configured. It panics if the configuration is
+// invalid, as the registry does.
+func NewQuotaTracker(storageDriver storagedriver.StorageDriver, config []configuration.Quota) *storage.QuotaTracker {
+	if len(config) == 0 {
+		return nil
+	}
+
+	quotas := make([]storage.Quota, 0, len(config))
+	for _, quota := range config {
+		if quota.Namespace == "" {
+			panic("Unable to parse quota configuration: each quota requires a namespace")
+		}
+		if quota.MaxBytes < 0 || quota.MaxManifests < 0 {
+			panic("Unable to parse quota configuration: maxbytes and maxmanifests must not be negative")
+		}
+		quotas = append(quotas, storage.Quota{
+			Namespace:    quota.Namespace,
+			MaxBytes:     quota.MaxBytes,
+			MaxManifests: quota.MaxManifests,
+		})
+	}
+	return storage.NewQuotaTracker(storageDriver, quotas)
+}
+
+// startRetentionEnforcer schedules a goroutine which will periodically remove
+// the tags selected by the retention rules.
+func startRetentionEnforcer(ctx context.Context, storageDriver storagedriver.StorageDriver, registry distribution.Namespace, log dcontext.Logger, config configuration.Retention) {
+	if !config.Enabled {
+		return
+	}
+
+	interval := config.Interval
+	if interval == 0 {
+		interval = 24 * time.Hour
+	}
+	if interval < 0 {
+		badRetentionConfig("interval must be positive")
+	}
+
+	opts := storage.RetentionOpts{
+		DryRun: config.DryRun,
+		Rules:  RetentionRules(config),
+	}
+
+	go func() {
+		randInt, err := rand.Int(rand.Reader, new(big.Int).SetInt64(math.MaxInt64))
+		if err != nil {
+			log.Infof("Failed to generate random jitter: %v", err)
+			// sleep 30min for failure case
+			randInt = big.NewInt(30)
+		}
+		jitter := time.Duration(randInt.Int64()%60) * time.Minute
+		log.Infof("Starting retention enforcement in %s", jitter)
+		time.Sleep(jitter)
+
+		for {
+			removed, err := storage.EnforceRetention(ctx, storageDriver, registry, opts)
+			if err != nil {
+				log.Errorf("retention enforcement failed: %v", err)
+			}
+			if opts.DryRun {
+				for _, t := range removed {
+					log.Infof("tag %s:%s (%s), last updated %s, is eligible for removal", t.Repository, t.Tag, t.Digest, t.Updated.Format(time.RFC3339))
+				}
+				log.Infof("%d tags eligible for removal", len(removed))
+			} else {
+				log.Infof("%d tags removed", len(removed))
+			}
+			log.Infof("Starting retention enforcement in %s", interval)
+			time.Sleep(interval)
+		}
+	}()
+}
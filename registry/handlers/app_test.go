@@ -5,11 +5,17 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/configuration"
 	"github.com/distribution/distribution/v3/internal/dcontext"
+	"github.com/distribution/distribution/v3/notifications"
 	"github.com/distribution/distribution/v3/registry/api/errcode"
 	v2 "github.com/distribution/distribution/v3/registry/api/v2"
 	"github.com/distribution/distribution/v3/registry/auth"
@@ -17,6 +23,9 @@ import (
 	"github.com/distribution/distribution/v3/registry/storage"
 	memorycache "github.com/distribution/distribution/v3/registry/storage/cache/memory"
 	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/distribution/reference"
+	events "github.com/docker/go-events"
+	"github.com/opencontainers/go-digest"
 )
 
 // TestAppDispatcher builds an application with a test dispatcher and ensures
@@ -275,3 +284,98 @@ func TestAppendAccessRecords(t *testing.T) {
 		t.Fatalf("Actual access record differs from expected")
 	}
 }
+
+type sinkFunc func(event events.Event) error
+
+func (fn sinkFunc) Write(event events.Event) error { return fn(event) }
+
+func (fn sinkFunc) Close() error { return nil }
+
+// TestRetentionTagDeletedEvents ensures tags removed by retention rules are
+// notified, attributed to the system actor.
+func TestRetentionTagDeletedEvents(t *testing.T) {
+	driver := inmemory.New()
+	ctx := dcontext.Background()
+	registry, err := storage.NewRegistry(ctx, driver, storage.EnableDelete)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	var deleted []notifications.Event
+	app := &App{
+		Config:   &configuration.Configuration{},
+		Context:  ctx,
+		driver:   driver,
+		registry: registry,
+	}
+	app.events.sink = sinkFunc(func(event events.Event) error {
+		deleted = append(deleted, event.(notifications.Event))
+		return nil
+	})
+
+	named, _ := reference.WithName("foo/retention")
+	repository, err := registry.Repository(ctx, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"old", "new"} {
+		if err := repository.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: digest.FromString(tag)}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, err = storage.EnforceRetention(ctx, driver, app.backgroundNamespace(registry), storage.RetentionOpts{
+		Rules: RetentionRules(configuration.Retention{
+			Rules: []configuration.RetentionRule{{KeepLast: 1}},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("error enforcing retention: %v", err)
+	}
+
+	if len(deleted) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(deleted))
+	}
+	if event := deleted[0]; event.Action != notifications.EventActionDelete || event.Target.Repository != "foo/retention" || event.Target.Tag != "old" || event.Actor.Name != notifications.SystemActorName {
+		t.Fatalf("unexpected event: %#v", event)
+	}
+}
+
+// TestNewSystemListenerQueuesInMemory ensures that the events of a command
+// are not written to the persistent queues of the running registry.
+func TestNewSystemListenerQueuesInMemory(t *testing.T) {
+	ctx := dcontext.Background()
+	driver := inmemory.New()
+	eventsPath := filepath.Join(t.TempDir(), "events.json")
+
+	config := configuration.Configuration{}
+	config.Notifications.Endpoints = []configuration.Endpoint{{
+		Name:  "file",
+		Type:  notifications.EndpointTypeFile,
+		File:  configuration.FileEndpoint{Path: eventsPath},
+		Queue: configuration.EndpointQueue{StoragePath: "/notifications/file", MaxRetries: 3},
+	}}
+
+	listener, sink, err := NewSystemListener(ctx, &config, driver)
+	if err != nil {
+		t.Fatalf("unexpected error creating listener: %v", err)
+	}
+	if err := listener.BlobSwept(digest.FromString("blob")); err != nil {
+		t.Fatalf("unexpected error notifying swept blob: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("unexpected error closing sink: %v", err)
+	}
+
+	p, err := os.ReadFile(eventsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(p), "\n"); lines != 1 {
+		t.Fatalf("expected 1 event, got %d", lines)
+	}
+	if _, err := driver.List(ctx, "/notifications/file"); err == nil {
+		t.Fatal("events should not be written to the queue of the registry")
+	}
+}
@@ -77,6 +77,15 @@ func (bh *blobHandler) DeleteBlob(w http.ResponseWriter, r *http.Request) {
 	dcontext.GetLogger(bh).Debug("DeleteBlob")
 
 	blobs := bh.Repository.Blobs(bh)
+
+	// the size of the blob is released from the quota once it is unlinked
+	var size int64
+	if bh.App.quotas != nil {
+		if desc, err := blobs.Stat(bh, bh.Digest); err == nil {
+			size = desc.Size
+		}
+	}
+
 	err := blobs.Delete(bh, bh.Digest)
 	if err != nil {
 		switch err {
@@ -92,6 +101,7 @@ func (bh *blobHandler) DeleteBlob(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+	bh.accountQuota(-size, 0)
 
 	w.Header().Set("Content-Length", "0")
 	w.WriteHeader(http.StatusAccepted)
@@ -77,7 +77,28 @@ func (buh *blobUploadHandler) StartBlobUpload(w http.ResponseWriter, r *http.Req
 	}
 
 	blobs := buh.Repository.Blobs(buh)
+
+	// A mounted blob which is not yet linked into the repository counts
+	// towards its quota, as if its upload was completed.
+	var reserved int64
+	if len(options) > 0 && buh.App.quotas != nil {
+		dgst := digest.Digest(mountDigest)
+		if _, err := blobs.Stat(buh, dgst); err == distribution.ErrBlobUnknown {
+			if desc, err := buh.App.registry.BlobStatter().Stat(buh, dgst); err == nil {
+				reserved = desc.Size
+			}
+		}
+		if err := buh.reserveQuota(reserved, 0); err != nil {
+			buh.Errors = append(buh.Errors, err)
+			return
+		}
+	}
+
 	upload, err := blobs.Create(buh, options...)
+	if _, ok := err.(distribution.ErrBlobMounted); !ok {
+		// the blob was not mounted, its upload will be accounted on completion
+		buh.accountQuota(-reserved, 0)
+	}
 	if err != nil {
 		if ebm, ok := err.(distribution.ErrBlobMounted); ok {
 			if err := buh.writeBlobCreatedHeaders(w, ebm.Descriptor); err != nil {
@@ -210,6 +231,22 @@ func (buh *blobUploadHandler) PutBlobUploadComplete(w http.ResponseWriter, r *ht
 		return
 	}
 
+	// Blobs already linked into the repository do not count towards its
+	// quota again.
+	var reserved int64
+	if buh.App.quotas != nil {
+		if _, err := buh.Repository.Blobs(buh).Stat(buh, dgst); err == distribution.ErrBlobUnknown {
+			reserved = buh.Upload.Size()
+		}
+		if err := buh.reserveQuota(reserved, 0); err != nil {
+			buh.Errors = append(buh.Errors, err)
+			if err := buh.Upload.Cancel(buh); err != nil {
+				dcontext.GetLogger(buh).Errorf("error canceling upload after error: %v", err)
+			}
+			return
+		}
+	}
+
 	desc, err := buh.Upload.Commit(buh, distribution.Descriptor{
 		Digest: dgst,
 
@@ -238,6 +275,8 @@ func (buh *blobUploadHandler) PutBlobUploadComplete(w http.ResponseWriter, r *ht
 
 		}
 
+		buh.accountQuota(-reserved, 0)
+
 		// Clean up the backend blob data if there was an error.
 		if err := buh.Upload.Cancel(buh); err != nil {
 			// If the cleanup fails, all we can do is observe and report.
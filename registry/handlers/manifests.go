@@ -285,8 +285,28 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Manifests already stored in the repository do not count towards its
+	// quota again.
+	var reserved int64
+	if imh.App.quotas != nil {
+		exists, err := manifests.Exists(imh, imh.Digest)
+		if err != nil {
+			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		if !exists {
+			reserved = 1
+		}
+		if err := imh.reserveQuota(0, reserved); err != nil {
+			imh.Errors = append(imh.Errors, err)
+			return
+		}
+	}
+
 	_, err = manifests.Put(imh, manifest, options...)
 	if err != nil {
+		imh.accountQuota(0, -reserved)
+
 		// TODO(stevvooe): These error handling switches really need to be
 		// handled by an app global mapper.
 		if err == distribution.ErrUnsupported {
@@ -305,6 +325,8 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 					imh.Errors = append(imh.Errors, errcode.ErrorCodeManifestBlobUnknown.WithDetail(verificationError.Digest))
 				case distribution.ErrManifestNameInvalid:
 					imh.Errors = append(imh.Errors, errcode.ErrorCodeNameInvalid.WithDetail(err))
+				case distribution.ErrManifestSubjectInvalid:
+					imh.Errors = append(imh.Errors, errcode.ErrorCodeManifestInvalid.WithDetail(verificationError.Error()))
 				case distribution.ErrManifestUnverified:
 					imh.Errors = append(imh.Errors, errcode.ErrorCodeManifestUnverified)
 				default:
@@ -315,6 +337,8 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 					}
 				}
 			}
+		case distribution.ErrTagImmutable:
+			imh.Errors = append(imh.Errors, errcode.ErrorCodeTagImmutable.WithDetail(map[string]string{"tag": err.Tag}))
 		case errcode.Error:
 			imh.Errors = append(imh.Errors, err)
 		default:
@@ -328,7 +352,14 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 		tags := imh.Repository.Tags(imh)
 		err = tags.Tag(imh, imh.Tag, desc)
 		if err != nil {
-			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			switch err := err.(type) {
+			case distribution.ErrTagImmutable:
+				imh.Errors = append(imh.Errors, errcode.ErrorCodeTagImmutable.WithDetail(map[string]string{"tag": err.Tag}))
+			case errcode.Error:
+				imh.Errors = append(imh.Errors, err)
+			default:
+				imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
 			return
 		}
 
@@ -349,6 +380,12 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 		dcontext.GetLogger(imh).Errorf("error building manifest url from digest: %v", err)
 	}
 
+	// Acknowledge that the subject has been recorded, so that clients do not
+	// fall back to the referrers tag schema.
+	if subject := manifestSubject(manifest); subject != nil {
+		w.Header().Set("OCI-Subject", subject.Digest.String())
+	}
+
 	w.Header().Set("Location", location)
 	w.Header().Set("Docker-Content-Digest", imh.Digest.String())
 	w.WriteHeader(http.StatusCreated)
@@ -356,6 +393,17 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 	dcontext.GetLogger(imh).Debug("Succeeded in putting manifest!")
 }
 
+// manifestSubject returns the subject declared by the manifest, if any.
+func manifestSubject(manifest distribution.Manifest) *distribution.Descriptor {
+	switch m := manifest.(type) {
+	case *ocischema.DeserializedManifest:
+		return m.Subject
+	case *ocischema.DeserializedImageIndex:
+		return m.Subject
+	}
+	return nil
+}
+
 // applyResourcePolicy checks whether the resource class matches what has
 // been authorized and allowed by the policy configuration.
 func (imh *manifestHandler) applyResourcePolicy(manifest distribution.Manifest) error {
@@ -437,9 +485,11 @@ func (imh *manifestHandler) DeleteManifest(w http.ResponseWriter, r *http.Reques
 		dcontext.GetLogger(imh).Debug("DeleteImageTag")
 		tagService := imh.Repository.Tags(imh.Context)
 		if err := tagService.Untag(imh.Context, imh.Tag); err != nil {
-			switch err.(type) {
+			switch err := err.(type) {
 			case distribution.ErrTagUnknown, driver.PathNotFoundError:
 				imh.Errors = append(imh.Errors, errcode.ErrorCodeManifestUnknown.WithDetail(err))
+			case distribution.ErrTagImmutable:
+				imh.Errors = append(imh.Errors, errcode.ErrorCodeTagImmutable.WithDetail(map[string]string{"tag": err.Tag}))
 			default:
 				imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 			}
@@ -456,6 +506,10 @@ func (imh *manifestHandler) DeleteManifest(w http.ResponseWriter, r *http.Reques
 	}
 
 	err = manifests.Delete(imh, imh.Digest)
+	if err, ok := err.(distribution.ErrTagImmutable); ok {
+		imh.Errors = append(imh.Errors, errcode.ErrorCodeTagImmutable.WithDetail(map[string]string{"tag": err.Tag}))
+		return
+	}
 	if err != nil {
 		switch err {
 		case digest.ErrDigestUnsupported:
@@ -472,6 +526,8 @@ func (imh *manifestHandler) DeleteManifest(w http.ResponseWriter, r *http.Reques
 			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown)
 			return
 		}
+	} else {
+		imh.accountQuota(0, -1)
 	}
 
 	tagService := imh.Repository.Tags(imh)
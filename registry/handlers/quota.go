@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/internal/dcontext"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+)
+
+// reserveQuota reserves bytes and manifests in the quota of the repository of
+// the request, returning the errcode to report if it would be exceeded.
+func (ctx *Context) reserveQuota(bytes, manifests int64) error {
+	if ctx.App.quotas == nil {
+		return nil
+	}
+
+	err := ctx.App.quotas.Reserve(ctx, ctx.Repository.Named().Name(), bytes, manifests)
+	switch err := err.(type) {
+	case nil:
+		return nil
+	case distribution.ErrQuotaExceeded:
+		return errcode.ErrorCodeQuotaExceeded.WithDetail(err)
+	default:
+		return errcode.ErrorCodeUnknown.WithDetail(err)
+	}
+}
+
+// accountQuota adds bytes and manifests, which are negative for deleted
+// content, to the usage of the quota of the repository of the request.
+// Failures are only logged since the content has already been changed.
+func (ctx *Context) accountQuota(bytes, manifests int64) {
+	if ctx.App.quotas == nil {
+		return
+	}
+
+	if err := ctx.App.quotas.Add(ctx, ctx.Repository.Named().Name(), bytes, manifests); err != nil {
+		dcontext.GetLogger(ctx).Errorf("failed to update quota usage: %v", err)
+	}
+}
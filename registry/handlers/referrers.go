@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/internal/dcontext"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// referrersDispatcher constructs the referrers handler api endpoint.
+func referrersDispatcher(ctx *Context, r *http.Request) http.Handler {
+	dgst, err := getDigest(ctx)
+	if err != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, errcode.ErrorCodeDigestInvalid.WithDetail(err))
+		})
+	}
+
+	referrersHandler := &referrersHandler{
+		Context: ctx,
+		Digest:  dgst,
+	}
+
+	return handlers.MethodHandler{
+		http.MethodGet: http.HandlerFunc(referrersHandler.GetReferrers),
+	}
+}
+
+// referrersHandler handles requests for the referrers of a manifest.
+type referrersHandler struct {
+	*Context
+
+	Digest digest.Digest
+}
+
+// GetReferrers returns an image index listing the manifests which declare
+// the requested digest as their subject, optionally filtered by artifact
+// type.
+func (rh *referrersHandler) GetReferrers(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(rh).Debug("GetReferrers")
+
+	if rh.App.referrers == nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnsupported.WithMessage("The registry does not support the referrers API"))
+		return
+	}
+
+	artifactType := r.URL.Query().Get("artifactType")
+
+	descriptors := make([]distribution.Descriptor, 0)
+	err := rh.App.referrers.EnumerateReferrers(rh, rh.Repository.Named(), rh.Digest, func(desc distribution.Descriptor) error {
+		if artifactType == "" || desc.ArtifactType == artifactType {
+			descriptors = append(descriptors, desc)
+		}
+		return nil
+	})
+	if err != nil {
+		switch err := err.(type) {
+		case distribution.ErrRepositoryUnknown:
+			rh.Errors = append(rh.Errors, errcode.ErrorCodeNameUnknown.WithDetail(map[string]string{"name": rh.Repository.Named().Name()}))
+		case errcode.Error:
+			rh.Errors = append(rh.Errors, err)
+		default:
+			rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	index, err := ocischema.FromDescriptors(descriptors, nil)
+	if err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	_, p, err := index.Payload()
+	if err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	if artifactType != "" {
+		w.Header().Set("OCI-Filters-Applied", "artifactType")
+	}
+	w.Header().Set("Content-Type", v1.MediaTypeImageIndex)
+	w.Header().Set("Content-Length", fmt.Sprint(len(p)))
+	if _, err := w.Write(p); err != nil {
+		dcontext.GetLogger(rh).Errorf("error writing referrers response: %v", err)
+	}
+}
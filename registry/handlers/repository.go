@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/internal/dcontext"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/gorilla/handlers"
+)
+
+// repositoryDispatcher constructs the repository handler api endpoint.
+func repositoryDispatcher(ctx *Context, r *http.Request) http.Handler {
+	repositoryHandler := &repositoryHandler{
+		Context: ctx,
+	}
+
+	mhandler := handlers.MethodHandler{}
+
+	if !ctx.readOnly {
+		mhandler[http.MethodDelete] = http.HandlerFunc(repositoryHandler.DeleteRepository)
+	}
+
+	return mhandler
+}
+
+// removalChecker is implemented by the repository middlewares which may
+// refuse removing a repository, such as to protect its tags.
+type removalChecker interface {
+	CheckRemove(ctx context.Context) error
+}
+
+// repositoryHandler handles http operations on whole repositories.
+type repositoryHandler struct {
+	*Context
+}
+
+// DeleteRepository removes the repository, along with all of its manifests,
+// tags and blob links, from the registry.
+func (rh *repositoryHandler) DeleteRepository(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(rh).Debug("DeleteRepository")
+
+	if rh.App.isCache || rh.App.repoRemover == nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnsupported)
+		return
+	}
+
+	name := rh.Repository.Named()
+
+	// a repository middleware may refuse removing the repository
+	if checker, ok := rh.Repository.(removalChecker); ok {
+		if err := checker.CheckRemove(rh); err != nil {
+			switch err := err.(type) {
+			case distribution.ErrTagImmutable:
+				rh.Errors = append(rh.Errors, errcode.ErrorCodeTagImmutable.WithDetail(map[string]string{"tag": err.Tag}))
+			default:
+				rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
+			return
+		}
+	}
+
+	// the content of the repository is released from its quota once removed
+	var usage storage.QuotaUsage
+	if rh.App.quotas != nil {
+		var err error
+		usage, err = storage.RepositoryUsage(rh, rh.App.registry, name.Name())
+		if err != nil {
+			dcontext.GetLogger(rh).Errorf("failed to compute quota usage of repository: %v", err)
+		}
+	}
+
+	err := rh.RepositoryRemover.Remove(rh, name)
+	if err == distribution.ErrUnsupported {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnsupported)
+		return
+	}
+	if err != nil {
+		switch err := err.(type) {
+		case distribution.ErrRepositoryUnknown:
+			rh.Errors = append(rh.Errors, errcode.ErrorCodeNameUnknown.WithDetail(map[string]string{"name": name.Name()}))
+		case errcode.Error:
+			rh.Errors = append(rh.Errors, err)
+		default:
+			rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+	rh.accountQuota(-usage.Bytes, -usage.Manifests)
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,252 @@
+// Package immutabletags provides a repository middleware which prevents
+// existing tags from being moved to another manifest.
+//
+// As a removed tag could be pushed again with another manifest, existing
+// immutable tags cannot be deleted either, nor the manifests they refer to,
+// nor the repositories holding them.
+//
+// A manifest pushed by tag is rejected before it is stored if the tag refers
+// to another manifest. The tag is looked up before it is written, without
+// locking, so concurrent pushes of different manifests to a tag which does
+// not exist yet may all succeed, the last one moving the tag.
+package immutabletags
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/distribution/distribution/v3"
+	repositorymiddleware "github.com/distribution/distribution/v3/registry/middleware/repository"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	if err := repositorymiddleware.Register("immutabletags", newImmutableTagsMiddleware); err != nil {
+		logrus.Errorf("failed to register immutabletags repository middleware: %v", err)
+	}
+}
+
+// immutableTagsRepository rejects re-pointing the existing tags of the
+// repository which match any of tags, or all of them if tags is empty.
+type immutableTagsRepository struct {
+	distribution.Repository
+	tags []*regexp.Regexp
+}
+
+var _ distribution.Repository = &immutableTagsRepository{}
+
+func newImmutableTagsMiddleware(ctx context.Context, repository distribution.Repository, options map[string]interface{}) (distribution.Repository, error) {
+	repositories, err := regexpsOption(options, "repositories")
+	if err != nil {
+		return nil, err
+	}
+	tags, err := regexpsOption(options, "tags")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(repositories) > 0 && !matchesAny(repositories, repository.Named().Name()) {
+		return repository, nil
+	}
+
+	return &immutableTagsRepository{
+		Repository: repository,
+		tags:       tags,
+	}, nil
+}
+
+// regexpsOption compiles the list of regular expressions of the named option.
+func regexpsOption(options map[string]interface{}, name string) ([]*regexp.Regexp, error) {
+	o, ok := options[name]
+	if !ok {
+		return nil, nil
+	}
+
+	var expressions []string
+	switch o := o.(type) {
+	case string:
+		expressions = []string{o}
+	case []string:
+		expressions = o
+	case []interface{}:
+		for _, e := range o {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a list of strings", name)
+			}
+			expressions = append(expressions, s)
+		}
+	default:
+		return nil, fmt.Errorf("%s must be a list of strings", name)
+	}
+
+	compiled := make([]*regexp.Regexp, 0, len(expressions))
+	for _, s := range expressions {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s expression %q: %v", name, s, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+func matchesAny(expressions []*regexp.Regexp, s string) bool {
+	for _, re := range expressions {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *immutableTagsRepository) Manifests(ctx context.Context, options ...distribution.ManifestServiceOption) (distribution.ManifestService, error) {
+	manifests, err := r.Repository.Manifests(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &immutableManifestService{
+		ManifestService: manifests,
+		tags: &immutableTagService{
+			TagService: r.Repository.Tags(ctx),
+			tags:       r.tags,
+		},
+	}, nil
+}
+
+func (r *immutableTagsRepository) Tags(ctx context.Context) distribution.TagService {
+	return &immutableTagService{
+		TagService: r.Repository.Tags(ctx),
+		tags:       r.tags,
+	}
+}
+
+// CheckRemove returns distribution.ErrTagImmutable if the repository holds an
+// immutable tag, to refuse removing the repository. The repositories it wraps
+// are checked as well, as the middleware may be configured several times.
+func (r *immutableTagsRepository) CheckRemove(ctx context.Context) error {
+	ts := &immutableTagService{
+		TagService: r.Repository.Tags(ctx),
+		tags:       r.tags,
+	}
+	tags, err := ts.All(ctx)
+	switch err.(type) {
+	case nil:
+	case distribution.ErrRepositoryUnknown:
+		return nil
+	default:
+		return err
+	}
+	for _, tag := range tags {
+		if ts.immutable(tag) {
+			return distribution.ErrTagImmutable{Tag: tag}
+		}
+	}
+
+	if checker, ok := r.Repository.(interface {
+		CheckRemove(ctx context.Context) error
+	}); ok {
+		return checker.CheckRemove(ctx)
+	}
+	return nil
+}
+
+type immutableManifestService struct {
+	distribution.ManifestService
+	tags *immutableTagService
+}
+
+// Put stores the manifest unless it is pushed with an immutable tag which
+// refers to another manifest, so that a rejected push leaves no manifest.
+func (ms *immutableManifestService) Put(ctx context.Context, manifest distribution.Manifest, options ...distribution.ManifestServiceOption) (digest.Digest, error) {
+	for _, option := range options {
+		opt, ok := option.(distribution.WithTagOption)
+		if !ok {
+			continue
+		}
+		_, payload, err := manifest.Payload()
+		if err != nil {
+			return "", err
+		}
+		if err := ms.tags.check(ctx, opt.Tag, digest.FromBytes(payload)); err != nil {
+			return "", err
+		}
+	}
+
+	return ms.ManifestService.Put(ctx, manifest, options...)
+}
+
+// Delete deletes the manifest unless an immutable tag refers to it, as the
+// tag would be removed along with it.
+func (ms *immutableManifestService) Delete(ctx context.Context, dgst digest.Digest) error {
+	tags, err := ms.tags.Lookup(ctx, distribution.Descriptor{Digest: dgst})
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if ms.tags.immutable(tag) {
+			return distribution.ErrTagImmutable{Tag: tag}
+		}
+	}
+
+	return ms.ManifestService.Delete(ctx, dgst)
+}
+
+type immutableTagService struct {
+	distribution.TagService
+	tags []*regexp.Regexp
+}
+
+// Tag tags the digest unless the tag is immutable and already refers to
+// another manifest. Pushing the same manifest again is allowed.
+func (ts *immutableTagService) Tag(ctx context.Context, tag string, desc distribution.Descriptor) error {
+	if err := ts.check(ctx, tag, desc.Digest); err != nil {
+		return err
+	}
+
+	return ts.TagService.Tag(ctx, tag, desc)
+}
+
+// Untag removes the tag unless it is immutable, as it could then be pushed
+// again with another manifest.
+func (ts *immutableTagService) Untag(ctx context.Context, tag string) error {
+	if ts.immutable(tag) {
+		_, err := ts.TagService.Get(ctx, tag)
+		switch err.(type) {
+		case nil:
+			return distribution.ErrTagImmutable{Tag: tag}
+		case distribution.ErrTagUnknown:
+		default:
+			return err
+		}
+	}
+
+	return ts.TagService.Untag(ctx, tag)
+}
+
+// immutable returns whether the tag is immutable.
+func (ts *immutableTagService) immutable(tag string) bool {
+	return len(ts.tags) == 0 || matchesAny(ts.tags, tag)
+}
+
+// check returns distribution.ErrTagImmutable if the tag is immutable and
+// refers to another manifest than dgst.
+func (ts *immutableTagService) check(ctx context.Context, tag string, dgst digest.Digest) error {
+	if !ts.immutable(tag) {
+		return nil
+	}
+
+	current, err := ts.TagService.Get(ctx, tag)
+	switch err.(type) {
+	case nil:
+		if current.Digest != dgst {
+			return distribution.ErrTagImmutable{Tag: tag}
+		}
+	case distribution.ErrTagUnknown:
+	default:
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package immutabletags
+
+import (
+	"context"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+)
+
+func newRepository(t *testing.T, name string) distribution.Repository {
+	ctx := context.Background()
+	registry, err := storage.NewRegistry(ctx, inmemory.New())
+	require.NoError(t, err)
+
+	named, err := reference.WithName(name)
+	require.NoError(t, err)
+
+	repository, err := registry.Repository(ctx, named)
+	require.NoError(t, err)
+	return repository
+}
+
+func TestInvalidOptions(t *testing.T) {
+	repository := newRepository(t, "release/app")
+
+	_, err := newImmutableTagsMiddleware(context.Background(), repository, map[string]interface{}{"tags": 42})
+	require.ErrorContains(t, err, "tags must be a list of strings")
+
+	_, err = newImmutableTagsMiddleware(context.Background(), repository, map[string]interface{}{"repositories": []interface{}{"("}})
+	require.ErrorContains(t, err, "invalid repositories expression")
+}
+
+func TestUnmatchedRepository(t *testing.T) {
+	repository := newRepository(t, "dev/app")
+
+	wrapped, err := newImmutableTagsMiddleware(context.Background(), repository, map[string]interface{}{"repositories": "^release/"})
+	require.NoError(t, err)
+	require.Equal(t, repository, wrapped)
+}
+
+func TestImmutableTags(t *testing.T) {
+	ctx := context.Background()
+	repository, err := newImmutableTagsMiddleware(ctx, newRepository(t, "release/app"), map[string]interface{}{
+		"tags": []interface{}{`^v\d+`},
+	})
+	require.NoError(t, err)
+
+	first := distribution.Descriptor{Digest: digest.FromString("first")}
+	second := distribution.Descriptor{Digest: digest.FromString("second")}
+
+	tags := repository.Tags(ctx)
+	require.NoError(t, tags.Tag(ctx, "v1", first))
+
+	// tagging the same manifest again is allowed
+	require.NoError(t, tags.Tag(ctx, "v1", first))
+
+	err = tags.Tag(ctx, "v1", second)
+	require.Equal(t, distribution.ErrTagImmutable{Tag: "v1"}, err)
+
+	desc, err := tags.Get(ctx, "v1")
+	require.NoError(t, err)
+	require.Equal(t, first.Digest, desc.Digest)
+
+	// unmatched tags may be moved
+	require.NoError(t, tags.Tag(ctx, "latest", first))
+	require.NoError(t, tags.Tag(ctx, "latest", second))
+}
+
+type testManifest []byte
+
+func (m testManifest) References() []distribution.Descriptor { return nil }
+
+func (m testManifest) Payload() (string, []byte, error) {
+	return "application/json", m, nil
+}
+
+// recordingManifestService records the manifests it stores and the number of
+// manifests it deletes.
+type recordingManifestService struct {
+	distribution.ManifestService
+	stored  []distribution.Manifest
+	deleted int
+}
+
+func (ms *recordingManifestService) Delete(ctx context.Context, dgst digest.Digest) error {
+	ms.deleted++
+	return nil
+}
+
+func (ms *recordingManifestService) Put(ctx context.Context, manifest distribution.Manifest, options ...distribution.ManifestServiceOption) (digest.Digest, error) {
+	ms.stored = append(ms.stored, manifest)
+	_, payload, _ := manifest.Payload()
+	return digest.FromBytes(payload), nil
+}
+
+func TestImmutableTagsRejectManifestBeforeStoring(t *testing.T) {
+	ctx := context.Background()
+	repository, err := newImmutableTagsMiddleware(ctx, newRepository(t, "release/app"), map[string]interface{}{})
+	require.NoError(t, err)
+
+	first := testManifest(`{"name":"first"}`)
+	second := testManifest(`{"name":"second"}`)
+	require.NoError(t, repository.Tags(ctx).Tag(ctx, "v1", distribution.Descriptor{Digest: digest.FromBytes(first)}))
+
+	recorder := &recordingManifestService{}
+	manifests := &immutableManifestService{
+		ManifestService: recorder,
+		tags:            repository.Tags(ctx).(*immutableTagService),
+	}
+
+	_, err = manifests.Put(ctx, second, distribution.WithTag("v1"))
+	require.Equal(t, distribution.ErrTagImmutable{Tag: "v1"}, err)
+	require.Empty(t, recorder.stored)
+
+	_, err = manifests.Put(ctx, first, distribution.WithTag("v1"))
+	require.NoError(t, err)
+	_, err = manifests.Put(ctx, second, distribution.WithTag("v2"))
+	require.NoError(t, err)
+	_, err = manifests.Put(ctx, second)
+	require.NoError(t, err)
+	require.Equal(t, []distribution.Manifest{first, second, second}, recorder.stored)
+}
+
+func TestImmutableTagsRejectDeletion(t *testing.T) {
+	ctx := context.Background()
+	inner, err := newImmutableTagsMiddleware(ctx, newRepository(t, "release/app"), map[string]interface{}{
+		"tags": []interface{}{`^v\d+`},
+	})
+	require.NoError(t, err)
+	repository, err := newImmutableTagsMiddleware(ctx, inner, map[string]interface{}{
+		"tags": []interface{}{`^stable$`},
+	})
+	require.NoError(t, err)
+	checker := repository.(*immutableTagsRepository)
+
+	// an empty repository may be removed
+	require.NoError(t, checker.CheckRemove(ctx))
+
+	first := distribution.Descriptor{Digest: digest.FromString("first")}
+	second := distribution.Descriptor{Digest: digest.FromString("second")}
+	tags := repository.Tags(ctx)
+	require.NoError(t, tags.Tag(ctx, "latest", first))
+	require.NoError(t, tags.Tag(ctx, "v1", second))
+
+	// unmatched tags may be removed
+	require.NoError(t, tags.Untag(ctx, "latest"))
+
+	err = tags.Untag(ctx, "v1")
+	require.Equal(t, distribution.ErrTagImmutable{Tag: "v1"}, err)
+	_, err = tags.Get(ctx, "v1")
+	require.NoError(t, err)
+
+	// removing unknown tags fails as without the middleware
+	err = tags.Untag(ctx, "v2")
+	require.Error(t, err)
+	require.NotEqual(t, distribution.ErrTagImmutable{Tag: "v2"}, err)
+
+	recorder := &recordingManifestService{}
+	manifests := &immutableManifestService{
+		ManifestService: recorder,
+		tags:            inner.Tags(ctx).(*immutableTagService),
+	}
+	require.Equal(t, distribution.ErrTagImmutable{Tag: "v1"}, manifests.Delete(ctx, second.Digest))
+	require.Equal(t, 0, recorder.deleted)
+	require.NoError(t, manifests.Delete(ctx, first.Digest))
+	require.Equal(t, 1, recorder.deleted)
+
+	// the tags protected by the wrapped middleware are checked as well
+	require.Equal(t, distribution.ErrTagImmutable{Tag: "v1"}, checker.CheckRemove(ctx))
+}
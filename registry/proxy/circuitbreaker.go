@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3/internal/dcontext"
+)
+
+const (
+	defaultCircuitBreakerThreshold = 5
+	defaultCircuitBreakerCooldown  = 30 * time.Second
+
+	// staleWarning is the Warning header of responses served from the cache
+	// when the remote registry could not be reached to revalidate them.
+	staleWarning = `110 - "Response is Stale"`
+)
+
+// errCircuitOpen is returned for requests to a remote registry which are not
+// sent because the remote registry is unavailable.
+var errCircuitOpen = errors.New("remote registry unavailable: circuit breaker is open")
+
+// circuitBreaker stops requests to a remote registry after a number of
+// consecutive failures, so that requests are served from the cache without
+// waiting for the remote registry to time out. Once the cooldown has elapsed,
+// a single request is sent to probe whether the remote registry recovered.
+//
+// A nil circuitBreaker never opens.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		threshold = defaultCircuitBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = defaultCircuitBreakerCooldown
+	}
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// allow returns whether a request may be sent to the remote registry.
+func (cb *circuitBreaker) allow() bool {
+	if cb == nil {
+		return true
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.failures < cb.threshold {
+		return true
+	}
+	if cb.probing || time.Since(cb.openedAt) < cb.cooldown {
+		return false
+	}
+	cb.probing = true
+	return true
+}
+
+// record records the outcome of a request to the remote registry.
+func (cb *circuitBreaker) record(failed bool) {
+	if cb == nil {
+		return
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.probing = false
+	if !failed {
+		cb.failures = 0
+		return
+	}
+
+	cb.failures++
+	if cb.failures >= cb.threshold {
+		cb.openedAt = time.Now()
+	}
+}
+
+// release ends a request to the remote registry without an outcome.
+func (cb *circuitBreaker) release() {
+	if cb == nil {
+		return
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.probing = false
+}
+
+// isOpen returns whether the remote registry is considered unavailable.
+func (cb *circuitBreaker) isOpen() bool {
+	if cb == nil {
+		return false
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return cb.failures >= cb.threshold
+}
+
+// circuitBreakerTransport sends requests to a remote registry unless its
+// circuit breaker is open. Transport errors and server errors count as
+// failures.
+type circuitBreakerTransport struct {
+	base    http.RoundTripper
+	breaker *circuitBreaker
+}
+
+func (t *circuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.breaker.allow() {
+		return nil, errCircuitOpen
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil && req.Context().Err() != nil {
+		// the request was canceled, which says nothing about the remote
+		t.breaker.release()
+		return resp, err
+	}
+	t.breaker.record(err != nil || resp.StatusCode >= http.StatusInternalServerError)
+	return resp, err
+}
+
+// setStaleWarning marks the response of the request as served from the cache
+// without being revalidated against the remote registry.
+func setStaleWarning(ctx context.Context) {
+	if w, err := dcontext.GetResponseWriter(ctx); err == nil {
+		w.Header().Set("Warning", staleWarning)
+	}
+}
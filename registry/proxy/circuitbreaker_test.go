@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	cb := newCircuitBreaker(2, 50*time.Millisecond)
+
+	cb.record(true)
+	if !cb.allow() || cb.isOpen() {
+		t.Fatal("circuit breaker opened before reaching the threshold")
+	}
+	cb.record(true)
+	if cb.allow() || !cb.isOpen() {
+		t.Fatal("circuit breaker did not open after reaching the threshold")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if !cb.allow() {
+		t.Fatal("circuit breaker did not allow a probe after the cooldown")
+	}
+	if cb.allow() {
+		t.Fatal("circuit breaker allowed a second request while probing")
+	}
+
+	// a failed probe restarts the cooldown
+	cb.record(true)
+	if cb.allow() {
+		t.Fatal("circuit breaker allowed a request after a failed probe")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if !cb.allow() {
+		t.Fatal("circuit breaker did not allow a probe after the cooldown")
+	}
+	cb.record(false)
+	if !cb.allow() || cb.isOpen() {
+		t.Fatal("circuit breaker did not close after a successful probe")
+	}
+}
+
+func TestCircuitBreakerTransport(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: &circuitBreakerTransport{
+			base:    http.DefaultTransport,
+			breaker: newCircuitBreaker(3, time.Hour),
+		},
+	}
+
+	for i := 0; i < 5; i++ {
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Fatalf("expected 3 requests to reach the remote, got %d", n)
+	}
+}
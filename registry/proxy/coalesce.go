@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/internal/client"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+)
+
+const (
+	defaultNegativeCacheTTL = 30 * time.Second
+
+	// flightTimeout bounds a coalesced request to a remote registry, which
+	// is not canceled along with the request which sent it.
+	flightTimeout = time.Minute
+
+	// maxNegativeCacheEntries bounds the memory used to remember unknown
+	// content, which clients can request without limit.
+	maxNegativeCacheEntries = 10000
+)
+
+// flightGroup coalesces concurrent identical requests to a remote registry:
+// only the first one is sent, and the others wait for its result.
+//
+// A nil flightGroup sends every request.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{
+		calls: make(map[string]*flightCall),
+	}
+}
+
+// do calls fn unless a call with the same key is in flight, in which case it
+// waits for that call and returns its result. shared reports whether the
+// result is the one of another call.
+//
+// fn runs with a context detached from the one of the caller, so that the
+// callers waiting for it do not fail when the first one is canceled, and
+// bounded by flightTimeout. A caller returns as soon as its own context is
+// done, and calls fn again if the call it waited for failed with a context
+// error.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (val interface{}, shared bool, err error) {
+	if g == nil {
+		val, err = fn(ctx)
+		return val, false, err
+	}
+
+	for {
+		g.mu.Lock()
+		call, inFlight := g.calls[key]
+		if !inFlight {
+			call = &flightCall{done: make(chan struct{})}
+			g.calls[key] = call
+			go g.call(ctx, key, call, fn)
+		}
+		g.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, inFlight, ctx.Err()
+		}
+
+		if inFlight && isContextError(call.err) && ctx.Err() == nil {
+			continue
+		}
+		return call.val, inFlight, call.err
+	}
+}
+
+// call runs fn for the call with the key, and removes the call once done.
+func (g *flightGroup) call(ctx context.Context, key string, call *flightCall, fn func(context.Context) (interface{}, error)) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), flightTimeout)
+	defer cancel()
+
+	call.val, call.err = fn(ctx)
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(call.done)
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// negativeCache remembers for a while the content a remote registry reported
+// as unknown, so that repeated lookups of missing tags and manifests are not
+// sent to it.
+//
+// A nil negativeCache remembers nothing.
+type negativeCache struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	expiries map[string]time.Time
+}
+
+func newNegativeCache(ttl time.Duration) *negativeCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &negativeCache{
+		ttl:      ttl,
+		expiries: make(map[string]time.Time),
+	}
+}
+
+// has returns whether the content was recently reported as unknown.
+func (nc *negativeCache) has(key string) bool {
+	if nc == nil {
+		return false
+	}
+
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	expiry, ok := nc.expiries[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expiry) {
+		delete(nc.expiries, key)
+		return false
+	}
+	return true
+}
+
+// add remembers that the content was reported as unknown.
+func (nc *negativeCache) add(key string) {
+	if nc == nil {
+		return
+	}
+
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	now := time.Now()
+	if len(nc.expiries) >= maxNegativeCacheEntries {
+		for k, expiry := range nc.expiries {
+			if now.After(expiry) {
+				delete(nc.expiries, k)
+			}
+		}
+		if len(nc.expiries) >= maxNegativeCacheEntries {
+			return
+		}
+	}
+	nc.expiries[key] = now.Add(nc.ttl)
+}
+
+// isNotFound returns whether the error of a request to a remote registry
+// reports the content as unknown.
+func isNotFound(err error) bool {
+	switch err := err.(type) {
+	case distribution.ErrTagUnknown, distribution.ErrManifestUnknown, distribution.ErrManifestUnknownRevision, distribution.ErrRepositoryUnknown:
+		return true
+	case errcode.Errors:
+		if len(err) == 0 {
+			return false
+		}
+		for _, err := range err {
+			if !isNotFound(err) {
+				return false
+			}
+		}
+		return true
+	case errcode.ErrorCoder:
+		return err.ErrorCode().Descriptor().HTTPStatusCode == http.StatusNotFound
+	case *client.UnexpectedHTTPResponseError:
+		return err.StatusCode == http.StatusNotFound
+	}
+	return false
+}
@@ -0,0 +1,240 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v2 "github.com/distribution/distribution/v3/registry/api/v2"
+)
+
+func TestFlightGroup(t *testing.T) {
+	g := newFlightGroup()
+
+	release := make(chan struct{})
+	var calls int32
+	fn := func(context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "result", nil
+	}
+
+	var wg sync.WaitGroup
+	var sharedCount int32
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val, shared, err := g.do(context.Background(), "key", fn)
+			if err != nil || val != "result" {
+				t.Errorf("Unexpected result %v, %v", val, err)
+			}
+			if shared {
+				atomic.AddInt32(&sharedCount, 1)
+			}
+		}()
+	}
+
+	// wait for the calls to be in flight
+	for {
+		g.mu.Lock()
+		call := g.calls["key"]
+		g.mu.Unlock()
+		if call != nil && atomic.LoadInt32(&calls) == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatalf("Expected a single call, got %d", calls)
+	}
+	if sharedCount != 4 {
+		t.Fatalf("Expected 4 shared results, got %d", sharedCount)
+	}
+
+	// calls are not coalesced once done
+	if _, shared, _ := g.do(context.Background(), "key", fn); shared || calls != 2 {
+		t.Fatalf("Expected a new call, got shared=%t after %d calls", shared, calls)
+	}
+}
+
+func TestFlightGroupLeaderCanceled(t *testing.T) {
+	g := newFlightGroup()
+
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		select {
+		case <-release:
+			return "result", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, _, err := g.do(leaderCtx, "key", fn)
+		leaderErr <- err
+	}()
+	for {
+		g.mu.Lock()
+		call := g.calls["key"]
+		g.mu.Unlock()
+		if call != nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	waiterDone := make(chan struct{})
+	go func() {
+		defer close(waiterDone)
+		val, shared, err := g.do(context.Background(), "key", fn)
+		if err != nil || val != "result" || !shared {
+			t.Errorf("Unexpected result %v, shared=%t, %v", val, shared, err)
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+
+	// the leader returns as soon as it is canceled, without failing the
+	// call the waiter shares
+	cancel()
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the leader to be canceled, got %v", err)
+	}
+	close(release)
+	<-waiterDone
+}
+
+func TestFlightGroupRetriesContextErrors(t *testing.T) {
+	g := newFlightGroup()
+
+	// a call failing with a context error is not shared
+	failing := make(chan struct{})
+	go func() {
+		// nolint:errcheck
+		g.do(context.Background(), "key", func(context.Context) (interface{}, error) {
+			<-failing
+			return nil, context.DeadlineExceeded
+		})
+	}()
+	for {
+		g.mu.Lock()
+		call := g.calls["key"]
+		g.mu.Unlock()
+		if call != nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	result := make(chan interface{}, 1)
+	go func() {
+		val, _, err := g.do(context.Background(), "key", func(context.Context) (interface{}, error) {
+			return "retried", nil
+		})
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		result <- val
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(failing)
+
+	if val := <-result; val != "retried" {
+		t.Fatalf("Expected the waiter to call again, got %v", val)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	if newNegativeCache(0) != nil {
+		t.Fatalf("Expected a zero TTL to disable the negative cache")
+	}
+
+	nc := newNegativeCache(20 * time.Millisecond)
+	nc.add("missing")
+	if !nc.has("missing") {
+		t.Fatalf("Expected missing to be cached")
+	}
+	if nc.has("other") {
+		t.Fatalf("Unexpected cached entry")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if nc.has("missing") {
+		t.Fatalf("Expected missing to expire")
+	}
+}
+
+func TestIsNotFound(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		notFound bool
+	}{
+		{distribution.ErrTagUnknown{Tag: "latest"}, true},
+		{errcode.Errors{v2.ErrorCodeManifestUnknown.WithMessage("unknown")}, true},
+		{errcode.Errors{v2.ErrorCodeManifestUnknown, errcode.ErrorCodeUnauthorized}, false},
+		{errcode.ErrorCodeTooManyRequests.WithMessage("slow down"), false},
+		{errors.New("connection refused"), false},
+		{nil, false},
+	} {
+		if isNotFound(tc.err) != tc.notFound {
+			t.Errorf("Expected isNotFound(%v) to be %t", tc.err, tc.notFound)
+		}
+	}
+}
+
+func TestGetNegativeCache(t *testing.T) {
+	remoteDesc := distribution.Descriptor{Size: 42}
+	proxyTags := testProxyTagService(nil, map[string]distribution.Descriptor{"remote": remoteDesc})
+	proxyTags.flights = newFlightGroup()
+	proxyTags.negative = newNegativeCache(time.Minute)
+
+	remoteTags := &countingTagStore{TagService: proxyTags.remoteTags}
+	proxyTags.remoteTags = remoteTags
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := proxyTags.Get(ctx, "missing"); err == nil {
+			t.Fatalf("Expected an unknown tag error")
+		}
+	}
+	if remoteTags.gets != 1 {
+		t.Fatalf("Expected a single remote lookup of the missing tag, got %d", remoteTags.gets)
+	}
+	if proxyMetrics.tagMetrics.NegativeHits < 2 {
+		t.Fatalf("Expected negative cache hits to be tracked, got %d", proxyMetrics.tagMetrics.NegativeHits)
+	}
+
+	// known tags are looked up every time
+	for i := 0; i < 2; i++ {
+		desc, err := proxyTags.Get(ctx, "remote")
+		if err != nil || desc.Size != remoteDesc.Size {
+			t.Fatalf("Unexpected tag lookup result %v, %v", desc, err)
+		}
+	}
+	if remoteTags.gets != 3 {
+		t.Fatalf("Expected known tags to be looked up, got %d lookups", remoteTags.gets)
+	}
+}
+
+type countingTagStore struct {
+	distribution.TagService
+	gets int
+}
+
+func (c *countingTagStore) Get(ctx context.Context, tag string) (distribution.Descriptor, error) {
+	c.gets++
+	return c.TagService.Get(ctx, tag)
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/distribution/distribution/v3/internal/client/auth"
 	"github.com/distribution/distribution/v3/internal/client/auth/challenge"
@@ -17,12 +18,18 @@ type userpass struct {
 	password string
 }
 
+// credentials answers the challenges of the token authentication URLs of a
+// remote registry.
 type credentials struct {
-	creds map[string]userpass
+	authURLs map[string]struct{}
+	creds    *reloadingCredentials
 }
 
 func (c credentials) Basic(u *url.URL) (string, string) {
-	up := c.creds[u.String()]
+	if _, ok := c.authURLs[u.String()]; !ok {
+		return "", ""
+	}
+	up := c.creds.credentials()
 
 	return up.username, up.password
 }
@@ -34,24 +41,24 @@ func (c credentials) RefreshToken(u *url.URL, service string) string {
 func (c credentials) SetRefreshToken(u *url.URL, service, token string) {
 }
 
-// configureAuth stores credentials for challenge responses
-func configureAuth(username, password, remoteURL string) (auth.CredentialStore, error) {
-	creds := map[string]userpass{}
-
+// configureAuth stores credentials for challenge responses, which are read
+// from source and reloaded at the refresh interval
+func configureAuth(source credentialSource, refresh time.Duration, remoteURL string) (auth.CredentialStore, error) {
 	authURLs, err := getAuthURLs(remoteURL)
 	if err != nil {
 		return nil, err
 	}
 
+	creds := credentials{
+		authURLs: make(map[string]struct{}, len(authURLs)),
+		creds:    newReloadingCredentials(source, refresh),
+	}
 	for _, url := range authURLs {
 		dcontext.GetLogger(dcontext.Background()).Infof("Discovered token authentication URL: %s", url)
-		creds[url] = userpass{
-			username: username,
-			password: password,
-		}
+		creds.authURLs[url] = struct{}{}
 	}
 
-	return credentials{creds: creds}, nil
+	return creds, nil
 }
 
 func getAuthURLs(remoteURL string) ([]string, error) {
@@ -72,8 +79,9 @@ func getAuthURLs(remoteURL string) ([]string, error) {
 	return authURLs, nil
 }
 
-func ping(manager challenge.Manager, endpoint, versionHeader string) error {
-	resp, err := http.Get(endpoint)
+func ping(manager challenge.Manager, transport http.RoundTripper, endpoint, versionHeader string) error {
+	client := &http.Client{Transport: transport}
+	resp, err := client.Get(endpoint)
 	if err != nil {
 		return err
 	}
@@ -19,10 +19,11 @@ import (
 type proxyBlobStore struct {
 	localStore     distribution.BlobStore
 	remoteStore    distribution.BlobService
-	scheduler      *scheduler.TTLExpirationScheduler
+	scheduler      scheduler.Scheduler
 	ttl            *time.Duration
 	repositoryName reference.Named
 	authChallenger authChallenger
+	breaker        *circuitBreaker
 }
 
 var _ distribution.BlobStore = &proxyBlobStore{}
@@ -76,11 +77,34 @@ func (pbs *proxyBlobStore) serveLocal(ctx context.Context, w http.ResponseWriter
 		return false, nil
 	}
 
+	if pbs.breaker.isOpen() {
+		w.Header().Set("Warning", staleWarning)
+	}
+
 	proxyMetrics.BlobPush(uint64(localDesc.Size), true)
-	return true, pbs.localStore.ServeBlob(ctx, w, r, dgst)
+	if err := pbs.localStore.ServeBlob(ctx, w, r, dgst); err != nil {
+		return true, err
+	}
+
+	if pbs.scheduler != nil {
+		blobRef, err := reference.WithDigest(pbs.repositoryName, dgst)
+		if err != nil {
+			dcontext.GetLogger(ctx).Errorf("Error creating reference: %s", err)
+			return true, nil
+		}
+		if err := pbs.scheduler.AccessBlob(blobRef, localDesc.Size); err != nil {
+			dcontext.GetLogger(ctx).Errorf("Error recording blob access: %s", err)
+		}
+	}
+	return true, nil
 }
 
 func (pbs *proxyBlobStore) ServeBlob(ctx context.Context, w http.ResponseWriter, r *http.Request, dgst digest.Digest) error {
+	if pbs.scheduler != nil {
+		// the blob must not be evicted while it is being served
+		defer pbs.scheduler.Pin(dgst)()
+	}
+
 	served, err := pbs.serveLocal(ctx, w, r, dgst)
 	if err != nil {
 		dcontext.GetLogger(ctx).Errorf("Error serving blob from local storage: %s", err.Error())
@@ -145,6 +169,13 @@ func (pbs *proxyBlobStore) ServeBlob(ctx context.Context, w http.ResponseWriter,
 		}
 	}
 
+	if pbs.scheduler != nil {
+		if err := pbs.scheduler.AccessBlob(blobRef, desc.Size); err != nil {
+			dcontext.GetLogger(ctx).Errorf("Error recording blob access: %s", err)
+			return err
+		}
+	}
+
 	return nil
 }
 
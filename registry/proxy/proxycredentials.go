@@ -0,0 +1,244 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/internal/dcontext"
+)
+
+const (
+	defaultCredentialsRefresh = time.Minute
+	credentialHelperTimeout   = 30 * time.Second
+
+	// dockerHubServerAddress is the key of the Docker Hub credentials in
+	// docker config files and credential helpers.
+	dockerHubServerAddress = "https://index.docker.io/v1/"
+)
+
+// credentialSource reads the credentials of a remote registry.
+type credentialSource interface {
+	credentials() (userpass, error)
+}
+
+// newCredentialSource returns the source of the credentials of the remote
+// registry configured by config.
+func newCredentialSource(config configuration.ProxyRemote, remoteURL *url.URL) (credentialSource, error) {
+	creds := config.Credentials
+
+	var sources int
+	for _, set := range []bool{creds.DockerConfig != "", creds.Helper != "", creds.PasswordFile != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return nil, fmt.Errorf("proxy credentials of %s: only one of dockerconfig, helper and passwordfile may be set", config.RemoteURL)
+	}
+	if creds.UsernameFile != "" && creds.PasswordFile == "" {
+		return nil, fmt.Errorf("proxy credentials of %s: usernamefile requires passwordfile", config.RemoteURL)
+	}
+
+	serverAddress := remoteURL.Host
+	switch {
+	case creds.DockerConfig != "":
+		return dockerConfigCredentials{path: creds.DockerConfig, host: remoteURL.Host}, nil
+	case creds.Helper != "":
+		if isDockerHub(remoteURL.Host) {
+			serverAddress = dockerHubServerAddress
+		}
+		return helperCredentials{helper: creds.Helper, serverAddress: serverAddress}, nil
+	case creds.PasswordFile != "":
+		return fileCredentials{
+			username:     config.Username,
+			usernameFile: creds.UsernameFile,
+			passwordFile: creds.PasswordFile,
+		}, nil
+	default:
+		return staticCredentials{username: config.Username, password: config.Password}, nil
+	}
+}
+
+// staticCredentials are the username and password of the configuration.
+type staticCredentials userpass
+
+func (c staticCredentials) credentials() (userpass, error) {
+	return userpass(c), nil
+}
+
+// fileCredentials are read from files, such as mounted secrets which are
+// rotated on disk.
+type fileCredentials struct {
+	username     string
+	usernameFile string
+	passwordFile string
+}
+
+func (c fileCredentials) credentials() (userpass, error) {
+	up := userpass{username: c.username}
+	if c.usernameFile != "" {
+		p, err := os.ReadFile(c.usernameFile)
+		if err != nil {
+			return userpass{}, err
+		}
+		up.username = strings.TrimSpace(string(p))
+	}
+
+	p, err := os.ReadFile(c.passwordFile)
+	if err != nil {
+		return userpass{}, err
+	}
+	up.password = strings.TrimSpace(string(p))
+	return up, nil
+}
+
+// dockerConfigCredentials are read from a docker config.json, either from its
+// auths or from the credential helper it configures for the remote registry.
+type dockerConfigCredentials struct {
+	path string
+	host string
+}
+
+type dockerConfigFile struct {
+	Auths map[string]struct {
+		Auth     string `json:"auth"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"auths"`
+	CredHelpers map[string]string `json:"credHelpers"`
+	CredsStore  string            `json:"credsStore"`
+}
+
+func (c dockerConfigCredentials) credentials() (userpass, error) {
+	p, err := os.ReadFile(c.path)
+	if err != nil {
+		return userpass{}, err
+	}
+
+	var config dockerConfigFile
+	if err := json.Unmarshal(p, &config); err != nil {
+		return userpass{}, fmt.Errorf("invalid docker config %s: %v", c.path, err)
+	}
+
+	serverAddresses := []string{c.host, "https://" + c.host, "http://" + c.host}
+	if isDockerHub(c.host) {
+		serverAddresses = append([]string{dockerHubServerAddress}, serverAddresses...)
+	}
+
+	if helper, ok := config.CredHelpers[c.host]; ok {
+		return helperCredentials{helper: helper, serverAddress: serverAddresses[0]}.credentials()
+	}
+
+	for _, serverAddress := range serverAddresses {
+		entry, ok := config.Auths[serverAddress]
+		if !ok {
+			continue
+		}
+		if entry.Auth == "" {
+			return userpass{username: entry.Username, password: entry.Password}, nil
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return userpass{}, fmt.Errorf("invalid auth of %s in docker config %s: %v", serverAddress, c.path, err)
+		}
+		username, password, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			return userpass{}, fmt.Errorf("invalid auth of %s in docker config %s", serverAddress, c.path)
+		}
+		return userpass{username: username, password: password}, nil
+	}
+
+	if config.CredsStore != "" {
+		return helperCredentials{helper: config.CredsStore, serverAddress: serverAddresses[0]}.credentials()
+	}
+
+	// anonymous access
+	return userpass{}, nil
+}
+
+// helperCredentials are returned by a docker credential helper, the
+// docker-credential-<helper> executable, such as docker-credential-ecr-login.
+type helperCredentials struct {
+	helper        string
+	serverAddress string
+}
+
+func (c helperCredentials) credentials() (userpass, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), credentialHelperTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker-credential-"+c.helper, "get")
+	cmd.Stdin = strings.NewReader(c.serverAddress)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return userpass{}, fmt.Errorf("credential helper %s: %v: %s", c.helper, err, strings.TrimSpace(stdout.String()+stderr.String()))
+	}
+
+	var creds struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return userpass{}, fmt.Errorf("credential helper %s: invalid output: %v", c.helper, err)
+	}
+	return userpass{username: creds.Username, password: creds.Secret}, nil
+}
+
+func isDockerHub(host string) bool {
+	return host == "registry-1.docker.io" || host == "index.docker.io" || host == "docker.io"
+}
+
+// reloadingCredentials caches the credentials read from a source, and reads
+// them again once they are older than the refresh interval, so that rotated
+// credentials are used without restarting the registry.
+type reloadingCredentials struct {
+	source  credentialSource
+	refresh time.Duration
+
+	mu     sync.Mutex
+	cached userpass
+	loaded time.Time
+}
+
+func newReloadingCredentials(source credentialSource, refresh time.Duration) *reloadingCredentials {
+	if refresh <= 0 {
+		refresh = defaultCredentialsRefresh
+	}
+	return &reloadingCredentials{
+		source:  source,
+		refresh: refresh,
+	}
+}
+
+func (c *reloadingCredentials) credentials() userpass {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.loaded.IsZero() && time.Since(c.loaded) < c.refresh {
+		return c.cached
+	}
+
+	// failures are retried at the next refresh only, with the previous
+	// credentials, which may still be valid
+	c.loaded = time.Now()
+	up, err := c.source.credentials()
+	if err != nil {
+		dcontext.GetLogger(dcontext.Background()).Errorf("failed to load proxy credentials: %v", err)
+		return c.cached
+	}
+	c.cached = up
+	return up
+}
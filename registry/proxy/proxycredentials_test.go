@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+)
+
+func testCredentialSource(t *testing.T, config configuration.ProxyRemote) credentialSource {
+	t.Helper()
+
+	remoteURL, err := url.Parse(config.RemoteURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := newCredentialSource(config, remoteURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+func TestFileCredentialsRotated(t *testing.T) {
+	dir := t.TempDir()
+	usernameFile := filepath.Join(dir, "username")
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(usernameFile, []byte("user\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(passwordFile, []byte("first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	source := testCredentialSource(t, configuration.ProxyRemote{
+		RemoteURL: "https://registry.example.com",
+		Credentials: configuration.ProxyCredentials{
+			UsernameFile: usernameFile,
+			PasswordFile: passwordFile,
+		},
+	})
+	creds := newReloadingCredentials(source, 10*time.Millisecond)
+
+	if up := creds.credentials(); up.username != "user" || up.password != "first" {
+		t.Fatalf("unexpected credentials: %+v", up)
+	}
+
+	if err := os.WriteFile(passwordFile, []byte("second\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if up := creds.credentials(); up.password != "second" {
+		t.Fatalf("expected rotated password, got %q", up.password)
+	}
+
+	// the previous credentials are kept while the file is missing
+	if err := os.Remove(passwordFile); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if up := creds.credentials(); up.password != "second" {
+		t.Fatalf("expected previous password, got %q", up.password)
+	}
+}
+
+func TestDockerConfigCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	auth := base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	config := `{
+	"auths": {
+		"https://index.docker.io/v1/": {"auth": "` + auth + `"},
+		"registry.example.com": {"username": "other", "password": "password"}
+	}
+}`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		remoteURL string
+		expected  userpass
+	}{
+		{remoteURL: "https://registry-1.docker.io", expected: userpass{username: "user", password: "secret"}},
+		{remoteURL: "https://registry.example.com", expected: userpass{username: "other", password: "password"}},
+		{remoteURL: "https://unknown.example.com", expected: userpass{}},
+	} {
+		source := testCredentialSource(t, configuration.ProxyRemote{
+			RemoteURL:   tc.remoteURL,
+			Credentials: configuration.ProxyCredentials{DockerConfig: path},
+		})
+		up, err := source.credentials()
+		if err != nil {
+			t.Fatalf("%s: %v", tc.remoteURL, err)
+		}
+		if up != tc.expected {
+			t.Errorf("%s: expected %+v, got %+v", tc.remoteURL, tc.expected, up)
+		}
+	}
+}
+
+func TestHelperCredentials(t *testing.T) {
+	dir := t.TempDir()
+	script := `#!/bin/sh
+read server
+echo "{\"ServerURL\": \"$server\", \"Username\": \"helper\", \"Secret\": \"$server\"}"
+`
+	if err := os.WriteFile(filepath.Join(dir, "docker-credential-test"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	source := testCredentialSource(t, configuration.ProxyRemote{
+		RemoteURL:   "https://registry-1.docker.io",
+		Credentials: configuration.ProxyCredentials{Helper: "test"},
+	})
+	up, err := source.credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if up.username != "helper" || up.password != dockerHubServerAddress {
+		t.Fatalf("unexpected credentials: %+v", up)
+	}
+}
+
+func TestCredentialSourceInvalid(t *testing.T) {
+	remoteURL, _ := url.Parse("https://registry.example.com")
+	for _, creds := range []configuration.ProxyCredentials{
+		{DockerConfig: "config.json", Helper: "test"},
+		{Helper: "test", PasswordFile: "password"},
+		{UsernameFile: "username"},
+	} {
+		if _, err := newCredentialSource(configuration.ProxyRemote{RemoteURL: remoteURL.String(), Credentials: creds}, remoteURL); err == nil {
+			t.Errorf("expected an error for %+v", creds)
+		}
+	}
+}
@@ -17,9 +17,12 @@ type proxyManifestStore struct {
 	localManifests  distribution.ManifestService
 	remoteManifests distribution.ManifestService
 	repositoryName  reference.Named
-	scheduler       *scheduler.TTLExpirationScheduler
+	scheduler       scheduler.Scheduler
 	ttl             *time.Duration
 	authChallenger  authChallenger
+	breaker         *circuitBreaker
+	flights         *flightGroup
+	negative        *negativeCache
 }
 
 var _ distribution.ManifestService = &proxyManifestStore{}
@@ -35,12 +38,37 @@ func (pms proxyManifestStore) Exists(ctx context.Context, dgst digest.Digest) (b
 	if err := pms.authChallenger.tryEstablishChallenges(ctx); err != nil {
 		return false, err
 	}
-	return pms.remoteManifests.Exists(ctx, dgst)
+
+	key := pms.repositoryName.Name() + "@" + dgst.String()
+	if pms.negative.has(key) {
+		proxyMetrics.ManifestNegativeHit()
+		return false, nil
+	}
+
+	val, shared, err := pms.flights.do(ctx, "exists "+key, func(ctx context.Context) (interface{}, error) {
+		exists, err := pms.remoteManifests.Exists(ctx, dgst)
+		if err == nil && !exists {
+			pms.negative.add(key)
+		}
+		return exists, err
+	})
+	if shared {
+		proxyMetrics.ManifestCoalesced()
+	}
+	if err != nil {
+		return false, err
+	}
+	return val.(bool), nil
 }
 
 func (pms proxyManifestStore) Get(ctx context.Context, dgst digest.Digest, options ...distribution.ManifestServiceOption) (distribution.Manifest, error) {
 	// At this point `dgst` was either specified explicitly, or returned by the
 	// tagstore with the most recent association.
+	if pms.scheduler != nil {
+		// the manifest must not be evicted while it is being served
+		defer pms.scheduler.Pin(dgst)()
+	}
+
 	var fromRemote bool
 	manifest, err := pms.localManifests.Get(ctx, dgst, options...)
 	if err != nil {
@@ -48,11 +76,16 @@ func (pms proxyManifestStore) Get(ctx context.Context, dgst digest.Digest, optio
 			return nil, err
 		}
 
-		manifest, err = pms.remoteManifests.Get(ctx, dgst, options...)
+		var shared bool
+		manifest, shared, err = pms.getRemote(ctx, dgst, options...)
 		if err != nil {
 			return nil, err
 		}
-		fromRemote = true
+		// a coalesced request is served the manifest pulled by the request
+		// in flight
+		fromRemote = !shared
+	} else if pms.breaker.isOpen() {
+		setStaleWarning(ctx)
 	}
 
 	_, payload, err := manifest.Payload()
@@ -61,34 +94,82 @@ func (pms proxyManifestStore) Get(ctx context.Context, dgst digest.Digest, optio
 	}
 
 	proxyMetrics.ManifestPush(uint64(len(payload)), !fromRemote)
-	if fromRemote {
-		proxyMetrics.ManifestPull(uint64(len(payload)))
 
-		_, err = pms.localManifests.Put(ctx, manifest)
-		if err != nil {
-			return nil, err
-		}
-
-		// Schedule the manifest blob for removal
+	if pms.scheduler != nil {
 		repoBlob, err := reference.WithDigest(pms.repositoryName, dgst)
 		if err != nil {
 			dcontext.GetLogger(ctx).Errorf("Error creating reference: %s", err)
 			return nil, err
 		}
 
-		if pms.scheduler != nil && pms.ttl != nil {
-			if err := pms.scheduler.AddManifest(repoBlob, *pms.ttl); err != nil {
-				dcontext.GetLogger(ctx).Errorf("Error adding manifest: %s", err)
+		if err := pms.scheduler.AccessManifest(repoBlob, int64(len(payload))); err != nil {
+			dcontext.GetLogger(ctx).Errorf("Error recording manifest access: %s", err)
+			if fromRemote {
 				return nil, err
 			}
 		}
+	}
 
-		// Ensure the manifest blob is cleaned up
-		// pms.scheduler.AddBlob(blobRef, repositoryTTL)
+	return manifest, err
+}
 
+// getRemote gets the manifest from the remote registry and caches it.
+// Concurrent requests of the same manifest are coalesced, and a manifest
+// unknown to the remote registry is not requested again for a while.
+func (pms proxyManifestStore) getRemote(ctx context.Context, dgst digest.Digest, options ...distribution.ManifestServiceOption) (distribution.Manifest, bool, error) {
+	key := pms.repositoryName.Name() + "@" + dgst.String()
+	if pms.negative.has(key) {
+		proxyMetrics.ManifestNegativeHit()
+		return nil, false, distribution.ErrManifestUnknownRevision{Name: pms.repositoryName.Name(), Revision: dgst}
 	}
 
-	return manifest, err
+	// the manifest is cached by the call in flight, as the request which
+	// sent it may be gone once it completes
+	val, shared, err := pms.flights.do(ctx, "manifest "+key, func(ctx context.Context) (interface{}, error) {
+		manifest, err := pms.remoteManifests.Get(ctx, dgst, options...)
+		if err != nil {
+			if isNotFound(err) {
+				pms.negative.add(key)
+			}
+			return nil, err
+		}
+		return manifest, pms.cache(ctx, dgst, manifest)
+	})
+	if shared {
+		proxyMetrics.ManifestCoalesced()
+	}
+	if err != nil {
+		return nil, shared, err
+	}
+	return val.(distribution.Manifest), shared, nil
+}
+
+// cache stores the manifest pulled from the remote registry, and schedules
+// its removal.
+func (pms proxyManifestStore) cache(ctx context.Context, dgst digest.Digest, manifest distribution.Manifest) error {
+	_, payload, err := manifest.Payload()
+	if err != nil {
+		return err
+	}
+	proxyMetrics.ManifestPull(uint64(len(payload)))
+
+	if _, err := pms.localManifests.Put(ctx, manifest); err != nil {
+		return err
+	}
+
+	if pms.scheduler != nil && pms.ttl != nil {
+		// Schedule the manifest blob for removal
+		repoBlob, err := reference.WithDigest(pms.repositoryName, dgst)
+		if err != nil {
+			dcontext.GetLogger(ctx).Errorf("Error creating reference: %s", err)
+			return err
+		}
+		if err := pms.scheduler.AddManifest(repoBlob, *pms.ttl); err != nil {
+			dcontext.GetLogger(ctx).Errorf("Error adding manifest: %s", err)
+			return err
+		}
+	}
+	return nil
 }
 
 func (pms proxyManifestStore) Put(ctx context.Context, manifest distribution.Manifest, options ...distribution.ManifestServiceOption) (digest.Digest, error) {
@@ -5,6 +5,7 @@ import (
 	"context"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/internal/client/auth"
@@ -331,3 +332,60 @@ func TestProxyManifestsMetrics(t *testing.T) {
 		t.Errorf("Expected manifestMetrics.BytesPushed %d but got %d", 514, proxyMetrics.manifestMetrics.BytesPushed)
 	}
 }
+
+// blockingManifests blocks getting manifests until released.
+type blockingManifests struct {
+	distribution.ManifestService
+	started chan struct{}
+	release chan struct{}
+}
+
+func (bm blockingManifests) Get(ctx context.Context, dgst digest.Digest, options ...distribution.ManifestServiceOption) (distribution.Manifest, error) {
+	close(bm.started)
+	<-bm.release
+	return bm.ManifestService.Get(ctx, dgst, options...)
+}
+
+func TestProxyManifestsCachedWhenFirstRequestCanceled(t *testing.T) {
+	env := newManifestStoreTestEnv(t, "foo/bar", "latest")
+	remote := blockingManifests{
+		ManifestService: env.manifests.remoteManifests,
+		started:         make(chan struct{}),
+		release:         make(chan struct{}),
+	}
+	env.manifests.remoteManifests = remote
+	env.manifests.flights = newFlightGroup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := env.manifests.Get(ctx, env.manifestDigest)
+		first <- err
+	}()
+	<-remote.started
+
+	second := make(chan error)
+	go func() {
+		_, err := env.manifests.Get(context.Background(), env.manifestDigest)
+		second <- err
+	}()
+	// let the second request join the call in flight
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Fatalf("expected the first request to be canceled, got %v", err)
+	}
+	close(remote.release)
+	if err := <-second; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	exists, err := env.manifests.localManifests.Exists(context.Background(), env.manifestDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("expected the manifest to be cached")
+	}
+}
@@ -19,6 +19,10 @@ var (
 	pulledBytes = prometheus.ProxyNamespace.NewLabeledCounter("pulled_bytes", "The size of total bytes pulled from the upstream", "type")
 	// pushedBytes is the size of total bytes pushed to the client for blob/manifest
 	pushedBytes = prometheus.ProxyNamespace.NewLabeledCounter("pushed_bytes", "The size of total bytes pushed to the client", "type")
+	// coalesced is the number of total upstream requests for manifest/tag coalesced with an identical request in flight
+	coalesced = prometheus.ProxyNamespace.NewLabeledCounter("coalesced_requests", "The number of total upstream requests coalesced with an identical request in flight", "type")
+	// negativeHits is the number of total lookups for manifest/tag answered from the cache of content unknown to the upstream
+	negativeHits = prometheus.ProxyNamespace.NewLabeledCounter("negative_cache_hits", "The number of total lookups answered from the cache of content unknown to the upstream", "type")
 )
 
 // Metrics is used to hold metric counters
@@ -29,11 +33,19 @@ type Metrics struct {
 	Misses      uint64
 	BytesPulled uint64
 	BytesPushed uint64
+
+	// Coalesced is the number of upstream requests coalesced with an
+	// identical request in flight
+	Coalesced uint64
+	// NegativeHits is the number of lookups answered from the cache of
+	// content unknown to the upstream
+	NegativeHits uint64
 }
 
 type proxyMetricsCollector struct {
 	blobMetrics     Metrics
 	manifestMetrics Metrics
+	tagMetrics      Metrics
 }
 
 // proxyMetrics tracks metrics about the proxy cache.  This is
@@ -61,9 +73,17 @@ func init() {
 		return proxyMetrics.manifestMetrics
 	}))
 
+	pm.(*expvar.Map).Set("tags", expvar.Func(func() interface{} {
+		return proxyMetrics.tagMetrics
+	}))
+
 	metrics.Register(prometheus.ProxyNamespace)
 	initPrometheusMetrics("blob")
 	initPrometheusMetrics("manifest")
+	for _, value := range []string{"manifest", "tag"} {
+		coalesced.WithValues(value).Inc(0)
+		negativeHits.WithValues(value).Inc(0)
+	}
 }
 
 func initPrometheusMetrics(value string) {
@@ -121,3 +141,33 @@ func (pmc *proxyMetricsCollector) ManifestPush(bytesPushed uint64, isHit bool) {
 		hits.WithValues("manifest").Inc(1)
 	}
 }
+
+// ManifestCoalesced tracks manifest requests coalesced with an identical
+// request to the upstream in flight
+func (pmc *proxyMetricsCollector) ManifestCoalesced() {
+	atomic.AddUint64(&pmc.manifestMetrics.Coalesced, 1)
+
+	coalesced.WithValues("manifest").Inc(1)
+}
+
+// ManifestNegativeHit tracks manifest lookups answered from the negative cache
+func (pmc *proxyMetricsCollector) ManifestNegativeHit() {
+	atomic.AddUint64(&pmc.manifestMetrics.NegativeHits, 1)
+
+	negativeHits.WithValues("manifest").Inc(1)
+}
+
+// TagCoalesced tracks tag lookups coalesced with an identical lookup to the
+// upstream in flight
+func (pmc *proxyMetricsCollector) TagCoalesced() {
+	atomic.AddUint64(&pmc.tagMetrics.Coalesced, 1)
+
+	coalesced.WithValues("tag").Inc(1)
+}
+
+// TagNegativeHit tracks tag lookups answered from the negative cache
+func (pmc *proxyMetricsCollector) TagNegativeHit() {
+	atomic.AddUint64(&pmc.tagMetrics.NegativeHits, 1)
+
+	negativeHits.WithValues("tag").Inc(1)
+}
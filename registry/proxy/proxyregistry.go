@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,38 +25,117 @@ import (
 
 var repositoryTTL = 24 * 7 * time.Hour
 
-// proxyingRegistry fetches content from a remote registry and caches it locally
+// proxyingRegistry fetches content from remote registries and caches it locally
 type proxyingRegistry struct {
-	embedded       distribution.Namespace // provides local registry functionality
-	scheduler      *scheduler.TTLExpirationScheduler
-	ttl            *time.Duration
+	embedded  distribution.Namespace // provides local registry functionality
+	scheduler scheduler.Scheduler
+	remotes   []*remote // sorted by decreasing length of prefix
+}
+
+// remote is an upstream registry serving the repositories whose name starts
+// with prefix, under their name without that prefix.
+type remote struct {
+	prefix         string
 	remoteURL      url.URL
+	ttl            *time.Duration
 	authChallenger authChallenger
+	breaker        *circuitBreaker
+	transport      http.RoundTripper
+	flights        *flightGroup
+	negative       *negativeCache
+	tagLists       *tagListCache
+}
+
+// Option configures a pull through cache.
+type Option func(*options)
+
+type options struct {
+	scheduler        scheduler.Scheduler
+	disableScheduler bool
+	expiryRegistry   distribution.Namespace
+}
+
+// WithScheduler expires the cached content through s, instead of a scheduler
+// storing its state in the storage driver.
+func WithScheduler(s scheduler.Scheduler) Option {
+	return func(o *options) {
+		o.scheduler = s
+	}
+}
+
+// WithoutScheduler does not expire the cached content, for processes sharing
+// the storage of a registry whose scheduler state they must not overwrite,
+// when the cached content does not expire anyway.
+func WithoutScheduler() Option {
+	return func(o *options) {
+		o.disableScheduler = true
+	}
+}
+
+// WithExpiryRegistry deletes the expired content through the repositories of
+// registry, which must be backed by the embedded registry, such as to dispatch
+// events of the deletions.
+func WithExpiryRegistry(registry distribution.Namespace) Option {
+	return func(o *options) {
+		o.expiryRegistry = registry
+	}
 }
 
 // NewRegistryPullThroughCache creates a registry acting as a pull through cache
-func NewRegistryPullThroughCache(ctx context.Context, registry distribution.Namespace, driver driver.StorageDriver, config configuration.Proxy) (distribution.Namespace, error) {
-	remoteURL, err := url.Parse(config.RemoteURL)
-	if err != nil {
-		return nil, err
+func NewRegistryPullThroughCache(ctx context.Context, registry distribution.Namespace, driver driver.StorageDriver, config configuration.Proxy, opts ...Option) (distribution.Namespace, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	remoteConfigs := config.Remotes
+	if config.RemoteURL != "" {
+		// the top level remote serves the repositories no other remote does
+		remoteConfigs = append(remoteConfigs, configuration.ProxyRemote{
+			RemoteURL:   config.RemoteURL,
+			Username:    config.Username,
+			Password:    config.Password,
+			Credentials: config.Credentials,
+			TTL:         config.TTL,
+		})
+	}
+
+	var remotes []*remote
+	prefixes := make(map[string]struct{}, len(remoteConfigs))
+	for _, remoteConfig := range remoteConfigs {
+		r, err := newRemote(remoteConfig, config)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := prefixes[r.prefix]; ok {
+			return nil, fmt.Errorf("proxy remotes: duplicate prefix %q", r.prefix)
+		}
+		prefixes[r.prefix] = struct{}{}
+		remotes = append(remotes, r)
 	}
+	sort.SliceStable(remotes, func(i, j int) bool {
+		return len(remotes[i].prefix) > len(remotes[j].prefix)
+	})
 
 	v := storage.NewVacuum(ctx, driver)
 
-	var s *scheduler.TTLExpirationScheduler
-	var ttl *time.Duration
-	if config.TTL == nil {
-		// Default TTL is 7 days
-		ttl = &repositoryTTL
-	} else if *config.TTL > 0 {
-		ttl = config.TTL
-	} else {
-		// TTL is disabled, never expire
-		ttl = nil
+	expiryRegistry := o.expiryRegistry
+	if expiryRegistry == nil {
+		expiryRegistry = registry
+	}
+
+	if config.MaxSize < 0 {
+		return nil, fmt.Errorf("proxy maxsize must not be negative: %d", config.MaxSize)
 	}
 
-	if ttl != nil {
-		s = scheduler.New(ctx, driver, "/scheduler-state.json")
+	// content of all remotes expires through a single scheduler
+	var s scheduler.Scheduler
+	if Expires(config) && !o.disableScheduler {
+		s = o.scheduler
+		if s == nil {
+			s = scheduler.New(ctx, driver, "/scheduler-state.json")
+		}
+		s.SetMaxSize(config.MaxSize)
 		s.OnBlobExpire(func(ref reference.Reference) error {
 			var r reference.Canonical
 			var ok bool
@@ -62,7 +143,7 @@ func NewRegistryPullThroughCache(ctx context.Context, registry distribution.Name
 				return fmt.Errorf("unexpected reference type : %T", ref)
 			}
 
-			repo, err := registry.Repository(ctx, r)
+			repo, err := expiryRegistry.Repository(ctx, r)
 			if err != nil {
 				return err
 			}
@@ -90,7 +171,7 @@ func NewRegistryPullThroughCache(ctx context.Context, registry distribution.Name
 				return fmt.Errorf("unexpected reference type : %T", ref)
 			}
 
-			repo, err := registry.Repository(ctx, r)
+			repo, err := expiryRegistry.Repository(ctx, r)
 			if err != nil {
 				return err
 			}
@@ -106,30 +187,123 @@ func NewRegistryPullThroughCache(ctx context.Context, registry distribution.Name
 			return nil
 		})
 
-		err = s.Start()
+		err := s.Start()
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	cs, err := configureAuth(config.Username, config.Password, config.RemoteURL)
+	return &proxyingRegistry{
+		embedded:  registry,
+		scheduler: s,
+		remotes:   remotes,
+	}, nil
+}
+
+// Expires returns whether the content cached by a pull through cache with the
+// configuration expires, after the ttl of its remote or once the cache exceeds
+// its maximum size.
+func Expires(config configuration.Proxy) bool {
+	if config.MaxSize > 0 {
+		return true
+	}
+	ttls := make([]*time.Duration, 0, len(config.Remotes)+1)
+	for _, remoteConfig := range config.Remotes {
+		ttls = append(ttls, remoteConfig.TTL)
+	}
+	if config.RemoteURL != "" {
+		ttls = append(ttls, config.TTL)
+	}
+	for _, ttl := range ttls {
+		// the ttl defaults to repositoryTTL
+		if ttl == nil || *ttl > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// newRemote configures the upstream registry of a pull through cache.
+func newRemote(config configuration.ProxyRemote, proxyConfig configuration.Proxy) (*remote, error) {
+	remoteURL, err := url.Parse(config.RemoteURL)
 	if err != nil {
 		return nil, err
 	}
 
-	return &proxyingRegistry{
-		embedded:  registry,
-		scheduler: s,
-		ttl:       ttl,
+	prefix := config.Prefix
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	var ttl *time.Duration
+	if config.TTL == nil {
+		// Default TTL is 7 days
+		ttl = &repositoryTTL
+	} else if *config.TTL > 0 {
+		ttl = config.TTL
+	} else {
+		// TTL is disabled, never expire
+		ttl = nil
+	}
+
+	negativeTTL := defaultNegativeCacheTTL
+	if proxyConfig.NegativeCacheTTL != nil {
+		negativeTTL = *proxyConfig.NegativeCacheTTL
+	}
+
+	var breaker *circuitBreaker
+	transport := http.DefaultTransport
+	if breakerConfig := proxyConfig.CircuitBreaker; !breakerConfig.Disabled {
+		breaker = newCircuitBreaker(breakerConfig.Threshold, breakerConfig.Cooldown)
+		transport = &circuitBreakerTransport{base: transport, breaker: breaker}
+	}
+
+	source, err := newCredentialSource(config, remoteURL)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := configureAuth(source, config.Credentials.Refresh, config.RemoteURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &remote{
+		prefix:    prefix,
 		remoteURL: *remoteURL,
+		ttl:       ttl,
 		authChallenger: &remoteAuthChallenger{
 			remoteURL: *remoteURL,
+			transport: transport,
 			cm:        challenge.NewSimpleManager(),
 			cs:        cs,
 		},
+		breaker:   breaker,
+		transport: transport,
+		flights:   newFlightGroup(),
+		negative:  newNegativeCache(negativeTTL),
+		tagLists:  newTagListCache(proxyConfig.TagListTTL),
 	}, nil
 }
 
+// remoteFor returns the remote serving the named repository, along with the
+// name of the repository in that remote, or nil if no remote serves it.
+func (pr *proxyingRegistry) remoteFor(name reference.Named) (*remote, reference.Named, error) {
+	for _, r := range pr.remotes {
+		if !strings.HasPrefix(name.Name(), r.prefix) {
+			continue
+		}
+		if r.prefix == "" {
+			return r, name, nil
+		}
+		remoteName, err := reference.WithName(strings.TrimPrefix(name.Name(), r.prefix))
+		if err != nil {
+			return nil, nil, err
+		}
+		return r, remoteName, nil
+	}
+	return nil, nil, nil
+}
+
 func (pr *proxyingRegistry) Scope() distribution.Scope {
 	return distribution.GlobalScope
 }
@@ -139,21 +313,28 @@ func (pr *proxyingRegistry) Repositories(ctx context.Context, repos []string, la
 }
 
 func (pr *proxyingRegistry) Repository(ctx context.Context, name reference.Named) (distribution.Repository, error) {
-	c := pr.authChallenger
+	r, remoteName, err := pr.remoteFor(name)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, distribution.ErrRepositoryUnknown{Name: name.Name()}
+	}
+	c := r.authChallenger
 
 	tkopts := auth.TokenHandlerOptions{
-		Transport:   http.DefaultTransport,
+		Transport:   r.transport,
 		Credentials: c.credentialStore(),
 		Scopes: []auth.Scope{
 			auth.RepositoryScope{
-				Repository: name.Name(),
+				Repository: remoteName.Name(),
 				Actions:    []string{"pull"},
 			},
 		},
 		Logger: dcontext.GetLogger(ctx),
 	}
 
-	tr := transport.NewTransport(http.DefaultTransport,
+	tr := transport.NewTransport(r.transport,
 		auth.NewAuthorizer(c.challengeManager(),
 			auth.NewTokenHandlerWithOptions(tkopts)))
 
@@ -166,7 +347,7 @@ func (pr *proxyingRegistry) Repository(ctx context.Context, name reference.Named
 		return nil, err
 	}
 
-	remoteRepo, err := client.NewRepository(name, pr.remoteURL.String(), tr)
+	remoteRepo, err := client.NewRepository(remoteName, r.remoteURL.String(), tr)
 	if err != nil {
 		return nil, err
 	}
@@ -181,9 +362,10 @@ func (pr *proxyingRegistry) Repository(ctx context.Context, name reference.Named
 			localStore:     localRepo.Blobs(ctx),
 			remoteStore:    remoteRepo.Blobs(ctx),
 			scheduler:      pr.scheduler,
-			ttl:            pr.ttl,
+			ttl:            r.ttl,
 			repositoryName: name,
-			authChallenger: pr.authChallenger,
+			authChallenger: c,
+			breaker:        r.breaker,
 		},
 		manifests: &proxyManifestStore{
 			repositoryName:  name,
@@ -191,14 +373,21 @@ func (pr *proxyingRegistry) Repository(ctx context.Context, name reference.Named
 			remoteManifests: remoteManifests,
 			ctx:             ctx,
 			scheduler:       pr.scheduler,
-			ttl:             pr.ttl,
-			authChallenger:  pr.authChallenger,
+			ttl:             r.ttl,
+			authChallenger:  c,
+			breaker:         r.breaker,
+			flights:         r.flights,
+			negative:        r.negative,
 		},
 		name: name,
-		tags: &proxyTagService{
+		tags: proxyTagService{
 			localTags:      localRepo.Tags(ctx),
 			remoteTags:     remoteRepo.Tags(ctx),
-			authChallenger: pr.authChallenger,
+			authChallenger: c,
+			repositoryName: name,
+			flights:        r.flights,
+			negative:       r.negative,
+			tagLists:       r.tagLists,
 		},
 	}, nil
 }
@@ -220,6 +409,7 @@ type authChallenger interface {
 
 type remoteAuthChallenger struct {
 	remoteURL url.URL
+	transport http.RoundTripper
 	sync.Mutex
 	cm challenge.Manager
 	cs auth.CredentialStore
@@ -250,7 +440,7 @@ func (r *remoteAuthChallenger) tryEstablishChallenges(ctx context.Context) error
 	}
 
 	// establish challenge type with upstream
-	if err := ping(r.cm, remoteURL.String(), challengeHeader); err != nil {
+	if err := ping(r.cm, r.transport, remoteURL.String(), challengeHeader); err != nil {
 		return err
 	}
 
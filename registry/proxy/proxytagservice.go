@@ -2,26 +2,38 @@ package proxy
 
 import (
 	"context"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/distribution/distribution/v3"
+	"github.com/distribution/reference"
 )
 
+// maxTagListCacheEntries bounds the number of repositories whose remote tag
+// list is cached.
+const maxTagListCacheEntries = 1000
+
 // proxyTagService supports local and remote lookup of tags.
 type proxyTagService struct {
 	localTags      distribution.TagService
 	remoteTags     distribution.TagService
 	authChallenger authChallenger
+	repositoryName reference.Named
+	flights        *flightGroup
+	negative       *negativeCache
+	tagLists       *tagListCache
 }
 
 var _ distribution.TagService = proxyTagService{}
 
 // Get attempts to get the most recent digest for the tag by checking the remote
 // tag service first and then caching it locally.  If the remote is unavailable
-// the local association is returned
+// the local association is returned, and the response is marked as stale.
 func (pt proxyTagService) Get(ctx context.Context, tag string) (distribution.Descriptor, error) {
 	err := pt.authChallenger.tryEstablishChallenges(ctx)
 	if err == nil {
-		desc, err := pt.remoteTags.Get(ctx, tag)
+		desc, err := pt.getRemote(ctx, tag)
 		if err == nil {
 			err := pt.localTags.Tag(ctx, tag, desc)
 			if err != nil {
@@ -35,9 +47,40 @@ func (pt proxyTagService) Get(ctx context.Context, tag string) (distribution.Des
 	if err != nil {
 		return distribution.Descriptor{}, err
 	}
+	setStaleWarning(ctx)
 	return desc, nil
 }
 
+// getRemote looks up the tag in the remote registry. Concurrent lookups of
+// the same tag are coalesced, and a tag unknown to the remote registry is not
+// looked up again for a while.
+func (pt proxyTagService) getRemote(ctx context.Context, tag string) (distribution.Descriptor, error) {
+	if pt.flights == nil {
+		return pt.remoteTags.Get(ctx, tag)
+	}
+
+	key := pt.repositoryName.Name() + ":" + tag
+	if pt.negative.has(key) {
+		proxyMetrics.TagNegativeHit()
+		return distribution.Descriptor{}, distribution.ErrTagUnknown{Tag: tag}
+	}
+
+	val, shared, err := pt.flights.do(ctx, "tag "+key, func(ctx context.Context) (interface{}, error) {
+		desc, err := pt.remoteTags.Get(ctx, tag)
+		if isNotFound(err) {
+			pt.negative.add(key)
+		}
+		return desc, err
+	})
+	if shared {
+		proxyMetrics.TagCoalesced()
+	}
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+	return val.(distribution.Descriptor), nil
+}
+
 func (pt proxyTagService) Tag(ctx context.Context, tag string, desc distribution.Descriptor) error {
 	return distribution.ErrUnsupported
 }
@@ -50,17 +93,131 @@ func (pt proxyTagService) Untag(ctx context.Context, tag string) error {
 	return nil
 }
 
+// All returns the tags of the remote repository merged with the tags cached
+// locally. If the remote is unavailable, the tags it last listed are used, and
+// the response is marked as stale.
 func (pt proxyTagService) All(ctx context.Context) ([]string, error) {
+	remoteTags, err := pt.allRemote(ctx)
+	if err != nil {
+		return pt.localTags.All(ctx)
+	}
+
+	localTags, err := pt.localTags.All(ctx)
+	if err != nil {
+		if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+			return nil, err
+		}
+	}
+
+	tags := make([]string, 0, len(remoteTags)+len(localTags))
+	seen := make(map[string]struct{}, len(remoteTags)+len(localTags))
+	for _, list := range [][]string{remoteTags, localTags} {
+		for _, tag := range list {
+			if _, ok := seen[tag]; !ok {
+				seen[tag] = struct{}{}
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// allRemote lists the tags of the remote repository. The list is cached, and
+// not requested again from the remote while it is fresh.
+func (pt proxyTagService) allRemote(ctx context.Context) ([]string, error) {
+	key := pt.repositoryName.Name()
+	if tags, fresh, ok := pt.tagLists.get(key); ok && fresh {
+		return tags, nil
+	}
+
 	err := pt.authChallenger.tryEstablishChallenges(ctx)
 	if err == nil {
-		tags, err := pt.remoteTags.All(ctx)
-		if err == nil {
+		var val interface{}
+		var shared bool
+		val, shared, err = pt.flights.do(ctx, "tags "+key, func(ctx context.Context) (interface{}, error) {
+			tags, err := pt.remoteTags.All(ctx)
+			if err == nil {
+				pt.tagLists.put(key, tags)
+			}
 			return tags, err
+		})
+		if shared {
+			proxyMetrics.TagCoalesced()
+		}
+		if err == nil {
+			return val.([]string), nil
 		}
 	}
-	return pt.localTags.All(ctx)
+
+	if tags, _, ok := pt.tagLists.get(key); ok {
+		setStaleWarning(ctx)
+		return tags, nil
+	}
+	return nil, err
 }
 
 func (pt proxyTagService) Lookup(ctx context.Context, digest distribution.Descriptor) ([]string, error) {
 	return []string{}, distribution.ErrUnsupported
 }
+
+// tagListCache caches the tag lists of remote repositories.
+//
+// A nil tagListCache caches nothing.
+type tagListCache struct {
+	ttl time.Duration
+
+	mu    sync.Mutex
+	lists map[string]tagList
+}
+
+type tagList struct {
+	tags    []string
+	fetched time.Time
+}
+
+func newTagListCache(ttl time.Duration) *tagListCache {
+	return &tagListCache{
+		ttl:   ttl,
+		lists: make(map[string]tagList),
+	}
+}
+
+// get returns the cached tag list of the repository, and whether it was
+// fetched within the freshness window.
+func (c *tagListCache) get(name string) ([]string, bool, bool) {
+	if c == nil {
+		return nil, false, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	list, ok := c.lists[name]
+	if !ok {
+		return nil, false, false
+	}
+	return list.tags, time.Since(list.fetched) < c.ttl, true
+}
+
+// put caches the tag list of the repository.
+func (c *tagListCache) put(name string, tags []string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.lists[name]; !ok && len(c.lists) >= maxTagListCacheEntries {
+		// evict an arbitrary repository
+		for evicted := range c.lists {
+			delete(c.lists, evicted)
+			break
+		}
+	}
+	c.lists[name] = tagList{
+		tags:    tags,
+		fetched: time.Now(),
+	}
+}
@@ -2,12 +2,16 @@ package proxy
 
 import (
 	"context"
+	"net/http/httptest"
 	"reflect"
 	"sort"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/internal/dcontext"
+	"github.com/distribution/reference"
 )
 
 type mockTagStore struct {
@@ -64,10 +68,12 @@ func testProxyTagService(local, remote map[string]distribution.Descriptor) *prox
 	if remote == nil {
 		remote = make(map[string]distribution.Descriptor)
 	}
+	name, _ := reference.WithName("foo/bar")
 	return &proxyTagService{
 		localTags:      &mockTagStore{mapping: local},
 		remoteTags:     &mockTagStore{mapping: remote},
 		authChallenger: &mockChallenger{},
+		repositoryName: name,
 	}
 }
 
@@ -175,3 +181,89 @@ func TestGet(t *testing.T) {
 		t.Fatalf("Expected 4 auth challenge calls, got %#v", proxyTags.authChallenger)
 	}
 }
+
+func TestGetStale(t *testing.T) {
+	localDesc := distribution.Descriptor{Size: 42}
+	proxyTags := testProxyTagService(map[string]distribution.Descriptor{"local": localDesc}, nil)
+
+	recorder := httptest.NewRecorder()
+	ctx, _ := dcontext.WithResponseWriter(context.Background(), recorder)
+
+	// the tag is unknown to the remote, the local association is served
+	d, err := proxyTags.Get(ctx, "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(d, localDesc) {
+		t.Fatalf("unexpected descriptor: %v", d)
+	}
+	if warning := recorder.Header().Get("Warning"); warning != staleWarning {
+		t.Fatalf("expected stale warning, got %q", warning)
+	}
+}
+
+// unavailableTagStore is a remote tag service whose registry is unavailable.
+type unavailableTagStore struct {
+	distribution.TagService
+}
+
+func (unavailableTagStore) All(ctx context.Context) ([]string, error) {
+	return nil, errCircuitOpen
+}
+
+func TestAllMerged(t *testing.T) {
+	proxyTags := testProxyTagService(
+		map[string]distribution.Descriptor{"cached": {Size: 1}, "v1": {Size: 2}},
+		map[string]distribution.Descriptor{"v1": {Size: 2}, "v2": {Size: 3}},
+	)
+	proxyTags.tagLists = newTagListCache(time.Minute)
+
+	ctx := context.Background()
+	all, err := proxyTags.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(all, []string{"cached", "v1", "v2"}) {
+		t.Fatalf("Unexpected tags returned from All(): %v", all)
+	}
+
+	// the remote list is not requested again while it is fresh
+	if err := proxyTags.remoteTags.Tag(ctx, "v3", distribution.Descriptor{Size: 4}); err != nil {
+		t.Fatal(err)
+	}
+	all, err = proxyTags.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(all, []string{"cached", "v1", "v2"}) {
+		t.Fatalf("Expected the cached remote tag list, got %v", all)
+	}
+	if proxyTags.authChallenger.(*mockChallenger).count != 1 {
+		t.Fatalf("Expected 1 auth challenge call, got %#v", proxyTags.authChallenger)
+	}
+
+	// once stale, the remote list is requested again
+	proxyTags.tagLists.ttl = 0
+	all, err = proxyTags.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(all, []string{"cached", "v1", "v2", "v3"}) {
+		t.Fatalf("Expected the remote tag list to be refreshed, got %v", all)
+	}
+
+	// the last remote list is served while the remote is unavailable
+	proxyTags.remoteTags = unavailableTagStore{}
+	recorder := httptest.NewRecorder()
+	ctx, _ = dcontext.WithResponseWriter(ctx, recorder)
+	all, err = proxyTags.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(all, []string{"cached", "v1", "v2", "v3"}) {
+		t.Fatalf("Expected the last remote tag list, got %v", all)
+	}
+	if warning := recorder.Header().Get("Warning"); warning != staleWarning {
+		t.Fatalf("expected stale warning, got %q", warning)
+	}
+}
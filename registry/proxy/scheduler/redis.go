@@ -0,0 +1,493 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3/internal/dcontext"
+	"github.com/distribution/reference"
+	"github.com/google/uuid"
+	"github.com/opencontainers/go-digest"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRedisLease = time.Minute
+	redisPollInterval = time.Second
+	redisBatchSize    = 100
+
+	// redisPinTimeout bounds the time content remains pinned by a registry
+	// instance which stopped without unpinning it.
+	redisPinTimeout = time.Hour
+
+	redisKeyPrefix   = "registry:proxy:scheduler:"
+	redisExpiriesKey = redisKeyPrefix + "expiries"
+	redisAccessedKey = redisKeyPrefix + "accessed"
+	redisSizeKey     = redisKeyPrefix + "size"
+)
+
+var (
+	// redisAccessScript records the size and access time of an entry, and
+	// returns the total size of the entries.
+	redisAccessScript = redis.NewScript(`
+local old = tonumber(redis.call("HGET", KEYS[1], "size") or "0")
+redis.call("HSET", KEYS[1], "type", ARGV[1], "size", ARGV[2], "accessed", ARGV[3])
+redis.call("ZADD", KEYS[2], ARGV[3], ARGV[4])
+return redis.call("INCRBY", KEYS[3], tonumber(ARGV[2]) - old)
+`)
+
+	// redisRemoveScript removes an entry, and returns its size.
+	redisRemoveScript = redis.NewScript(`
+local size = tonumber(redis.call("HGET", KEYS[1], "size") or "0")
+redis.call("DEL", KEYS[1])
+redis.call("ZREM", KEYS[2], ARGV[1])
+redis.call("ZREM", KEYS[3], ARGV[1])
+if size ~= 0 then
+	redis.call("DECRBY", KEYS[4], size)
+end
+return size
+`)
+
+	// redisUnpinScript decrements the pin count of a digest, unless its key
+	// expired, and deletes it once no pull remains.
+	redisUnpinScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+local pins = redis.call("DECR", KEYS[1])
+if pins <= 0 then
+	redis.call("DEL", KEYS[1])
+end
+return pins
+`)
+
+	// redisReleaseScript releases a lease if it is still held by the
+	// registry instance.
+	redisReleaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+)
+
+var _ Scheduler = &RedisScheduler{}
+
+// RedisScheduler is a scheduler storing its entries in redis, so that they
+// are shared by the registry instances using the same redis. Each instance
+// polls redis for the entries to expire, and an entry is only expired by the
+// instance holding its lease.
+//
+// An entry is a redis hash holding its type, expiry, size and access time.
+// The keys of the entries are indexed by expiry and by access time in sorted
+// sets, and their total size is kept in a counter.
+type RedisScheduler struct {
+	ctx    context.Context
+	client *redis.Client
+	lease  time.Duration
+	id     string
+
+	mu sync.Mutex
+
+	maxSize int64
+
+	onBlobExpire     expiryFunc
+	onManifestExpire expiryFunc
+
+	stopped  bool
+	doneChan chan struct{}
+}
+
+// NewRedis returns a new scheduler storing its entries in redis. An instance
+// expiring an entry holds its lease for the lease duration at most, which
+// defaults to one minute.
+func NewRedis(ctx context.Context, client *redis.Client, lease time.Duration) *RedisScheduler {
+	if lease <= 0 {
+		lease = defaultRedisLease
+	}
+	return &RedisScheduler{
+		ctx:     ctx,
+		client:  client,
+		lease:   lease,
+		id:      uuid.NewString(),
+		stopped: true,
+	}
+}
+
+// OnBlobExpire is called when a scheduled blob's TTL expires
+func (rs *RedisScheduler) OnBlobExpire(f expiryFunc) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.onBlobExpire = f
+}
+
+// OnManifestExpire is called when a scheduled manifest's TTL expires
+func (rs *RedisScheduler) OnManifestExpire(f expiryFunc) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.onManifestExpire = f
+}
+
+// SetMaxSize sets the maximum total size of the scheduled content. When it is
+// exceeded, the least recently accessed entries expire until it is not. Zero
+// means unlimited.
+func (rs *RedisScheduler) SetMaxSize(maxSize int64) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.maxSize = maxSize
+}
+
+// AddBlob schedules a blob cleanup after ttl expires
+func (rs *RedisScheduler) AddBlob(blobRef reference.Canonical, ttl time.Duration) error {
+	if rs.isStopped() {
+		return fmt.Errorf("scheduler not started")
+	}
+	return rs.add(blobRef, ttl, entryTypeBlob)
+}
+
+// AddManifest schedules a manifest cleanup after ttl expires
+func (rs *RedisScheduler) AddManifest(manifestRef reference.Canonical, ttl time.Duration) error {
+	if rs.isStopped() {
+		return fmt.Errorf("scheduler not started")
+	}
+	return rs.add(manifestRef, ttl, entryTypeManifest)
+}
+
+// AccessBlob records that a blob of the given size was accessed, scheduling
+// it for eviction once the maximum size is exceeded. It does nothing when
+// the size is unlimited.
+func (rs *RedisScheduler) AccessBlob(blobRef reference.Canonical, size int64) error {
+	return rs.access(blobRef, size, entryTypeBlob)
+}
+
+// AccessManifest records that a manifest of the given size was accessed,
+// scheduling it for eviction once the maximum size is exceeded. It does
+// nothing when the size is unlimited.
+func (rs *RedisScheduler) AccessManifest(manifestRef reference.Canonical, size int64) error {
+	return rs.access(manifestRef, size, entryTypeManifest)
+}
+
+// Pin prevents the entries of the content with the given digest from expiring
+// on any registry instance while it is pulled, until the returned function is
+// called. Content is only pinned when the size is limited, as pinning costs
+// requests to redis on every pull: when it is not, an entry whose ttl
+// expires during a pull is expired.
+func (rs *RedisScheduler) Pin(dgst digest.Digest) func() {
+	rs.mu.Lock()
+	maxSize := rs.maxSize
+	rs.mu.Unlock()
+
+	if maxSize <= 0 {
+		return func() {}
+	}
+
+	key := redisPinKey(dgst)
+	_, err := rs.client.TxPipelined(rs.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(rs.ctx, key)
+		pipe.Expire(rs.ctx, key, redisPinTimeout)
+		return nil
+	})
+	if err != nil {
+		dcontext.GetLogger(rs.ctx).Errorf("Error pinning %s: %s", dgst, err)
+		return func() {}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if err := redisUnpinScript.Run(rs.ctx, rs.client, []string{key}).Err(); err != nil {
+				dcontext.GetLogger(rs.ctx).Errorf("Error unpinning %s: %s", dgst, err)
+			}
+		})
+	}
+}
+
+// Start starts the scheduler
+func (rs *RedisScheduler) Start() error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if !rs.stopped {
+		return fmt.Errorf("scheduler already started")
+	}
+
+	dcontext.GetLogger(rs.ctx).Infof("Starting cached object TTL expiration scheduler with redis backend...")
+	rs.stopped = false
+	rs.doneChan = make(chan struct{})
+
+	go func(done chan struct{}) {
+		ticker := time.NewTicker(redisPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				rs.expireDue()
+				rs.evict()
+			case <-done:
+				return
+			}
+		}
+	}(rs.doneChan)
+
+	return nil
+}
+
+// Stop stops the scheduler. The entries remain in redis.
+func (rs *RedisScheduler) Stop() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.stopped {
+		return
+	}
+	close(rs.doneChan)
+	rs.stopped = true
+}
+
+func (rs *RedisScheduler) isStopped() bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	return rs.stopped
+}
+
+func (rs *RedisScheduler) add(r reference.Reference, ttl time.Duration, eType int) error {
+	key := r.String()
+	expiry := time.Now().Add(ttl).UnixMilli()
+	dcontext.GetLogger(rs.ctx).Infof("Adding new scheduler entry for %s with ttl=%s", key, ttl)
+
+	_, err := rs.client.TxPipelined(rs.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(rs.ctx, redisEntryKey(key), "type", eType, "expiry", expiry)
+		pipe.ZAdd(rs.ctx, redisExpiriesKey, redis.Z{Score: float64(expiry), Member: key})
+		return nil
+	})
+	return err
+}
+
+func (rs *RedisScheduler) access(r reference.Reference, size int64, eType int) error {
+	rs.mu.Lock()
+	maxSize, stopped := rs.maxSize, rs.stopped
+	rs.mu.Unlock()
+
+	if maxSize <= 0 {
+		return nil
+	}
+	if stopped {
+		return fmt.Errorf("scheduler not started")
+	}
+
+	key := r.String()
+	total, err := redisAccessScript.Run(rs.ctx, rs.client,
+		[]string{redisEntryKey(key), redisAccessedKey, redisSizeKey},
+		eType, size, time.Now().UnixMilli(), key).Int64()
+	if err != nil {
+		return err
+	}
+
+	if total > maxSize {
+		go rs.evict()
+	}
+	return nil
+}
+
+// expireDue expires the entries whose TTL expired.
+func (rs *RedisScheduler) expireDue() {
+	now := time.Now().UnixMilli()
+	keys, err := rs.client.ZRangeByScore(rs.ctx, redisExpiriesKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now, 10),
+		Count: redisBatchSize,
+	}).Result()
+	if err != nil {
+		dcontext.GetLogger(rs.ctx).Errorf("Error listing expired scheduler entries: %s", err)
+		return
+	}
+
+	for _, key := range keys {
+		_, err := rs.withLease(key, func() error {
+			// another instance may have expired or rescheduled the entry
+			expiry, err := rs.client.ZScore(rs.ctx, redisExpiriesKey, key).Result()
+			if err == redis.Nil || (err == nil && int64(expiry) > now) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			pinned, err := rs.pinned(key)
+			if err != nil {
+				return err
+			}
+			if pinned {
+				expiry := time.Now().Add(pinnedExpiryDelay).UnixMilli()
+				return rs.client.ZAdd(rs.ctx, redisExpiriesKey, redis.Z{Score: float64(expiry), Member: key}).Err()
+			}
+
+			_, err = rs.expire(key)
+			return err
+		})
+		if err != nil {
+			dcontext.GetLogger(rs.ctx).Errorf("Error expiring scheduler entry %s: %s", key, err)
+		}
+	}
+}
+
+// evict expires the least recently accessed entries until their total size
+// does not exceed the maximum size. Entries being pulled are skipped. Only
+// one instance evicts entries at a time.
+func (rs *RedisScheduler) evict() {
+	rs.mu.Lock()
+	maxSize := rs.maxSize
+	rs.mu.Unlock()
+
+	if maxSize <= 0 {
+		return
+	}
+
+	_, err := rs.withLease("evict", func() error {
+		var skipped int64
+		for {
+			size, err := rs.client.Get(rs.ctx, redisSizeKey).Int64()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			if size <= maxSize {
+				return nil
+			}
+
+			keys, err := rs.client.ZRange(rs.ctx, redisAccessedKey, skipped, skipped+redisBatchSize-1).Result()
+			if err != nil {
+				return err
+			}
+			if len(keys) == 0 {
+				dcontext.GetLogger(rs.ctx).Warnf("Cached content size %d exceeds maximum size %d, the remaining content is being pulled", size, maxSize)
+				return nil
+			}
+
+			for _, key := range keys {
+				if size <= maxSize {
+					break
+				}
+
+				pinned, err := rs.pinned(key)
+				if err != nil {
+					return err
+				}
+				if pinned {
+					skipped++
+					continue
+				}
+
+				var removed int64
+				acquired, err := rs.withLease(key, func() error {
+					dcontext.GetLogger(rs.ctx).Infof("Evicting scheduler entry for %s", key)
+					var err error
+					removed, err = rs.expire(key)
+					return err
+				})
+				if err != nil {
+					return err
+				}
+				if !acquired {
+					// another instance is expiring the entry
+					skipped++
+					continue
+				}
+				size -= removed
+			}
+		}
+	})
+	if err != nil {
+		dcontext.GetLogger(rs.ctx).Errorf("Error evicting scheduler entries: %s", err)
+	}
+}
+
+// withLease calls f unless another instance holds the lease of name, and
+// returns whether f was called.
+func (rs *RedisScheduler) withLease(name string, f func() error) (bool, error) {
+	key := redisKeyPrefix + "lease:" + name
+	acquired, err := rs.client.SetNX(rs.ctx, key, rs.id, rs.lease).Result()
+	if err != nil || !acquired {
+		return false, err
+	}
+	defer func() {
+		if err := redisReleaseScript.Run(rs.ctx, rs.client, []string{key}, rs.id).Err(); err != nil {
+			dcontext.GetLogger(rs.ctx).Errorf("Error releasing scheduler lease %s: %s", name, err)
+		}
+	}()
+
+	return true, f()
+}
+
+// pinned returns whether the content of the entry is being pulled by any
+// instance.
+func (rs *RedisScheduler) pinned(key string) (bool, error) {
+	ref, err := reference.Parse(key)
+	if err != nil {
+		return false, nil
+	}
+	canonical, ok := ref.(reference.Canonical)
+	if !ok {
+		return false, nil
+	}
+
+	pins, err := rs.client.Get(rs.ctx, redisPinKey(canonical.Digest())).Int64()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return pins > 0, err
+}
+
+// expire calls the expiry function of the entry and removes it, returning
+// its size.
+func (rs *RedisScheduler) expire(key string) (int64, error) {
+	eType, err := rs.client.HGet(rs.ctx, redisEntryKey(key), "type").Int()
+	if err != nil && err != redis.Nil {
+		return 0, err
+	}
+
+	if err == nil {
+		var f expiryFunc
+
+		rs.mu.Lock()
+		switch eType {
+		case entryTypeBlob:
+			f = rs.onBlobExpire
+		case entryTypeManifest:
+			f = rs.onManifestExpire
+		default:
+			f = func(reference.Reference) error {
+				return fmt.Errorf("scheduler entry type")
+			}
+		}
+		rs.mu.Unlock()
+
+		ref, err := reference.Parse(key)
+		if err == nil {
+			if err := f(ref); err != nil {
+				dcontext.GetLogger(rs.ctx).Errorf("Scheduler error returned from OnExpire(%s): %s", key, err)
+			}
+		} else {
+			dcontext.GetLogger(rs.ctx).Errorf("Error unpacking reference: %s", err)
+		}
+	}
+
+	return redisRemoveScript.Run(rs.ctx, rs.client,
+		[]string{redisEntryKey(key), redisExpiriesKey, redisAccessedKey, redisSizeKey},
+		key).Int64()
+}
+
+func redisEntryKey(key string) string {
+	return redisKeyPrefix + "entry:" + key
+}
+
+func redisPinKey(dgst digest.Digest) string {
+	return redisKeyPrefix + "pin:" + dgst.String()
+}
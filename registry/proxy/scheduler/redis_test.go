@@ -0,0 +1,176 @@
+package scheduler
+
+import (
+	"context"
+	"flag"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/internal/dcontext"
+	"github.com/distribution/reference"
+	"github.com/redis/go-redis/v9"
+)
+
+var redisAddr string
+
+func init() {
+	flag.StringVar(&redisAddr, "test.registry.proxy.scheduler.redis.addr", "", "configure the address of a test instance of redis")
+}
+
+func testRedisClient(t *testing.T) *redis.Client {
+	if redisAddr == "" {
+		// fallback to an environement variable
+		redisAddr = os.Getenv("TEST_REGISTRY_PROXY_SCHEDULER_REDIS_ADDR")
+	}
+
+	if redisAddr == "" {
+		// skip if still not set
+		t.Skip("please set -test.registry.proxy.scheduler.redis.addr to test the scheduler against redis")
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:       redisAddr,
+		MaxRetries: 3,
+		PoolSize:   4,
+	})
+
+	// Clear the database
+	if err := client.FlushDB(context.Background()).Err(); err != nil {
+		t.Fatalf("unexpected error flushing redis db: %v", err)
+	}
+	return client
+}
+
+func TestRedisScheduleShared(t *testing.T) {
+	client := testRedisClient(t)
+	ref1, ref2, _ := testRefs(t)
+
+	var mu sync.Mutex
+	expired := make(map[string]int)
+	deleteFunc := func(r reference.Reference) error {
+		mu.Lock()
+		defer mu.Unlock()
+		expired[r.String()]++
+		return nil
+	}
+
+	// replicas sharing the redis expire each entry once
+	var schedulers []*RedisScheduler
+	for i := 0; i < 3; i++ {
+		s := NewRedis(dcontext.Background(), client, time.Minute)
+		s.OnBlobExpire(deleteFunc)
+		s.OnManifestExpire(deleteFunc)
+		if err := s.Start(); err != nil {
+			t.Fatalf("Error starting scheduler: %s", err)
+		}
+		defer s.Stop()
+		schedulers = append(schedulers, s)
+	}
+
+	if err := schedulers[0].AddBlob(ref1.(reference.Canonical), 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := schedulers[1].AddManifest(ref2.(reference.Canonical), 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	<-time.After(3 * redisPollInterval)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(expired) != 2 || expired[ref1.String()] != 1 || expired[ref2.String()] != 1 {
+		t.Fatalf("Expected each entry to expire once, got %v", expired)
+	}
+	if n := client.ZCard(context.Background(), redisExpiriesKey).Val(); n != 0 {
+		t.Fatalf("Expected no remaining entries, got %d", n)
+	}
+}
+
+func TestRedisEvict(t *testing.T) {
+	client := testRedisClient(t)
+	ref1, ref2, ref3 := testRefs(t)
+
+	evictedChan := make(chan string, 3)
+	s := NewRedis(dcontext.Background(), client, time.Minute)
+	s.OnBlobExpire(func(r reference.Reference) error {
+		evictedChan <- r.String()
+		return nil
+	})
+	s.SetMaxSize(100)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Error starting scheduler: %s", err)
+	}
+	defer s.Stop()
+
+	// ref1 is the least recently accessed, but is being pulled
+	unpin := s.Pin(ref1.(reference.Canonical).Digest())
+	defer unpin()
+	for _, ref := range []reference.Reference{ref1, ref2, ref3} {
+		if err := s.AccessBlob(ref.(reference.Canonical), 40); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case evicted := <-evictedChan:
+		if evicted != ref2.String() {
+			t.Fatalf("Expected %s to be evicted, got %s", ref2, evicted)
+		}
+	case <-time.After(3 * redisPollInterval):
+		t.Fatal("Timed out waiting for eviction")
+	}
+
+	size, err := client.Get(context.Background(), redisSizeKey).Int64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 80 {
+		t.Fatalf("Expected remaining size 80, got %d", size)
+	}
+}
+
+func TestRedisUnpinExpiredPin(t *testing.T) {
+	client := testRedisClient(t)
+	ref1, _, _ := testRefs(t)
+	dgst := ref1.(reference.Canonical).Digest()
+	key := redisPinKey(dgst)
+
+	s := NewRedis(dcontext.Background(), client, time.Minute)
+	s.SetMaxSize(100)
+
+	// the pin key expires while the content is pulled
+	unpin := s.Pin(dgst)
+	if err := client.Del(context.Background(), key).Err(); err != nil {
+		t.Fatal(err)
+	}
+	unpin()
+	if n := client.Exists(context.Background(), key).Val(); n != 0 {
+		t.Fatalf("Expected no pin key after unpinning an expired pin, got %d", n)
+	}
+
+	unpin = s.Pin(dgst)
+	defer unpin()
+	pinned, err := s.pinned(ref1.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pinned {
+		t.Fatal("Expected the content to be pinned")
+	}
+}
+
+func TestRedisPinWithoutMaxSize(t *testing.T) {
+	client := testRedisClient(t)
+	ref1, _, _ := testRefs(t)
+	dgst := ref1.(reference.Canonical).Digest()
+
+	s := NewRedis(dcontext.Background(), client, time.Minute)
+	unpin := s.Pin(dgst)
+	defer unpin()
+	if n := client.Exists(context.Background(), redisPinKey(dgst)).Val(); n != 0 {
+		t.Fatalf("Expected no pin key without a maximum size, got %d", n)
+	}
+}
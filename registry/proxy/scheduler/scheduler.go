@@ -4,21 +4,64 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/distribution/distribution/v3/internal/dcontext"
 	"github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
 )
 
 // onTTLExpiryFunc is called when a repository's TTL expires
 type expiryFunc func(reference.Reference) error
 
+// Scheduler removes cached content when its TTL expires, or when the total
+// size of the cached content exceeds a maximum size.
+// The expiry functions may be called concurrently.
+type Scheduler interface {
+	// OnBlobExpire sets the function called when a scheduled blob expires
+	OnBlobExpire(f expiryFunc)
+
+	// OnManifestExpire sets the function called when a scheduled manifest
+	// expires
+	OnManifestExpire(f expiryFunc)
+
+	// SetMaxSize sets the maximum total size of the scheduled content
+	SetMaxSize(maxSize int64)
+
+	// AddBlob schedules a blob cleanup after ttl expires
+	AddBlob(blobRef reference.Canonical, ttl time.Duration) error
+
+	// AddManifest schedules a manifest cleanup after ttl expires
+	AddManifest(manifestRef reference.Canonical, ttl time.Duration) error
+
+	// AccessBlob records that a blob of the given size was accessed
+	AccessBlob(blobRef reference.Canonical, size int64) error
+
+	// AccessManifest records that a manifest of the given size was accessed
+	AccessManifest(manifestRef reference.Canonical, size int64) error
+
+	// Pin prevents the content with the given digest from expiring until
+	// the returned function is called
+	Pin(dgst digest.Digest) func()
+
+	// Start starts the scheduler
+	Start() error
+
+	// Stop stops the scheduler
+	Stop()
+}
+
 const (
 	entryTypeBlob = iota
 	entryTypeManifest
 	indexSaveFrequency = 5 * time.Second
+
+	// pinnedExpiryDelay is the delay after which the expiry of an entry
+	// whose content is being pulled is retried.
+	pinnedExpiryDelay = time.Minute
 )
 
 // schedulerEntry represents an entry in the scheduler
@@ -27,14 +70,26 @@ type schedulerEntry struct {
 	Key       string    `json:"Key"`
 	Expiry    time.Time `json:"ExpiryData"`
 	EntryType int       `json:"EntryType"`
+	Size      int64     `json:"Size,omitempty"`
+	Accessed  time.Time `json:"Accessed"`
 
-	timer *time.Timer
+	timer  *time.Timer
+	digest digest.Digest
+}
+
+// digestSize is the size of the content of a digest, along with the number
+// of sized entries of that content.
+type digestSize struct {
+	size    int64
+	entries int
 }
 
 // New returns a new instance of the scheduler
 func New(ctx context.Context, driver driver.StorageDriver, path string) *TTLExpirationScheduler {
 	return &TTLExpirationScheduler{
 		entries:         make(map[string]*schedulerEntry),
+		digests:         make(map[digest.Digest]*digestSize),
+		pins:            make(map[digest.Digest]int),
 		driver:          driver,
 		pathToStateFile: path,
 		ctx:             ctx,
@@ -44,13 +99,30 @@ func New(ctx context.Context, driver driver.StorageDriver, path string) *TTLExpi
 	}
 }
 
+var _ Scheduler = &TTLExpirationScheduler{}
+
 // TTLExpirationScheduler is a scheduler used to perform actions
-// when TTLs expire
+// when TTLs expire, or when the total size of the scheduled content
+// exceeds a maximum size. Its state is stored in a single file of the
+// storage driver, so it must not be shared by several registry instances.
 type TTLExpirationScheduler struct {
 	sync.Mutex
 
 	entries map[string]*schedulerEntry
 
+	// size is the total size of the content of the entries, of which the
+	// least recently accessed are expired when it exceeds maxSize. Content
+	// cached in several repositories has one entry per repository, and its
+	// size is accounted once in digests.
+	size     int64
+	maxSize  int64
+	digests  map[digest.Digest]*digestSize
+	evicting bool
+
+	// pins counts the pulls in progress of each digest, whose entries
+	// are not expired
+	pins map[digest.Digest]int
+
 	driver          driver.StorageDriver
 	ctx             context.Context
 	pathToStateFile string
@@ -81,6 +153,16 @@ func (ttles *TTLExpirationScheduler) OnManifestExpire(f expiryFunc) {
 	ttles.onManifestExpire = f
 }
 
+// SetMaxSize sets the maximum total size of the scheduled content. When it is
+// exceeded, the least recently accessed entries expire until it is not. Zero
+// means unlimited.
+func (ttles *TTLExpirationScheduler) SetMaxSize(maxSize int64) {
+	ttles.Lock()
+	defer ttles.Unlock()
+
+	ttles.maxSize = maxSize
+}
+
 // AddBlob schedules a blob cleanup after ttl expires
 func (ttles *TTLExpirationScheduler) AddBlob(blobRef reference.Canonical, ttl time.Duration) error {
 	ttles.Lock()
@@ -107,6 +189,64 @@ func (ttles *TTLExpirationScheduler) AddManifest(manifestRef reference.Canonical
 	return nil
 }
 
+// AccessBlob records that a blob of the given size was accessed, scheduling
+// it for eviction once the maximum size is exceeded. It does nothing when
+// the size is unlimited.
+func (ttles *TTLExpirationScheduler) AccessBlob(blobRef reference.Canonical, size int64) error {
+	ttles.Lock()
+	defer ttles.Unlock()
+
+	if ttles.maxSize <= 0 {
+		return nil
+	}
+	if ttles.stopped {
+		return fmt.Errorf("scheduler not started")
+	}
+
+	ttles.access(blobRef, size, entryTypeBlob)
+	return nil
+}
+
+// AccessManifest records that a manifest of the given size was accessed,
+// scheduling it for eviction once the maximum size is exceeded. It does
+// nothing when the size is unlimited.
+func (ttles *TTLExpirationScheduler) AccessManifest(manifestRef reference.Canonical, size int64) error {
+	ttles.Lock()
+	defer ttles.Unlock()
+
+	if ttles.maxSize <= 0 {
+		return nil
+	}
+	if ttles.stopped {
+		return fmt.Errorf("scheduler not started")
+	}
+
+	ttles.access(manifestRef, size, entryTypeManifest)
+	return nil
+}
+
+// Pin prevents the entries of the content with the given digest from expiring
+// while it is pulled, until the returned function is called.
+func (ttles *TTLExpirationScheduler) Pin(dgst digest.Digest) func() {
+	ttles.Lock()
+	defer ttles.Unlock()
+
+	ttles.pins[dgst]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ttles.Lock()
+			defer ttles.Unlock()
+
+			ttles.pins[dgst]--
+			if ttles.pins[dgst] <= 0 {
+				delete(ttles.pins, dgst)
+			}
+		})
+	}
+}
+
 // Start starts the scheduler
 func (ttles *TTLExpirationScheduler) Start() error {
 	ttles.Lock()
@@ -125,8 +265,18 @@ func (ttles *TTLExpirationScheduler) Start() error {
 	ttles.stopped = false
 
 	// Start timer for each deserialized entry
+	ttles.size = 0
+	ttles.digests = make(map[digest.Digest]*digestSize)
 	for _, entry := range ttles.entries {
-		entry.timer = ttles.startTimer(entry, time.Until(entry.Expiry))
+		if ref, err := reference.Parse(entry.Key); err == nil {
+			entry.digest = referenceDigest(ref)
+		}
+		if entry.Size > 0 {
+			ttles.addSize(entry.digest, entry.Size)
+		}
+		if !entry.Expiry.IsZero() {
+			entry.timer = ttles.startTimer(entry, time.Until(entry.Expiry))
+		}
 	}
 
 	// Start a ticker to periodically save the entries index
@@ -163,46 +313,195 @@ func (ttles *TTLExpirationScheduler) add(r reference.Reference, ttl time.Duratio
 		Key:       r.String(),
 		Expiry:    time.Now().Add(ttl),
 		EntryType: eType,
+		digest:    referenceDigest(r),
 	}
 	dcontext.GetLogger(ttles.ctx).Infof("Adding new scheduler entry for %s with ttl=%s", entry.Key, time.Until(entry.Expiry))
-	if oldEntry, present := ttles.entries[entry.Key]; present && oldEntry.timer != nil {
-		oldEntry.timer.Stop()
+	if oldEntry, present := ttles.entries[entry.Key]; present {
+		if oldEntry.timer != nil {
+			oldEntry.timer.Stop()
+		}
+		entry.Size = oldEntry.Size
+		entry.Accessed = oldEntry.Accessed
 	}
 	ttles.entries[entry.Key] = entry
 	entry.timer = ttles.startTimer(entry, ttl)
 	ttles.indexDirty = true
 }
 
+func (ttles *TTLExpirationScheduler) access(r reference.Reference, size int64, eType int) {
+	key := r.String()
+	entry, present := ttles.entries[key]
+	if !present {
+		// content which does not expire after a ttl is only evicted
+		entry = &schedulerEntry{
+			Key:       key,
+			EntryType: eType,
+			digest:    referenceDigest(r),
+		}
+		ttles.entries[key] = entry
+	}
+	// the size of content addressed by its digest does not change
+	if entry.Size == 0 && size > 0 {
+		ttles.addSize(entry.digest, size)
+		entry.Size = size
+	}
+	entry.Accessed = time.Now()
+	ttles.indexDirty = true
+
+	if ttles.size > ttles.maxSize && !ttles.evicting {
+		ttles.evicting = true
+		go ttles.evict()
+	}
+}
+
+// referenceDigest returns the digest of a canonical reference, or an empty
+// digest.
+func referenceDigest(r reference.Reference) digest.Digest {
+	if canonical, ok := r.(reference.Canonical); ok {
+		return canonical.Digest()
+	}
+	return ""
+}
+
+// addSize accounts an entry of the given size for the content of the digest.
+func (ttles *TTLExpirationScheduler) addSize(dgst digest.Digest, size int64) {
+	ds, present := ttles.digests[dgst]
+	if !present {
+		ds = &digestSize{size: size}
+		ttles.digests[dgst] = ds
+		ttles.size += size
+	}
+	ds.entries++
+}
+
+// removeSize removes an entry of the content of the digest from the
+// accounted size.
+func (ttles *TTLExpirationScheduler) removeSize(dgst digest.Digest) {
+	ds, present := ttles.digests[dgst]
+	if !present {
+		return
+	}
+	ds.entries--
+	if ds.entries <= 0 {
+		delete(ttles.digests, dgst)
+		ttles.size -= ds.size
+	}
+}
+
+// evict expires the least recently accessed content until its total size
+// does not exceed the maximum size. All the entries of the content of a
+// digest are expired together. Content being pulled and entries of unknown
+// size are skipped. The content is deleted once the scheduler is unlocked.
+func (ttles *TTLExpirationScheduler) evict() {
+	ttles.Lock()
+
+	ttles.evicting = false
+	if ttles.stopped {
+		ttles.Unlock()
+		return
+	}
+
+	entries := make(map[digest.Digest][]*schedulerEntry)
+	accessed := make(map[digest.Digest]time.Time)
+	for _, entry := range ttles.entries {
+		if entry.Size == 0 {
+			continue
+		}
+		entries[entry.digest] = append(entries[entry.digest], entry)
+		if entry.Accessed.After(accessed[entry.digest]) {
+			accessed[entry.digest] = entry.Accessed
+		}
+	}
+	digests := make([]digest.Digest, 0, len(entries))
+	for dgst := range entries {
+		digests = append(digests, dgst)
+	}
+	sort.Slice(digests, func(i, j int) bool {
+		return accessed[digests[i]].Before(accessed[digests[j]])
+	})
+
+	var expiries []func()
+	for _, dgst := range digests {
+		if ttles.size <= ttles.maxSize {
+			break
+		}
+		if ttles.pins[dgst] > 0 {
+			continue
+		}
+		for _, entry := range entries[dgst] {
+			if entry.timer != nil {
+				entry.timer.Stop()
+			}
+			dcontext.GetLogger(ttles.ctx).Infof("Evicting scheduler entry for %s accessed at %s", entry.Key, entry.Accessed)
+			expiries = append(expiries, ttles.expire(entry))
+		}
+	}
+
+	if ttles.size > ttles.maxSize {
+		dcontext.GetLogger(ttles.ctx).Warnf("Cached content size %d exceeds maximum size %d, the remaining content is being pulled", ttles.size, ttles.maxSize)
+	}
+	ttles.Unlock()
+
+	for _, expiry := range expiries {
+		expiry()
+	}
+}
+
 func (ttles *TTLExpirationScheduler) startTimer(entry *schedulerEntry, ttl time.Duration) *time.Timer {
 	return time.AfterFunc(ttl, func() {
 		ttles.Lock()
-		defer ttles.Unlock()
+		if ttles.pinned(entry) {
+			entry.timer = ttles.startTimer(entry, pinnedExpiryDelay)
+			ttles.Unlock()
+			return
+		}
+		expiry := ttles.expire(entry)
+		ttles.Unlock()
 
-		var f expiryFunc
+		expiry()
+	})
+}
 
-		switch entry.EntryType {
-		case entryTypeBlob:
-			f = ttles.onBlobExpire
-		case entryTypeManifest:
-			f = ttles.onManifestExpire
-		default:
-			f = func(reference.Reference) error {
-				return fmt.Errorf("scheduler entry type")
-			}
+// pinned returns whether the content of the entry is being pulled.
+func (ttles *TTLExpirationScheduler) pinned(entry *schedulerEntry) bool {
+	return ttles.pins[entry.digest] > 0
+}
+
+// expire removes the entry and returns the function calling its expiry
+// function. As the expiry functions delete content from storage, the
+// returned function is called once the scheduler is unlocked.
+func (ttles *TTLExpirationScheduler) expire(entry *schedulerEntry) func() {
+	var f expiryFunc
+
+	switch entry.EntryType {
+	case entryTypeBlob:
+		f = ttles.onBlobExpire
+	case entryTypeManifest:
+		f = ttles.onManifestExpire
+	default:
+		f = func(reference.Reference) error {
+			return fmt.Errorf("scheduler entry type")
 		}
+	}
+
+	if current, present := ttles.entries[entry.Key]; present {
+		if current.Size > 0 {
+			ttles.removeSize(current.digest)
+		}
+		delete(ttles.entries, entry.Key)
+	}
+	ttles.indexDirty = true
 
+	return func() {
 		ref, err := reference.Parse(entry.Key)
-		if err == nil {
-			if err := f(ref); err != nil {
-				dcontext.GetLogger(ttles.ctx).Errorf("Scheduler error returned from OnExpire(%s): %s", entry.Key, err)
-			}
-		} else {
+		if err != nil {
 			dcontext.GetLogger(ttles.ctx).Errorf("Error unpacking reference: %s", err)
+			return
 		}
-
-		delete(ttles.entries, entry.Key)
-		ttles.indexDirty = true
-	})
+		if err := f(ref); err != nil {
+			dcontext.GetLogger(ttles.ctx).Errorf("Scheduler error returned from OnExpire(%s): %s", entry.Key, err)
+		}
+	}
 }
 
 // Stop stops the scheduler.
@@ -210,12 +509,17 @@ func (ttles *TTLExpirationScheduler) Stop() {
 	ttles.Lock()
 	defer ttles.Unlock()
 
+	if ttles.stopped {
+		return
+	}
 	if err := ttles.writeState(); err != nil {
 		dcontext.GetLogger(ttles.ctx).Errorf("Error writing scheduler state: %s", err)
 	}
 
 	for _, entry := range ttles.entries {
-		entry.timer.Stop()
+		if entry.timer != nil {
+			entry.timer.Stop()
+		}
 	}
 
 	close(ttles.doneChan)
@@ -42,6 +42,9 @@ func TestSchedule(t *testing.T) {
 	var mu sync.Mutex
 	s := New(dcontext.Background(), inmemory.New(), "/ttl")
 	deleteFunc := func(repoName reference.Reference) error {
+		mu.Lock()
+		defer mu.Unlock()
+
 		if len(remainingRepos) == 0 {
 			t.Fatalf("Incorrect expiry count")
 		}
@@ -50,9 +53,7 @@ func TestSchedule(t *testing.T) {
 			t.Fatalf("Trying to remove nonexistent repo: %s", repoName)
 		}
 		t.Log("removing", repoName)
-		mu.Lock()
 		delete(remainingRepos, repoName.String())
-		mu.Unlock()
 
 		return nil
 	}
@@ -207,3 +208,183 @@ func TestDoubleStart(t *testing.T) {
 		t.Fatalf("Scheduler started twice without error")
 	}
 }
+
+func TestEvict(t *testing.T) {
+	ref1, ref2, ref3 := testRefs(t)
+
+	var mu sync.Mutex
+	var evicted []string
+	evictedChan := make(chan struct{}, 3)
+	deleteFunc := func(r reference.Reference) error {
+		mu.Lock()
+		evicted = append(evicted, r.String())
+		mu.Unlock()
+		evictedChan <- struct{}{}
+		return nil
+	}
+
+	s := New(dcontext.Background(), inmemory.New(), "/ttl")
+	s.OnBlobExpire(deleteFunc)
+	s.OnManifestExpire(deleteFunc)
+	s.SetMaxSize(100)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Error starting ttlExpirationScheduler: %s", err)
+	}
+	defer s.Stop()
+
+	if err := s.AccessBlob(ref1.(reference.Canonical), 40); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AccessManifest(ref2.(reference.Canonical), 40); err != nil {
+		t.Fatal(err)
+	}
+	// ref1 becomes the most recently accessed
+	if err := s.AccessBlob(ref1.(reference.Canonical), 40); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AccessBlob(ref3.(reference.Canonical), 40); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-evictedChan:
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for eviction")
+	}
+
+	s.Lock()
+	size := s.size
+	s.Unlock()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(evicted) != 1 || evicted[0] != ref2.String() {
+		t.Fatalf("Expected %s to be evicted, got %v", ref2, evicted)
+	}
+	if size != 80 {
+		t.Fatalf("Expected remaining size 80, got %d", size)
+	}
+}
+
+func TestEvictSharedContent(t *testing.T) {
+	ref1, ref2, _ := testRefs(t)
+	shared, err := reference.Parse("otherrepo@" + ref1.(reference.Canonical).Digest().String())
+	if err != nil {
+		t.Fatalf("could not parse reference: %v", err)
+	}
+
+	s := New(dcontext.Background(), inmemory.New(), "/ttl")
+	evictedChan := make(chan string, 3)
+	s.OnBlobExpire(func(r reference.Reference) error {
+		// the scheduler is not locked while content is deleted
+		if err := s.AccessBlob(ref2.(reference.Canonical), 40); err != nil {
+			t.Error(err)
+		}
+		evictedChan <- r.String()
+		return nil
+	})
+	s.SetMaxSize(100)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Error starting ttlExpirationScheduler: %s", err)
+	}
+	defer s.Stop()
+
+	// the content cached in two repositories is accounted once
+	for _, ref := range []reference.Reference{ref1, shared, ref2} {
+		if err := s.AccessBlob(ref.(reference.Canonical), 40); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Lock()
+	size := s.size
+	s.Unlock()
+	if size != 80 {
+		t.Fatalf("Expected size 80, got %d", size)
+	}
+
+	// both entries of the least recently accessed content are evicted
+	s.SetMaxSize(50)
+	if err := s.AccessBlob(ref2.(reference.Canonical), 40); err != nil {
+		t.Fatal(err)
+	}
+	evicted := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-evictedChan:
+			evicted[r] = true
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for eviction")
+		}
+	}
+	if !evicted[ref1.String()] || !evicted[shared.String()] {
+		t.Fatalf("Expected %s and %s to be evicted, got %v", ref1, shared, evicted)
+	}
+
+	s.Lock()
+	size = s.size
+	s.Unlock()
+	if size != 40 {
+		t.Fatalf("Expected remaining size 40, got %d", size)
+	}
+}
+
+func TestEvictPinned(t *testing.T) {
+	ref1, ref2, _ := testRefs(t)
+
+	evictedChan := make(chan string, 2)
+	s := New(dcontext.Background(), inmemory.New(), "/ttl")
+	s.OnBlobExpire(func(r reference.Reference) error {
+		evictedChan <- r.String()
+		return nil
+	})
+	s.SetMaxSize(50)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Error starting ttlExpirationScheduler: %s", err)
+	}
+	defer s.Stop()
+
+	// ref1 is the least recently accessed, but is being pulled
+	unpin := s.Pin(ref1.(reference.Canonical).Digest())
+	if err := s.AccessBlob(ref1.(reference.Canonical), 40); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AccessBlob(ref2.(reference.Canonical), 40); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case evicted := <-evictedChan:
+		if evicted != ref2.String() {
+			t.Fatalf("Evicted %s while it was pinned", evicted)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for eviction")
+	}
+	unpin()
+
+	s.Lock()
+	_, present := s.entries[ref1.String()]
+	s.Unlock()
+	if !present {
+		t.Fatalf("Expected %s to remain scheduled", ref1)
+	}
+}
+
+func TestAccessWithoutMaxSize(t *testing.T) {
+	ref1, _, _ := testRefs(t)
+
+	s := New(dcontext.Background(), inmemory.New(), "/ttl")
+	if err := s.Start(); err != nil {
+		t.Fatalf("Error starting ttlExpirationScheduler: %s", err)
+	}
+	defer s.Stop()
+
+	if err := s.AccessBlob(ref1.(reference.Canonical), 40); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if len(s.entries) != 0 {
+		t.Fatalf("Expected no entries without a maximum size, got %d", len(s.entries))
+	}
+}
@@ -0,0 +1,249 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/internal/dcontext"
+	"github.com/distribution/distribution/v3/manifest/manifestlist"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	"gopkg.in/yaml.v2"
+)
+
+// SyncSpec lists the repositories and tags to pull through into a cache
+// ahead of the clients.
+type SyncSpec struct {
+	// Interval is the time between two syncs, which refresh the tags. Zero
+	// syncs once.
+	Interval time.Duration `yaml:"interval,omitempty"`
+
+	// Repositories are the repositories to sync.
+	Repositories []SyncRepository `yaml:"repositories"`
+}
+
+// SyncRepository is a repository to pull through into a cache.
+type SyncRepository struct {
+	// Name is the name of the repository in the cache, including the prefix
+	// of its remote registry.
+	Name string `yaml:"name"`
+
+	// Tags are regular expressions matching the tags to sync. All the tags
+	// are synced if empty.
+	Tags []string `yaml:"tags,omitempty"`
+
+	tags []*regexp.Regexp
+}
+
+// SyncStats counts the content pulled through by a sync.
+type SyncStats struct {
+	Tags      int
+	Manifests int
+	Blobs     int
+}
+
+// ParseSyncSpec parses and validates a YAML sync spec.
+func ParseSyncSpec(rd io.Reader) (*SyncSpec, error) {
+	p, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+
+	var spec SyncSpec
+	if err := yaml.Unmarshal(p, &spec); err != nil {
+		return nil, err
+	}
+
+	if spec.Interval < 0 {
+		return nil, fmt.Errorf("interval must not be negative: %s", spec.Interval)
+	}
+	for i, repo := range spec.Repositories {
+		if _, err := reference.WithName(repo.Name); err != nil {
+			return nil, fmt.Errorf("invalid repository %q: %v", repo.Name, err)
+		}
+		for _, expr := range repo.Tags {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tags expression %q of %s: %v", expr, repo.Name, err)
+			}
+			spec.Repositories[i].tags = append(spec.Repositories[i].tags, re)
+		}
+	}
+	return &spec, nil
+}
+
+// matches returns whether the tag is to be synced.
+func (repo SyncRepository) matches(tag string) bool {
+	if len(repo.tags) == 0 {
+		return true
+	}
+	for _, re := range repo.tags {
+		if re.MatchString(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sync pulls the manifests of the matching tags of the repositories of the
+// spec, including every manifest of an index, and the blobs they reference
+// through the pull through cache registry. Content already cached is not
+// pulled again, but the tags are refreshed from the remote registries. Errors
+// do not stop the sync of the remaining tags, and are returned together.
+func Sync(ctx context.Context, registry distribution.Namespace, spec *SyncSpec) (SyncStats, error) {
+	var stats SyncStats
+	var errs []error
+	for _, repo := range spec.Repositories {
+		if err := syncRepository(ctx, registry, repo, &stats); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", repo.Name, err))
+		}
+	}
+	return stats, errors.Join(errs...)
+}
+
+func syncRepository(ctx context.Context, registry distribution.Namespace, spec SyncRepository, stats *SyncStats) error {
+	named, err := reference.WithName(spec.Name)
+	if err != nil {
+		return err
+	}
+	repository, err := registry.Repository(ctx, named)
+	if err != nil {
+		return err
+	}
+	pr, ok := repository.(*proxiedRepository)
+	if !ok {
+		return fmt.Errorf("registry is not a pull through cache")
+	}
+	pt, ok := pr.tags.(proxyTagService)
+	if !ok {
+		return fmt.Errorf("unexpected tag service %T", pr.tags)
+	}
+
+	if err := pt.authChallenger.tryEstablishChallenges(ctx); err != nil {
+		return err
+	}
+	tags, err := pt.remoteTags.All(ctx)
+	if err != nil {
+		return err
+	}
+
+	s := syncer{
+		repository: pr,
+		visited:    make(map[digest.Digest]struct{}),
+		stats:      stats,
+	}
+
+	var errs []error
+	for _, tag := range tags {
+		if !spec.matches(tag) {
+			continue
+		}
+
+		desc, err := pt.remoteTags.Get(ctx, tag)
+		if err == nil {
+			err = s.syncManifest(ctx, desc.Digest)
+		}
+		if err == nil {
+			// the tag is only cached once its content is
+			err = pt.localTags.Tag(ctx, tag, desc)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tag %s: %w", tag, err))
+			continue
+		}
+
+		dcontext.GetLogger(ctx).Infof("synced %s:%s at %s", spec.Name, tag, desc.Digest)
+		stats.Tags++
+	}
+	return errors.Join(errs...)
+}
+
+// syncer pulls content through into a repository of a cache.
+type syncer struct {
+	repository *proxiedRepository
+	visited    map[digest.Digest]struct{}
+	stats      *SyncStats
+}
+
+func (s *syncer) syncManifest(ctx context.Context, dgst digest.Digest) error {
+	if _, ok := s.visited[dgst]; ok {
+		return nil
+	}
+
+	manifest, err := s.repository.manifests.Get(ctx, dgst)
+	if err != nil {
+		return err
+	}
+	s.visited[dgst] = struct{}{}
+	s.stats.Manifests++
+
+	switch manifest.(type) {
+	case *manifestlist.DeserializedManifestList, *ocischema.DeserializedImageIndex:
+		// every platform is synced
+		for _, desc := range manifest.References() {
+			if err := s.syncManifest(ctx, desc.Digest); err != nil {
+				return err
+			}
+		}
+	default:
+		for _, desc := range manifest.References() {
+			if err := s.syncBlob(ctx, desc.Digest); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *syncer) syncBlob(ctx context.Context, dgst digest.Digest) error {
+	if _, ok := s.visited[dgst]; ok {
+		return nil
+	}
+
+	pbs, ok := s.repository.blobStore.(*proxyBlobStore)
+	if !ok {
+		return fmt.Errorf("unexpected blob store %T", s.repository.blobStore)
+	}
+
+	_, err := pbs.localStore.Stat(ctx, dgst)
+	switch err {
+	case nil:
+	case distribution.ErrBlobUnknown:
+		r, err := http.NewRequestWithContext(ctx, http.MethodGet, "", nil)
+		if err != nil {
+			return err
+		}
+		if err := pbs.ServeBlob(ctx, discardResponseWriter{header: make(http.Header)}, r, dgst); err != nil {
+			return err
+		}
+		s.stats.Blobs++
+	default:
+		return err
+	}
+
+	s.visited[dgst] = struct{}{}
+	return nil
+}
+
+// discardResponseWriter is the response writer of the blobs pulled through
+// by a sync, which are not served to any client.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w discardResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (w discardResponseWriter) WriteHeader(int) {}
@@ -0,0 +1,242 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// newRemoteRegistry serves the manifests, blobs and tags of the registry over
+// the subset of the distribution API used by a pull through cache.
+func newRemoteRegistry(t *testing.T, registry distribution.Namespace) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if r.URL.Path == "/v2/" {
+			return
+		}
+
+		var repoName, kind, ref string
+		for _, k := range []string{"/manifests/", "/blobs/", "/tags/"} {
+			if i := strings.LastIndex(r.URL.Path, k); i > 0 {
+				repoName, kind, ref = strings.TrimPrefix(r.URL.Path[:i], "/v2/"), k, r.URL.Path[i+len(k):]
+				break
+			}
+		}
+		named, err := reference.WithName(repoName)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		repo, err := registry.Repository(ctx, named)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch kind {
+		case "/tags/":
+			tags, err := repo.Tags(ctx).All(ctx)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": repoName, "tags": tags})
+		case "/manifests/":
+			dgst, err := digest.Parse(ref)
+			if err != nil {
+				desc, err := repo.Tags(ctx).Get(ctx, ref)
+				if err != nil {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				dgst = desc.Digest
+			}
+			manifests, err := repo.Manifests(ctx)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			manifest, err := manifests.Get(ctx, dgst)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			mediaType, payload, _ := manifest.Payload()
+			w.Header().Set("Content-Type", mediaType)
+			w.Header().Set("Content-Length", fmt.Sprint(len(payload)))
+			w.Header().Set("Docker-Content-Digest", dgst.String())
+			if r.Method != http.MethodHead {
+				_, _ = w.Write(payload)
+			}
+		case "/blobs/":
+			dgst, err := digest.Parse(ref)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if err := repo.Blobs(ctx).ServeBlob(ctx, w, r, dgst); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestParseSyncSpec(t *testing.T) {
+	_, err := ParseSyncSpec(strings.NewReader("repositories:\n  - name: library/UPPER\n"))
+	if err == nil || !strings.Contains(err.Error(), "invalid repository") {
+		t.Fatalf("Expected an invalid repository error, got %v", err)
+	}
+
+	_, err = ParseSyncSpec(strings.NewReader("repositories:\n  - name: library/app\n    tags: [\"(\"]\n"))
+	if err == nil || !strings.Contains(err.Error(), "invalid tags expression") {
+		t.Fatalf("Expected an invalid tags expression error, got %v", err)
+	}
+
+	spec, err := ParseSyncSpec(strings.NewReader("interval: 1h\nrepositories:\n  - name: library/app\n    tags: [\"^v1\\\\.\"]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !spec.Repositories[0].matches("v1.2") || spec.Repositories[0].matches("v10") {
+		t.Fatalf("Unexpected matching of the tags expressions")
+	}
+}
+
+func TestExpires(t *testing.T) {
+	zero, day := time.Duration(0), 24*time.Hour
+	for _, tc := range []struct {
+		config  configuration.Proxy
+		expires bool
+	}{
+		{configuration.Proxy{RemoteURL: "https://example.com"}, true},
+		{configuration.Proxy{RemoteURL: "https://example.com", TTL: &zero}, false},
+		{configuration.Proxy{RemoteURL: "https://example.com", TTL: &zero, MaxSize: 1}, true},
+		{configuration.Proxy{TTL: &day, Remotes: []configuration.ProxyRemote{{RemoteURL: "https://example.com", TTL: &zero}}}, false},
+		{configuration.Proxy{Remotes: []configuration.ProxyRemote{{RemoteURL: "https://example.com", TTL: &zero}, {RemoteURL: "https://example.org", TTL: &day}}}, true},
+	} {
+		if expires := Expires(tc.config); expires != tc.expires {
+			t.Errorf("Expected Expires to be %v for %+v, got %v", tc.expires, tc.config, expires)
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	name, err := reference.WithName("library/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	truthRegistry, err := storage.NewRegistry(ctx, inmemory.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	truthRepo, err := truthRegistry.Repository(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestDigest, err := populateRepo(ctx, t, truthRepo, name.Name(), "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an index of a single platform, tagged v1, and its manifest tagged dev
+	truthManifests, err := truthRepo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := ocischema.FromDescriptors([]distribution.Descriptor{{
+		MediaType: schema2.MediaTypeManifest,
+		Digest:    manifestDigest,
+		Size:      1,
+		Platform:  &v1.Platform{Architecture: "amd64", OS: "linux"},
+	}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexDigest, err := truthManifests.Put(ctx, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truthTags := truthRepo.Tags(ctx)
+	if err := truthTags.Tag(ctx, "v1", distribution.Descriptor{Digest: indexDigest}); err != nil {
+		t.Fatal(err)
+	}
+	if err := truthTags.Tag(ctx, "dev", distribution.Descriptor{Digest: manifestDigest}); err != nil {
+		t.Fatal(err)
+	}
+
+	remote := newRemoteRegistry(t, truthRegistry)
+
+	localRegistry, err := storage.NewRegistry(ctx, inmemory.New(), storage.DisableDigestResumption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, err := NewRegistryPullThroughCache(ctx, localRegistry, inmemory.New(), configuration.Proxy{RemoteURL: remote.URL}, WithoutScheduler())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	localRepo, err := localRegistry.Repository(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	localManifests, err := localRepo.Manifests(ctx, storage.SkipLayerVerification())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := ParseSyncSpec(strings.NewReader("repositories:\n  - name: library/app\n    tags: [\"^v\"]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := Sync(ctx, registry, spec)
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if stats != (SyncStats{Tags: 1, Manifests: 2, Blobs: 1}) {
+		t.Fatalf("Unexpected sync stats: %+v", stats)
+	}
+
+	desc, err := localRepo.Tags(ctx).Get(ctx, "v1")
+	if err != nil || desc.Digest != indexDigest {
+		t.Fatalf("Expected v1 to be cached at %s, got %v, %v", indexDigest, desc.Digest, err)
+	}
+	if _, err := localRepo.Tags(ctx).Get(ctx, "dev"); err == nil {
+		t.Fatalf("Unmatched tag dev was synced")
+	}
+	for _, dgst := range []digest.Digest{indexDigest, manifestDigest} {
+		if exists, err := localManifests.Exists(ctx, dgst); err != nil || !exists {
+			t.Fatalf("Expected manifest %s to be cached, got %v", dgst, err)
+		}
+	}
+
+	// cached content is not pulled again
+	stats, err = Sync(ctx, registry, spec)
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if stats.Blobs != 0 {
+		t.Fatalf("Expected no blob to be pulled again, got %d", stats.Blobs)
+	}
+}
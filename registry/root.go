@@ -1,13 +1,23 @@
 package registry
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/internal/dcontext"
+	"github.com/distribution/distribution/v3/notifications"
+	"github.com/distribution/distribution/v3/registry/handlers"
+	"github.com/distribution/distribution/v3/registry/proxy"
+	"github.com/distribution/distribution/v3/registry/proxy/scheduler"
 	"github.com/distribution/distribution/v3/registry/storage"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
 	"github.com/distribution/distribution/v3/version"
+	events "github.com/docker/go-events"
 	"github.com/spf13/cobra"
 )
 
@@ -16,8 +26,18 @@ var showVersion bool
 func init() {
 	RootCmd.AddCommand(ServeCmd)
 	RootCmd.AddCommand(GCCmd)
+	RootCmd.AddCommand(RebuildQuotasCmd)
+	RootCmd.AddCommand(RetentionReportCmd)
+	RootCmd.AddCommand(MirrorSyncCmd)
 	GCCmd.Flags().BoolVarP(&dryRun, "dry-run", "d", false, "do everything except remove the blobs")
 	GCCmd.Flags().BoolVarP(&removeUntagged, "delete-untagged", "m", false, "delete manifests that are not currently referenced via tag")
+	GCCmd.Flags().BoolVarP(&removeReferrers, "delete-referrers", "r", false, "delete untagged referrers, such as signatures, along with the manifest they refer to (requires --delete-untagged)")
+	GCCmd.Flags().DurationVarP(&gracePeriod, "grace-period", "g", 0, "collect online without requiring read-only mode, keeping content written within this period")
+	GCCmd.Flags().IntVarP(&concurrency, "concurrency", "c", 1, "number of repositories marked, and of manifests and blobs swept, in parallel")
+	GCCmd.Flags().IntVar(&progressInterval, "progress-interval", 100, "report progress every N repositories marked (0 to disable)")
+	GCCmd.Flags().StringVar(&checkpoint, "checkpoint", "", "save progress to, and resume an interrupted run from, this file")
+	GCCmd.Flags().StringVarP(&output, "output", "o", "text", "output format, either text or json (prints the plan of what is deleted)")
+	GCCmd.Flags().StringVar(&applyPlan, "apply-plan", "", "delete exactly the content listed in a plan printed by --output json")
 	RootCmd.Flags().BoolVarP(&showVersion, "version", "v", false, "show the version and exit")
 }
 
@@ -37,8 +57,15 @@ var RootCmd = &cobra.Command{
 }
 
 var (
-	dryRun         bool
-	removeUntagged bool
+	dryRun           bool
+	removeUntagged   bool
+	removeReferrers  bool
+	gracePeriod      time.Duration
+	concurrency      int
+	progressInterval int
+	checkpoint       string
+	output           string
+	applyPlan        string
 )
 
 // GCCmd is the cobra command that corresponds to the garbage-collect subcommand
@@ -74,13 +101,306 @@ var GCCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		err = storage.MarkAndSweep(ctx, driver, registry, storage.GCOpts{
-			DryRun:         dryRun,
-			RemoveUntagged: removeUntagged,
-		})
+		opts := storage.GCOpts{
+			DryRun:           dryRun,
+			RemoveUntagged:   removeUntagged,
+			RemoveReferrers:  removeReferrers,
+			GracePeriod:      gracePeriod,
+			Concurrency:      concurrency,
+			ProgressInterval: progressInterval,
+			Checkpoint:       checkpoint,
+			Quotas:           handlers.NewQuotaTracker(driver, config.Policy.Quotas),
+		}
+
+		// deletions are notified to the endpoints of the configuration
+		var eventSink events.Sink
+		if len(config.Notifications.Endpoints) > 0 && !dryRun {
+			var listener notifications.SystemListener
+			listener, eventSink, err = handlers.NewSystemListener(ctx, config, driver)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to configure notifications: %v", err)
+				os.Exit(1)
+			}
+			opts.Listener = listener
+		}
+
+		switch {
+		case applyPlan != "":
+			err = applyGCPlan(ctx, driver, registry, applyPlan, opts)
+		case output == "json":
+			err = planGC(ctx, driver, registry, opts)
+		case output == "text":
+			err = storage.MarkAndSweep(ctx, driver, registry, opts)
+		default:
+			err = fmt.Errorf("unknown output format %q", output)
+		}
+		if eventSink != nil {
+			closeEventSink(ctx, eventSink)
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to garbage collect: %v", err)
 			os.Exit(1)
 		}
 	},
 }
+
+// eventFlushTimeout bounds the time spent delivering the events queued for
+// unavailable endpoints before exiting.
+const eventFlushTimeout = time.Minute
+
+// closeEventSink flushes the events written to sink, giving up after
+// eventFlushTimeout.
+func closeEventSink(ctx context.Context, sink events.Sink) {
+	done := make(chan error, 1)
+	go func() {
+		done <- sink.Close()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			dcontext.GetLogger(ctx).Errorf("failed to flush events: %v", err)
+		}
+	case <-time.After(eventFlushTimeout):
+		dcontext.GetLogger(ctx).Errorf("failed to flush events within %s", eventFlushTimeout)
+	}
+}
+
+// planGC prints the plan of a garbage collection as JSON, and applies it
+// unless this is a dry run. Progress is reported on stderr, so the plan can
+// be redirected to a file.
+func planGC(ctx context.Context, driver storagedriver.StorageDriver, registry distribution.Namespace, opts storage.GCOpts) error {
+	opts.Output = os.Stderr
+
+	plan, err := storage.PlanGarbageCollection(ctx, driver, registry, opts)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(plan); err != nil {
+		return err
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+	return storage.ApplyGCPlan(ctx, driver, registry, plan, opts)
+}
+
+// applyGCPlan deletes the content listed in the plan file at path.
+func applyGCPlan(ctx context.Context, driver storagedriver.StorageDriver, registry distribution.Namespace, path string, opts storage.GCOpts) error {
+	p, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var plan storage.GCPlan
+	if err := json.Unmarshal(p, &plan); err != nil {
+		return fmt.Errorf("invalid plan %s: %v", path, err)
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+	return storage.ApplyGCPlan(ctx, driver, registry, &plan, opts)
+}
+
+// RebuildQuotasCmd is the cobra command that corresponds to the rebuild-quotas subcommand
+var RebuildQuotasCmd = &cobra.Command{
+	Use:   "rebuild-quotas <config>",
+	Short: "`rebuild-quotas` recomputes the usage of the namespace quotas from the storage",
+	Long:  "`rebuild-quotas` recomputes the usage of the namespace quotas from the storage",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			// nolint:errcheck
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(ctx, config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		registry, err := storage.NewRegistry(ctx, driver)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
+			os.Exit(1)
+		}
+
+		quotas := handlers.NewQuotaTracker(driver, config.Policy.Quotas)
+		if quotas == nil {
+			fmt.Fprintf(os.Stderr, "configuration error: no quota is configured\n")
+			os.Exit(1)
+		}
+
+		usages, err := quotas.Rebuild(ctx, registry)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to rebuild quotas: %v", err)
+			os.Exit(1)
+		}
+		for _, quota := range config.Policy.Quotas {
+			usage := usages[quota.Namespace]
+			fmt.Printf("%s: %d bytes, %d manifests\n", quota.Namespace, usage.Bytes, usage.Manifests)
+		}
+	},
+}
+
+// RetentionReportCmd is the cobra command that corresponds to the retention-report subcommand
+var RetentionReportCmd = &cobra.Command{
+	Use:   "retention-report <config>",
+	Short: "`retention-report` lists the tags the retention rules would remove",
+	Long:  "`retention-report` lists the tags the retention rules of the configuration would remove, along with their digest and the time they were last updated, without removing them",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			// nolint:errcheck
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(ctx, config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		registry, err := storage.NewRegistry(ctx, driver)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
+			os.Exit(1)
+		}
+
+		opts := storage.RetentionOpts{
+			DryRun: true,
+			Rules:  handlers.RetentionRules(config.Policy.Retention),
+		}
+		removed, err := storage.EnforceRetention(ctx, driver, registry, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to evaluate retention rules: %v", err)
+			os.Exit(1)
+		}
+		for _, t := range removed {
+			fmt.Printf("%s:%s %s %s\n", t.Repository, t.Tag, t.Digest, t.Updated.Format(time.RFC3339))
+		}
+		fmt.Printf("%d tags eligible for removal\n", len(removed))
+	},
+}
+
+// MirrorSyncCmd is the cobra command that corresponds to the mirror-sync subcommand
+var MirrorSyncCmd = &cobra.Command{
+	Use:   "mirror-sync <config> <spec>",
+	Short: "`mirror-sync` pulls the repositories and tags listed in the spec into the pull through cache",
+	Long:  "`mirror-sync` pulls the repositories and tags listed in the spec into the pull through cache, and refreshes them at the interval of the spec",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := resolveConfiguration(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			// nolint:errcheck
+			cmd.Usage()
+			os.Exit(1)
+		}
+		if !config.Proxy.Enabled() {
+			fmt.Fprintf(os.Stderr, "configuration error: registry is not configured as a pull through cache\n")
+			os.Exit(1)
+		}
+
+		fp, err := os.Open(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open sync spec: %v\n", err)
+			os.Exit(1)
+		}
+		spec, err := proxy.ParseSyncSpec(fp)
+		fp.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid sync spec %s: %v\n", args[1], err)
+			os.Exit(1)
+		}
+
+		ctx := dcontext.Background()
+		ctx, err = configureLogging(ctx, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to configure logging with config: %s", err)
+			os.Exit(1)
+		}
+
+		driver, err := factory.Create(ctx, config.Storage.Type(), config.Storage.Parameters())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct %s driver: %v", config.Storage.Type(), err)
+			os.Exit(1)
+		}
+
+		registry, err := storage.NewRegistry(ctx, driver, storage.DisableDigestResumption)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
+			os.Exit(1)
+		}
+
+		var s scheduler.Scheduler
+		var opt proxy.Option
+		switch {
+		case !proxy.Expires(config.Proxy):
+			opt = proxy.WithoutScheduler()
+		case config.Proxy.Scheduler.Backend == "redis":
+			if config.Redis.Addr == "" {
+				fmt.Fprintf(os.Stderr, "configuration error: redis configuration required to use for proxy scheduler\n")
+				os.Exit(1)
+			}
+			s = scheduler.NewRedis(ctx, handlers.NewRedisClient(config.Redis), config.Proxy.Scheduler.Lease)
+			defer s.Stop()
+			opt = proxy.WithScheduler(s)
+		default:
+			// the registry only reads the expiries of the storage backend
+			// when it starts, and would overwrite the ones of the command
+			fmt.Fprintf(os.Stderr, "configuration error: mirror-sync requires the redis proxy scheduler backend when the cached content expires\n")
+			os.Exit(1)
+		}
+
+		cache, err := proxy.NewRegistryPullThroughCache(ctx, registry, driver, config.Proxy, opt)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to construct pull through cache: %v", err)
+			os.Exit(1)
+		}
+
+		for {
+			stats, err := proxy.Sync(ctx, cache, spec)
+			dcontext.GetLogger(ctx).Infof("synced %d tags, %d manifests and %d blobs", stats.Tags, stats.Manifests, stats.Blobs)
+			if err != nil {
+				if spec.Interval == 0 {
+					fmt.Fprintf(os.Stderr, "failed to sync: %v", err)
+					if s != nil {
+						s.Stop()
+					}
+					os.Exit(1)
+				}
+				dcontext.GetLogger(ctx).Errorf("failed to sync: %v", err)
+			}
+
+			if spec.Interval == 0 {
+				return
+			}
+			time.Sleep(spec.Interval)
+		}
+	},
+}
@@ -7,8 +7,10 @@ import (
 	"path"
 	"strings"
 
+	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
 )
 
 // Returns a list, or partial list, of repositories in the registry.
@@ -81,14 +83,80 @@ func (reg *registry) Enumerate(ctx context.Context, ingester func(string) error)
 	return err
 }
 
-// Remove removes a repository from storage
+// Remove removes a repository from storage, along with the descriptors
+// cached for its blobs.
 func (reg *registry) Remove(ctx context.Context, name reference.Named) error {
+	if !reg.deleteEnabled {
+		return distribution.ErrUnsupported
+	}
+
 	root, err := pathFor(repositoriesRootPathSpec{})
 	if err != nil {
 		return err
 	}
+
+	// the blob links are gathered beforehand, as they are gone once the
+	// repository is deleted
+	linked, err := reg.linkedBlobs(ctx, name)
+	if err != nil {
+		return err
+	}
+
 	repoDir := path.Join(root, name.Name())
-	return reg.driver.Delete(ctx, repoDir)
+	if err := reg.driver.Delete(ctx, repoDir); err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return distribution.ErrRepositoryUnknown{Name: name.Name()}
+		}
+		return err
+	}
+
+	if reg.blobDescriptorCacheProvider == nil {
+		return nil
+	}
+
+	descriptorCache, err := reg.blobDescriptorCacheProvider.RepositoryScoped(name.Name())
+	if err != nil {
+		return err
+	}
+	for _, dgst := range linked {
+		if err := descriptorCache.Clear(ctx, dgst); err != nil && err != distribution.ErrBlobUnknown {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// linkedBlobs returns the digests of the blobs linked into the named
+// repository, if blob descriptors are cached.
+func (reg *registry) linkedBlobs(ctx context.Context, name reference.Named) ([]digest.Digest, error) {
+	if reg.blobDescriptorCacheProvider == nil {
+		return nil, nil
+	}
+
+	layersPath, err := pathFor(layersPathSpec{name: name.Name()})
+	if err != nil {
+		return nil, err
+	}
+
+	var linked []digest.Digest
+	err = reg.driver.Walk(ctx, layersPath, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() || path.Base(fileInfo.Path()) != "link" {
+			return nil
+		}
+
+		dgst, err := reg.blobStore.readlink(ctx, fileInfo.Path())
+		if err != nil {
+			return err
+		}
+		linked = append(linked, dgst)
+		return nil
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil, nil
+	}
+
+	return linked, err
 }
 
 // lessPath returns true if one path a is less than path b.
@@ -197,6 +197,66 @@ func TestCatalogEnumerate(t *testing.T) {
 	}
 }
 
+func TestRemoveRepository(t *testing.T) {
+	ctx := context.Background()
+	cacheProvider := memory.NewInMemoryBlobDescriptorCacheProvider(memory.UnlimitedSize)
+	registry, err := NewRegistry(ctx, inmemory.New(), BlobDescriptorCacheProvider(cacheProvider), EnableDelete)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	named, _ := reference.WithName("foo/remove")
+	repo, _ := registry.Repository(ctx, named)
+
+	layers, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testutil.UploadBlobs(repo, layers); err != nil {
+		t.Fatalf("failed to upload layers: %v", err)
+	}
+
+	descriptorCache, err := cacheProvider.RepositoryScoped(named.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for dgst := range layers {
+		// populate the cache
+		if _, err := repo.Blobs(ctx).Stat(ctx, dgst); err != nil {
+			t.Fatalf("unexpected error stating blob: %v", err)
+		}
+		if _, err := descriptorCache.Stat(ctx, dgst); err != nil {
+			t.Fatalf("expected descriptor of %s to be cached: %v", dgst, err)
+		}
+	}
+
+	remover := registry.(distribution.RepositoryRemover)
+	if err := remover.Remove(ctx, named); err != nil {
+		t.Fatalf("unexpected error removing repository: %v", err)
+	}
+
+	for dgst := range layers {
+		if _, err := descriptorCache.Stat(ctx, dgst); err != distribution.ErrBlobUnknown {
+			t.Errorf("expected descriptor of %s to be cleared, got %v", dgst, err)
+		}
+	}
+
+	err = remover.Remove(ctx, named)
+	if _, ok := err.(distribution.ErrRepositoryUnknown); !ok {
+		t.Errorf("expected ErrRepositoryUnknown removing repository twice, got %v", err)
+	}
+}
+
+func TestRemoveRepositoryDeleteDisabled(t *testing.T) {
+	env := setupFS(t)
+
+	named, _ := reference.WithName("foo/a")
+	err := env.registry.(distribution.RepositoryRemover).Remove(env.ctx, named)
+	if err != distribution.ErrUnsupported {
+		t.Errorf("expected ErrUnsupported with delete disabled, got %v", err)
+	}
+}
+
 func testEq(a, b []string, size int) bool {
 	for cnt := 0; cnt < size-1; cnt++ {
 		if a[cnt] != b[cnt] {
@@ -2,72 +2,570 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/internal/dcontext"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/registry/storage/cache"
 	"github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/reference"
 	"github.com/opencontainers/go-digest"
 )
 
-func emit(format string, a ...interface{}) {
-	fmt.Printf(format+"\n", a...)
+// garbageCollector holds the parameters of a single garbage collection.
+type garbageCollector struct {
+	ctx      context.Context
+	driver   driver.StorageDriver
+	registry distribution.Namespace
+	opts     GCOpts
+}
+
+func newGarbageCollector(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, opts GCOpts) *garbageCollector {
+	if opts.Output == nil {
+		opts.Output = os.Stdout
+	}
+	return &garbageCollector{
+		ctx:      ctx,
+		driver:   storageDriver,
+		registry: registry,
+		opts:     opts,
+	}
+}
+
+func (gc *garbageCollector) emit(format string, a ...interface{}) {
+	fmt.Fprintf(gc.opts.Output, format+"\n", a...)
 }
 
 // GCOpts contains options for garbage collector
 type GCOpts struct {
 	DryRun         bool
 	RemoveUntagged bool
+
+	// RemoveReferrers removes untagged manifests referring to another
+	// manifest through their subject, such as signatures and SBOMs, along
+	// with the manifest they refer to. Without it, untagged referrers are
+	// always kept. It only has an effect together with RemoveUntagged.
+	RemoveReferrers bool
+
+	// GracePeriod enables online garbage collection, which does not require
+	// the registry to be read-only. Blobs written and manifests or blobs
+	// linked into a repository less than GracePeriod before the collection
+	// started, or since then, are not deleted. The latter is checked right
+	// before each deletion, without locking the registry, so content linked
+	// in between is still deleted.
+	GracePeriod time.Duration
+
+	// Concurrency is the number of repositories marked, and of manifests and
+	// blobs swept, in parallel. It defaults to 1.
+	Concurrency int
+
+	// ProgressInterval is the number of repositories after which the
+	// progress of the mark phase is reported. Zero disables reporting.
+	ProgressInterval int
+
+	// Checkpoint is the path of a local file the progress of the mark phase
+	// is saved to along with each progress report, and once marking is
+	// complete. A collection resumes from an existing checkpoint, which is
+	// removed once the collection succeeds.
+	Checkpoint string
+
+	// Output receives the progress of the collection. It defaults to
+	// os.Stdout.
+	Output io.Writer
+
+	// Listener, if set, is notified of the manifests and blobs deleted by
+	// the sweep phase.
+	Listener GCListener
+
+	// Quotas, if set, has its usage rebuilt once the sweep phase deleted
+	// any content, as the deleted content is not accounted otherwise.
+	Quotas *QuotaTracker
+}
+
+// GCListener is notified of the content deleted by a garbage collection.
+// Blobs are deleted from the registry as a whole, rather than from a
+// repository.
+type GCListener interface {
+	ManifestDeleted(repo reference.Named, dgst digest.Digest) error
+	BlobSwept(dgst digest.Digest) error
+}
+
+// GCPlan lists the content deleted by a garbage collection, as determined by
+// its mark phase.
+type GCPlan struct {
+	// Repositories are the repositories which have been scanned.
+	Repositories []string      `json:"repositories"`
+	Manifests    []ManifestDel `json:"manifests"`
+	Blobs        []BlobDel     `json:"blobs"`
+
+	// RemoveReferrers is set if the referrers index of the deleted manifests
+	// is deleted as well.
+	RemoveReferrers bool `json:"removeReferrers,omitempty"`
+
+	// ReclaimedBytes is the total size of the deleted blobs.
+	ReclaimedBytes int64 `json:"reclaimedBytes"`
+
+	// LinkedIn lists the repositories the deleted blobs are linked into,
+	// for clearing them from the blob descriptor cache of the repositories.
+	LinkedIn map[digest.Digest][]string `json:"linkedIn,omitempty"`
+
+	// Cutoff is set when collecting online. Manifests and blobs written or
+	// linked into any repository after it are kept by the sweep phase.
+	Cutoff *time.Time `json:"cutoff,omitempty"`
+}
+
+// BlobDel contains blob which will be deleted
+type BlobDel struct {
+	Digest digest.Digest `json:"digest"`
+	Size   int64         `json:"size"`
+}
+
+// referrerDel is an untagged referrer which is only eligible for deletion
+// if its subject is deleted as well.
+type referrerDel struct {
+	ManifestDel
+	Subject digest.Digest `json:"subject"`
 }
 
 // ManifestDel contains manifest structure which will be deleted
 type ManifestDel struct {
-	Name   string
-	Digest digest.Digest
-	Tags   []string
+	Name   string        `json:"name"`
+	Digest digest.Digest `json:"digest"`
+
+	// Tags are the tags whose index references the manifest, whose index
+	// entries are deleted along with it.
+	Tags []string `json:"tags"`
+}
+
+// markState holds the results of the mark phase. It is safe for concurrent
+// use by the mark workers.
+type markState struct {
+	mu sync.Mutex
+
+	// started is the time the collection started, which is kept when
+	// resuming it from a checkpoint.
+	started time.Time
+
+	// repositories are the repositories which have been marked
+	repositories map[string]struct{}
+	markSet      map[digest.Digest]struct{}
+	manifestArr  []ManifestDel
+	referrerArr  []referrerDel
+
+	// pending are the digests marked by the repositories being marked, which
+	// are only part of a checkpoint once their repository is marked.
+	pending map[string][]digest.Digest
+
+	// complete is set once all repositories have been marked
+	complete bool
+}
+
+func newMarkState() *markState {
+	return &markState{
+		started:      time.Now(),
+		repositories: make(map[string]struct{}),
+		markSet:      make(map[digest.Digest]struct{}),
+		manifestArr:  make([]ManifestDel, 0),
+		referrerArr:  make([]referrerDel, 0),
+		pending:      make(map[string][]digest.Digest),
+	}
+}
+
+// mark marks the digest on behalf of the named repository, and returns
+// whether it was already marked. The caller must hold the lock of the state.
+func (state *markState) mark(repoName string, d digest.Digest) bool {
+	_, marked := state.markSet[d]
+	if !marked {
+		state.markSet[d] = struct{}{}
+		state.pending[repoName] = append(state.pending[repoName], d)
+	}
+	return marked
+}
+
+// repositoryMarked records the named repository as marked along with the
+// manifests of the repository eligible for deletion. The caller must hold the
+// lock of the state.
+func (state *markState) repositoryMarked(repoName string, manifests []ManifestDel, referrers []referrerDel) {
+	state.repositories[repoName] = struct{}{}
+	state.manifestArr = append(state.manifestArr, manifests...)
+	state.referrerArr = append(state.referrerArr, referrers...)
+	delete(state.pending, repoName)
+}
+
+// marker returns an ingester for markManifestReferences, which marks the
+// references of manifests of the named repository.
+func (gc *garbageCollector) marker(state *markState, repoName string) func(digest.Digest) bool {
+	return func(d digest.Digest) bool {
+		state.mu.Lock()
+		defer state.mu.Unlock()
+
+		marked := state.mark(repoName, d)
+		if !marked {
+			gc.emit("%s: marking blob %s", repoName, d)
+		}
+		return marked
+	}
 }
 
 // MarkAndSweep performs a mark and sweep of registry data
 func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, opts GCOpts) error {
+	plan, err := PlanGarbageCollection(ctx, storageDriver, registry, opts)
+	if err != nil {
+		return err
+	}
+	if opts.DryRun {
+		return nil
+	}
+
+	return ApplyGCPlan(ctx, storageDriver, registry, plan, opts)
+}
+
+// PlanGarbageCollection performs the mark phase of a garbage collection and
+// returns the manifests and blobs which are eligible for deletion, without
+// deleting anything.
+func PlanGarbageCollection(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, opts GCOpts) (*GCPlan, error) {
+	gc := newGarbageCollector(ctx, storageDriver, registry, opts)
+
 	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
 	if !ok {
-		return fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+		return nil, fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
 	}
 
 	// mark
-	markSet := make(map[digest.Digest]struct{})
-	manifestArr := make([]ManifestDel, 0)
-	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
-		emit(repoName)
-
+	state := newMarkState()
+	if opts.Checkpoint != "" {
 		var err error
-		named, err := reference.WithName(repoName)
+		state, err = gc.loadCheckpoint()
 		if err != nil {
-			return fmt.Errorf("failed to parse repo name %s: %v", repoName, err)
+			return nil, fmt.Errorf("failed to load checkpoint: %v", err)
 		}
-		repository, err := registry.Repository(ctx, named)
+	}
+
+	// content written after cutoff is kept when collecting online. A resumed
+	// collection keeps the cutoff of the original run, as content may have
+	// been pushed since to the repositories it already marked.
+	var cutoff time.Time
+	if opts.GracePeriod > 0 {
+		cutoff = state.started.Add(-opts.GracePeriod)
+	}
+
+	if !state.complete {
+		err := forEachConcurrently(opts.Concurrency, func(ingest func(string) error) error {
+			return repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+				state.mu.Lock()
+				_, marked := state.repositories[repoName]
+				state.mu.Unlock()
+				if marked {
+					return nil
+				}
+				return ingest(repoName)
+			})
+		}, func(repoName string) error {
+			manifests, referrers, err := gc.markRepository(repoName, state)
+			if err != nil {
+				return err
+			}
+
+			state.mu.Lock()
+			defer state.mu.Unlock()
+
+			state.repositoryMarked(repoName, manifests, referrers)
+			if opts.ProgressInterval > 0 && len(state.repositories)%opts.ProgressInterval == 0 {
+				gc.emit("%d repositories marked", len(state.repositories))
+				if opts.Checkpoint != "" {
+					return saveCheckpoint(opts.Checkpoint, opts, state)
+				}
+			}
+			return nil
+		})
 		if err != nil {
-			return fmt.Errorf("failed to construct repository: %v", err)
+			return nil, fmt.Errorf("failed to mark: %v", err)
 		}
 
-		manifestService, err := repository.Manifests(ctx)
+		state.complete = true
+		if opts.Checkpoint != "" {
+			if err := saveCheckpoint(opts.Checkpoint, opts, state); err != nil {
+				return nil, fmt.Errorf("failed to mark: %v", err)
+			}
+		}
+	}
+
+	markSet := state.markSet
+	manifestArr := state.manifestArr
+
+	deletedReferrers, err := gc.markReferrers(state.referrerArr, markSet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark: %v", err)
+	}
+	manifestArr = append(manifestArr, deletedReferrers...)
+
+	plan := &GCPlan{
+		Repositories:    make([]string, 0, len(state.repositories)),
+		Blobs:           make([]BlobDel, 0),
+		RemoveReferrers: opts.RemoveReferrers,
+	}
+	if !cutoff.IsZero() {
+		plan.Cutoff = &cutoff
+	}
+	for repoName := range state.repositories {
+		plan.Repositories = append(plan.Repositories, repoName)
+	}
+	sort.Strings(plan.Repositories)
+
+	var linkedIn map[digest.Digest][]string
+	if !cutoff.IsZero() {
+		// content pushed to a repository after it has been marked would
+		// otherwise be swept
+		linkedIn, err = gc.markRecentlyLinked(cutoff, markSet)
 		if err != nil {
-			return fmt.Errorf("failed to construct manifest service: %v", err)
+			return nil, fmt.Errorf("failed to mark: %v", err)
 		}
+	}
 
-		manifestEnumerator, ok := manifestService.(distribution.ManifestEnumerator)
-		if !ok {
-			return fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
+	plan.Manifests = gc.unmarkReferencedManifest(manifestArr, markSet)
+
+	blobService := registry.Blobs()
+	blobStatter := registry.BlobStatter()
+	err = blobService.Enumerate(ctx, func(dgst digest.Digest) error {
+		// check if digest is in markSet. If not, delete it!
+		if _, ok := markSet[dgst]; ok {
+			return nil
+		}
+
+		if !cutoff.IsZero() {
+			recent, err := writtenSince(ctx, storageDriver, dgst, cutoff)
+			if err != nil {
+				return err
+			}
+			if recent {
+				gc.emit("blob %s is within the grace period, skipping", dgst)
+				return nil
+			}
+		}
+
+		blob := BlobDel{Digest: dgst}
+		if desc, err := blobStatter.Stat(ctx, dgst); err == nil {
+			blob.Size = desc.Size
+		}
+		plan.Blobs = append(plan.Blobs, blob)
+		plan.ReclaimedBytes += blob.Size
+		if repos, ok := linkedIn[dgst]; ok {
+			if plan.LinkedIn == nil {
+				plan.LinkedIn = make(map[digest.Digest][]string)
+			}
+			plan.LinkedIn[dgst] = repos
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error enumerating blobs: %v", err)
+	}
+	gc.emit("\n%d blobs marked, %d blobs and %d manifests eligible for deletion", len(markSet), len(plan.Blobs), len(plan.Manifests))
+	for _, blob := range plan.Blobs {
+		gc.emit("blob eligible for deletion: %s", blob.Digest)
+	}
+
+	if opts.DryRun && opts.Checkpoint != "" {
+		if err := removeCheckpoint(opts.Checkpoint); err != nil {
+			return nil, err
+		}
+	}
+
+	return plan, nil
+}
+
+// ApplyGCPlan performs the sweep phase of a garbage collection, deleting the
+// manifests and blobs listed in the plan. Manifests tagged again since the
+// plan was made are kept, along with the manifests and blobs they reference.
+// When collecting online, manifests and blobs written or linked into any
+// repository after the cutoff of the plan are kept as well, which is checked
+// right before deleting each of them.
+func ApplyGCPlan(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, plan *GCPlan, opts GCOpts) error {
+	vacuum := NewVacuum(ctx, storageDriver)
+
+	kept, err := retaggedContent(ctx, storageDriver, registry, plan.Manifests, plan.Cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to check tags of manifests: %v", err)
+	}
+
+	var links *linkChecker
+	if plan.Cutoff != nil {
+		links = newLinkChecker(ctx, storageDriver, registry, *plan.Cutoff)
+	}
+
+	err = forEachConcurrently(opts.Concurrency, sliceEnumerator(plan.Manifests), func(obj ManifestDel) error {
+		if _, ok := kept[obj.Digest]; ok {
+			dcontext.GetLogger(ctx).Infof("manifest %s@%s has been tagged or pushed again since the plan was made, keeping it", obj.Name, obj.Digest)
+			return nil
+		}
+		err := vacuum.RemoveManifest(obj.Name, obj.Digest, obj.Tags)
+		if err != nil && !isPathNotFound(err) {
+			return fmt.Errorf("failed to delete manifest %s: %v", obj.Digest, err)
+		}
+		if err == nil && opts.Listener != nil {
+			notifyManifestDeleted(ctx, opts.Listener, obj)
+		}
+		if plan.RemoveReferrers {
+			err = vacuum.RemoveReferrers(obj.Name, obj.Digest)
+			if err != nil {
+				return fmt.Errorf("failed to delete referrers of manifest %s: %v", obj.Digest, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = forEachConcurrently(opts.Concurrency, sliceEnumerator(plan.Blobs), func(blob BlobDel) error {
+		if _, ok := kept[blob.Digest]; ok {
+			return nil
+		}
+		if links != nil {
+			recent, err := links.linkedSince(blob.Digest)
+			if err != nil {
+				return fmt.Errorf("failed to check links of blob %s: %v", blob.Digest, err)
+			}
+			if recent {
+				dcontext.GetLogger(ctx).Infof("blob %s has been written or linked since the collection started, keeping it", blob.Digest)
+				return nil
+			}
+		}
+		err := vacuum.RemoveBlob(string(blob.Digest))
+		if err != nil && !isPathNotFound(err) {
+			return fmt.Errorf("failed to delete blob %s: %v", blob.Digest, err)
+		}
+		if err == nil && opts.Listener != nil {
+			if err := opts.Listener.BlobSwept(blob.Digest); err != nil {
+				dcontext.GetLogger(ctx).Errorf("error dispatching deletion of blob %s to listener: %v", blob.Digest, err)
+			}
+		}
+		err = clearCachedDescriptor(ctx, registry, blob.Digest, plan.LinkedIn[blob.Digest])
+		if err != nil {
+			return fmt.Errorf("failed to clear cached descriptor of blob %s: %v", blob.Digest, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if opts.Quotas != nil && (len(plan.Manifests) > 0 || len(plan.Blobs) > 0) {
+		// the usage is outdated but the collection succeeded
+		if _, err := opts.Quotas.Rebuild(ctx, registry); err != nil {
+			dcontext.GetLogger(ctx).Errorf("failed to rebuild quota usage: %v", err)
+		}
+	}
+
+	if opts.Checkpoint != "" {
+		return removeCheckpoint(opts.Checkpoint)
+	}
+	return nil
+}
+
+// retaggedContent returns the digests of the manifests to delete which are
+// tagged, or linked into their repository after cutoff if set, along with
+// the digests of the manifests and blobs they reference.
+func retaggedContent(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, manifests []ManifestDel, cutoff *time.Time) (map[digest.Digest]struct{}, error) {
+	kept := make(map[digest.Digest]struct{})
+	for _, obj := range manifests {
+		if _, ok := kept[obj.Digest]; ok {
+			continue
+		}
+
+		repository, manifestService, err := repositoryManifests(ctx, registry, obj.Name)
+		if err != nil {
+			return nil, err
+		}
+		tags, err := repository.Tags(ctx).Lookup(ctx, distribution.Descriptor{Digest: obj.Digest})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve tags for digest %v: %v", obj.Digest, err)
+		}
+		keep := len(tags) > 0
+		if !keep && cutoff != nil {
+			linkPath, err := pathFor(manifestRevisionLinkPathSpec{name: obj.Name, revision: obj.Digest})
+			if err != nil {
+				return nil, err
+			}
+			keep, err = modifiedSince(ctx, storageDriver, linkPath, *cutoff)
+			if err != nil {
+				return nil, err
+			}
 		}
+		if !keep {
+			continue
+		}
+
+		kept[obj.Digest] = struct{}{}
+		err = markManifestReferences(obj.Digest, manifestService, ctx, func(d digest.Digest) bool {
+			_, marked := kept[d]
+			kept[d] = struct{}{}
+			return marked
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return kept, nil
+}
+
+// notifyManifestDeleted notifies the listener of the deletion of a manifest.
+// Failing to do so does not fail the collection.
+func notifyManifestDeleted(ctx context.Context, listener GCListener, obj ManifestDel) {
+	named, err := reference.WithName(obj.Name)
+	if err == nil {
+		err = listener.ManifestDeleted(named, obj.Digest)
+	}
+	if err != nil {
+		dcontext.GetLogger(ctx).Errorf("error dispatching deletion of manifest %s@%s to listener: %v", obj.Name, obj.Digest, err)
+	}
+}
+
+// markRepository marks the manifests of the named repository which are kept
+// along with their references, and returns the manifests and referrers
+// eligible for deletion.
+func (gc *garbageCollector) markRepository(repoName string, state *markState) ([]ManifestDel, []referrerDel, error) {
+	ctx, opts := gc.ctx, gc.opts
+	gc.emit(repoName)
+
+	repository, manifestService, err := repositoryManifests(ctx, gc.registry, repoName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	manifestEnumerator, ok := manifestService.(distribution.ManifestEnumerator)
+	if !ok {
+		return nil, nil, fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
+	}
+
+	var manifests []ManifestDel
+	var referrers []referrerDel
 
-		err = manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
-			if opts.RemoveUntagged {
-				// fetch all tags where this manifest is the latest one
-				tags, err := repository.Tags(ctx).Lookup(ctx, distribution.Descriptor{Digest: dgst})
+	err = manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+		if opts.RemoveUntagged {
+			// fetch all tags where this manifest is the latest one
+			tags, err := repository.Tags(ctx).Lookup(ctx, distribution.Descriptor{Digest: dgst})
+			if err != nil {
+				return fmt.Errorf("failed to retrieve tags for digest %v: %v", dgst, err)
+			}
+			if len(tags) == 0 {
+				subject, err := manifestSubjectOf(ctx, manifestService, dgst)
 				if err != nil {
-					return fmt.Errorf("failed to retrieve tags for digest %v: %v", dgst, err)
+					return err
 				}
-				if len(tags) == 0 {
+
+				// untagged referrers are kept unless they may be
+				// removed along with their subject
+				if subject == nil || opts.RemoveReferrers {
 					// fetch all tags from repository
 					// all of these tags could contain manifest in history
 					// which means that we need check (and delete) those references when deleting manifest
@@ -78,88 +576,485 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 						}
 						return fmt.Errorf("failed to retrieve tags %v", err)
 					}
-					manifestArr = append(manifestArr, ManifestDel{Name: repoName, Digest: dgst, Tags: allTags})
+					tags, err := gc.indexedTags(repoName, dgst, allTags)
+					if err != nil {
+						return err
+					}
+
+					manifestDel := ManifestDel{Name: repoName, Digest: dgst, Tags: tags}
+
+					if subject != nil {
+						referrers = append(referrers, referrerDel{
+							ManifestDel: manifestDel,
+							Subject:     subject.Digest,
+						})
+					} else {
+						manifests = append(manifests, manifestDel)
+					}
 					return nil
 				}
 			}
-			// Mark the manifest's blob
-			emit("%s: marking manifest %s ", repoName, dgst)
-			markSet[dgst] = struct{}{}
+		}
+		// Mark the manifest's blob
+		gc.emit("%s: marking manifest %s ", repoName, dgst)
+		state.mu.Lock()
+		state.mark(repoName, dgst)
+		state.mu.Unlock()
+
+		return markManifestReferences(dgst, manifestService, ctx, gc.marker(state, repoName))
+	})
+
+	// In certain situations such as unfinished uploads, deleting all
+	// tags in S3 or removing the _manifests folder manually, this
+	// error may be of type PathNotFound.
+	//
+	// In these cases we can continue marking other manifests safely.
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return manifests, referrers, nil
+	}
+
+	return manifests, referrers, err
+}
+
+// indexedTags returns the tags among allTags whose index references the
+// manifest.
+func (gc *garbageCollector) indexedTags(repoName string, dgst digest.Digest, allTags []string) ([]string, error) {
+	tags := make([]string, 0)
+	for _, tag := range allTags {
+		indexPath, err := pathFor(manifestTagIndexEntryPathSpec{name: repoName, revision: dgst, tag: tag})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := gc.driver.Stat(gc.ctx, indexPath); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				continue
+			}
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// repositoryManifests returns the named repository and its manifest service.
+func repositoryManifests(ctx context.Context, registry distribution.Namespace, repoName string) (distribution.Repository, distribution.ManifestService, error) {
+	named, err := reference.WithName(repoName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse repo name %s: %v", repoName, err)
+	}
+	repository, err := registry.Repository(ctx, named)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to construct repository: %v", err)
+	}
+
+	manifestService, err := repository.Manifests(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to construct manifest service: %v", err)
+	}
+
+	return repository, manifestService, nil
+}
+
+// errStopped is returned to an enumerator once a worker failed.
+var errStopped = errors.New("stopped")
+
+// forEachConcurrently calls fn with each item ingested by enumerate, using
+// the given number of goroutines. It stops at, and returns, the first error.
+func forEachConcurrently[T any](concurrency int, enumerate func(ingest func(T) error) error, fn func(T) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	items := make(chan T)
+	failed := make(chan struct{})
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range items {
+				select {
+				case <-failed:
+					continue
+				default:
+				}
+
+				if err := fn(item); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						close(failed)
+					})
+				}
+			}
+		}()
+	}
+
+	err := enumerate(func(item T) error {
+		select {
+		case items <- item:
+			return nil
+		case <-failed:
+			return errStopped
+		}
+	})
+	close(items)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return err
+}
+
+// sliceEnumerator returns an enumerator for forEachConcurrently over the
+// items of a slice.
+func sliceEnumerator[T any](items []T) func(func(T) error) error {
+	return func(ingest func(T) error) error {
+		for _, item := range items {
+			if err := ingest(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// isPathNotFound returns whether err reports content which is already gone,
+// as is the case when a collection resumes an interrupted sweep.
+func isPathNotFound(err error) bool {
+	_, ok := err.(driver.PathNotFoundError)
+	return ok
+}
+
+// unmarkReferencedManifest filters out manifest present in markSet
+func (gc *garbageCollector) unmarkReferencedManifest(manifestArr []ManifestDel, markSet map[digest.Digest]struct{}) []ManifestDel {
+	filtered := make([]ManifestDel, 0)
+	for _, obj := range manifestArr {
+		if _, ok := markSet[obj.Digest]; !ok {
+			gc.emit("manifest eligible for deletion: %s", obj)
+			filtered = append(filtered, obj)
+		}
+	}
+	return filtered
+}
+
+// markReferrers marks the untagged referrers whose subject is marked, along
+// with their references. As marking a referrer may in turn keep the
+// referrers of that referrer, this is repeated until no more referrers can be
+// marked. The remaining referrers are returned as eligible for deletion.
+func (gc *garbageCollector) markReferrers(referrerArr []referrerDel, markSet map[digest.Digest]struct{}) ([]ManifestDel, error) {
+	for {
+		remaining := make([]referrerDel, 0, len(referrerArr))
+		for _, obj := range referrerArr {
+			if _, ok := markSet[obj.Subject]; !ok {
+				remaining = append(remaining, obj)
+				continue
+			}
+
+			gc.emit("%s: marking referrer %s of manifest %s", obj.Name, obj.Digest, obj.Subject)
+			markSet[obj.Digest] = struct{}{}
 
-			return markManifestReferences(dgst, manifestService, ctx, func(d digest.Digest) bool {
+			_, manifestService, err := repositoryManifests(gc.ctx, gc.registry, obj.Name)
+			if err != nil {
+				return nil, err
+			}
+			err = markManifestReferences(obj.Digest, manifestService, gc.ctx, func(d digest.Digest) bool {
 				_, marked := markSet[d]
 				if !marked {
 					markSet[d] = struct{}{}
-					emit("%s: marking blob %s", repoName, d)
+					gc.emit("%s: marking blob %s", obj.Name, d)
 				}
 				return marked
 			})
-		})
+			if err != nil {
+				return nil, err
+			}
+		}
 
-		// In certain situations such as unfinished uploads, deleting all
-		// tags in S3 or removing the _manifests folder manually, this
-		// error may be of type PathNotFound.
-		//
-		// In these cases we can continue marking other manifests safely.
-		if _, ok := err.(driver.PathNotFoundError); ok {
-			return nil
+		if len(remaining) == len(referrerArr) {
+			break
 		}
+		referrerArr = remaining
+	}
 
-		return err
-	})
+	manifestArr := make([]ManifestDel, 0, len(referrerArr))
+	for _, obj := range referrerArr {
+		manifestArr = append(manifestArr, obj.ManifestDel)
+	}
+	return manifestArr, nil
+}
+
+// manifestSubjectOf returns the subject of the manifest identified by dgst,
+// if any.
+func manifestSubjectOf(ctx context.Context, manifestService distribution.ManifestService, dgst digest.Digest) (*distribution.Descriptor, error) {
+	manifest, err := manifestService.Get(ctx, dgst)
 	if err != nil {
-		return fmt.Errorf("failed to mark: %v", err)
+		return nil, fmt.Errorf("failed to retrieve manifest for digest %v: %v", dgst, err)
 	}
 
-	manifestArr = unmarkReferencedManifest(manifestArr, markSet)
+	switch m := manifest.(type) {
+	case *ocischema.DeserializedManifest:
+		return m.Subject, nil
+	case *ocischema.DeserializedImageIndex:
+		return m.Subject, nil
+	}
+	return nil, nil
+}
 
-	// sweep
-	vacuum := NewVacuum(ctx, storageDriver)
-	if !opts.DryRun {
-		for _, obj := range manifestArr {
-			err = vacuum.RemoveManifest(obj.Name, obj.Digest, obj.Tags)
-			if err != nil {
-				return fmt.Errorf("failed to delete manifest %s: %v", obj.Digest, err)
+// markRecentlyLinked marks the manifests and blobs linked into any
+// repository after since, along with the references of those manifests. If
+// the registry caches blob descriptors, the repositories each layer is linked
+// into are returned, so that the cache can be cleared once it is swept.
+func (gc *garbageCollector) markRecentlyLinked(since time.Time, markSet map[digest.Digest]struct{}) (map[digest.Digest][]string, error) {
+	ctx, storageDriver, registry := gc.ctx, gc.driver, gc.registry
+
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return nil, err
+	}
+
+	var linkedIn map[digest.Digest][]string
+	if descriptorCache(registry) != nil {
+		linkedIn = make(map[digest.Digest][]string)
+	}
+
+	err = storageDriver.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		filePath := fileInfo.Path()
+		if fileInfo.IsDir() || path.Base(filePath) != "link" {
+			return nil
+		}
+
+		repoName, isManifest, ok := splitLinkPath(root, filePath)
+		if !ok {
+			return nil
+		}
+
+		recent := fileInfo.ModTime().After(since)
+		if !recent && (isManifest || linkedIn == nil) {
+			return nil
+		}
+
+		content, err := storageDriver.GetContent(ctx, filePath)
+		if err != nil {
+			return err
+		}
+		dgst, err := digest.Parse(string(content))
+		if err != nil {
+			return err
+		}
+
+		if !isManifest && linkedIn != nil {
+			linkedIn[dgst] = append(linkedIn[dgst], repoName)
+		}
+
+		if _, marked := markSet[dgst]; marked || !recent {
+			return nil
+		}
+		gc.emit("%s: marking recently linked %s", repoName, dgst)
+		markSet[dgst] = struct{}{}
+
+		if !isManifest {
+			return nil
+		}
+
+		_, manifestService, err := repositoryManifests(ctx, registry, repoName)
+		if err != nil {
+			return err
+		}
+
+		if exists, _ := manifestService.Exists(ctx, dgst); !exists {
+			return nil
+		}
+		return markManifestReferences(dgst, manifestService, ctx, func(d digest.Digest) bool {
+			_, marked := markSet[d]
+			if !marked {
+				markSet[d] = struct{}{}
+				gc.emit("%s: marking blob %s", repoName, d)
 			}
+			return marked
+		})
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return linkedIn, nil
+	}
+
+	return linkedIn, err
+}
+
+// splitLinkPath returns the repository a link below the repositories root
+// belongs to and whether it links a manifest rather than a layer.
+func splitLinkPath(root, linkPath string) (repoName string, isManifest bool, ok bool) {
+	repoPath := strings.TrimPrefix(linkPath, root+"/")
+	if i := strings.Index(repoPath, "/_manifests/"); i > 0 {
+		return repoPath[:i], true, true
+	}
+	if i := strings.Index(repoPath, "/_layers/"); i > 0 {
+		return repoPath[:i], false, true
+	}
+	return "", false, false
+}
+
+// writtenSince returns whether the data of the blob has been written after
+// since.
+func writtenSince(ctx context.Context, storageDriver driver.StorageDriver, dgst digest.Digest, since time.Time) (bool, error) {
+	blobPath, err := pathFor(blobDataPathSpec{digest: dgst})
+	if err != nil {
+		return false, err
+	}
+	return modifiedSince(ctx, storageDriver, blobPath, since)
+}
+
+// modifiedSince returns whether the file at filePath exists and has been
+// modified after since.
+func modifiedSince(ctx context.Context, storageDriver driver.StorageDriver, filePath string, since time.Time) (bool, error) {
+	fi, err := storageDriver.Stat(ctx, filePath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return false, nil
 		}
+		return false, err
 	}
-	blobService := registry.Blobs()
-	deleteSet := make(map[digest.Digest]struct{})
-	err = blobService.Enumerate(ctx, func(dgst digest.Digest) error {
-		// check if digest is in markSet. If not, delete it!
-		if _, ok := markSet[dgst]; !ok {
-			deleteSet[dgst] = struct{}{}
+
+	return fi.ModTime().After(since), nil
+}
+
+// linkCheckerRefresh is the interval after which a linkChecker lists the
+// repositories again, so that repositories created while sweeping are
+// checked as well.
+const linkCheckerRefresh = time.Minute
+
+// linkChecker checks whether blobs have been written or linked into any
+// repository after a cutoff, right before they are swept by an online
+// collection. It is safe for concurrent use by the sweep workers.
+type linkChecker struct {
+	ctx      context.Context
+	driver   driver.StorageDriver
+	registry distribution.Namespace
+	since    time.Time
+
+	mu     sync.Mutex
+	repos  []string
+	listed time.Time
+}
+
+func newLinkChecker(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, since time.Time) *linkChecker {
+	return &linkChecker{
+		ctx:      ctx,
+		driver:   storageDriver,
+		registry: registry,
+		since:    since,
+	}
+}
+
+// repositories returns the names of the repositories, listing them again if
+// they were listed more than linkCheckerRefresh ago.
+func (lc *linkChecker) repositories() ([]string, error) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	if lc.repos != nil && time.Since(lc.listed) < linkCheckerRefresh {
+		return lc.repos, nil
+	}
+
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return nil, err
+	}
+
+	// unlike the catalog, the repositories only holding layers are listed,
+	// as a blob may be mounted into a repository before its first manifest
+	// is pushed
+	listed := time.Now()
+	repos := make([]string, 0, len(lc.repos))
+	err = lc.driver.Walk(lc.ctx, root, func(fileInfo driver.FileInfo) error {
+		if !fileInfo.IsDir() {
+			return nil
 		}
-		return nil
+		repoPath := strings.TrimPrefix(fileInfo.Path(), root+"/")
+		dir, file := path.Split(repoPath)
+		if !strings.HasPrefix(file, "_") {
+			return nil
+		}
+		repoName := strings.TrimSuffix(dir, "/")
+		if (file == "_layers" || file == "_manifests") && (len(repos) == 0 || repos[len(repos)-1] != repoName) {
+			repos = append(repos, repoName)
+		}
+		return driver.ErrSkipDir
 	})
+	if err != nil && !isPathNotFound(err) {
+		return nil, err
+	}
+	lc.repos, lc.listed = repos, listed
+	return repos, nil
+}
+
+// linkedSince returns whether the data of the blob has been written, or the
+// blob has been linked into any repository as a layer or a manifest, after
+// the cutoff.
+func (lc *linkChecker) linkedSince(dgst digest.Digest) (bool, error) {
+	recent, err := writtenSince(lc.ctx, lc.driver, dgst, lc.since)
+	if err != nil || recent {
+		return recent, err
+	}
+
+	repos, err := lc.repositories()
 	if err != nil {
-		return fmt.Errorf("error enumerating blobs: %v", err)
+		return false, err
 	}
-	emit("\n%d blobs marked, %d blobs and %d manifests eligible for deletion", len(markSet), len(deleteSet), len(manifestArr))
-	for dgst := range deleteSet {
-		emit("blob eligible for deletion: %s", dgst)
-		if opts.DryRun {
-			continue
-		}
-		err = vacuum.RemoveBlob(string(dgst))
-		if err != nil {
-			return fmt.Errorf("failed to delete blob %s: %v", dgst, err)
+	for _, repoName := range repos {
+		for _, spec := range []pathSpec{
+			layerLinkPathSpec{name: repoName, digest: dgst},
+			manifestRevisionLinkPathSpec{name: repoName, revision: dgst},
+		} {
+			linkPath, err := pathFor(spec)
+			if err != nil {
+				return false, err
+			}
+			recent, err := modifiedSince(lc.ctx, lc.driver, linkPath, lc.since)
+			if err != nil || recent {
+				return recent, err
+			}
 		}
 	}
+	return false, nil
+}
 
-	return err
+// descriptorCache returns the blob descriptor cache of the registry, if any.
+func descriptorCache(ns distribution.Namespace) cache.BlobDescriptorCacheProvider {
+	if reg, ok := ns.(*registry); ok {
+		return reg.blobDescriptorCacheProvider
+	}
+	return nil
 }
 
-// unmarkReferencedManifest filters out manifest present in markSet
-func unmarkReferencedManifest(manifestArr []ManifestDel, markSet map[digest.Digest]struct{}) []ManifestDel {
-	filtered := make([]ManifestDel, 0)
-	for _, obj := range manifestArr {
-		if _, ok := markSet[obj.Digest]; !ok {
-			emit("manifest eligible for deletion: %s", obj)
-			filtered = append(filtered, obj)
+// clearCachedDescriptor removes a swept blob from the blob descriptor cache
+// of the registry, including the scopes of the given repositories, as a
+// running registry would otherwise keep serving it.
+func clearCachedDescriptor(ctx context.Context, ns distribution.Namespace, dgst digest.Digest, repos []string) error {
+	provider := descriptorCache(ns)
+	if provider == nil {
+		return nil
+	}
+
+	if err := provider.Clear(ctx, dgst); err != nil && err != distribution.ErrBlobUnknown {
+		return err
+	}
+	for _, repo := range repos {
+		scoped, err := provider.RepositoryScoped(repo)
+		if err != nil {
+			return err
+		}
+		if err := scoped.Clear(ctx, dgst); err != nil && err != distribution.ErrBlobUnknown {
+			return err
 		}
 	}
-	return filtered
+
+	return nil
 }
 
 // markManifestReferences marks the manifest references
@@ -1,18 +1,28 @@
 package storage
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"os"
 	"path"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/internal/dcontext"
 	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/registry/storage/cache/memory"
 	"github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
 	"github.com/distribution/distribution/v3/testutil"
 	"github.com/distribution/reference"
 	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 type image struct {
@@ -847,3 +857,883 @@ func TestTaggedManifestlistWithDeletedReference(t *testing.T) {
 		t.Fatalf("Garbage collection affected storage: %d != %d", len(after), 0)
 	}
 }
+
+func uploadReferrer(t *testing.T, repository distribution.Repository, subject image) digest.Digest {
+	ctx := dcontext.Background()
+
+	config, err := repository.Blobs(ctx).Put(ctx, v1.MediaTypeImageConfig, []byte(`{"signature":true}`))
+	if err != nil {
+		t.Fatalf("config upload failed: %v", err)
+	}
+	config.MediaType = v1.MediaTypeImageConfig
+
+	_, payload, err := subject.manifest.Payload()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	referrer, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config:    config,
+		Layers:    []distribution.Descriptor{},
+		Subject: &distribution.Descriptor{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    subject.manifestDigest,
+			Size:      int64(len(payload)),
+		},
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	return uploadImage(t, repository, image{manifest: referrer})
+}
+
+func TestUntaggedReferrerOfTaggedManifest(t *testing.T) {
+	ctx := dcontext.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "foo/referrers/tagged")
+	manifestService := makeManifestService(t, repo)
+
+	image1 := uploadRandomOCIImage(t, repo)
+	referrer := uploadReferrer(t, repo, image1)
+	referrerOfReferrer := uploadReferrer(t, repo, image{
+		manifest:       mustGetManifest(t, manifestService, referrer),
+		manifestDigest: referrer,
+	})
+
+	err := repo.Tags(ctx).Tag(ctx, "test", distribution.Descriptor{Digest: image1.manifestDigest})
+	if err != nil {
+		t.Fatalf("Failed to tag manifest: %v", err)
+	}
+
+	before := allBlobs(t, registry)
+
+	// Run GC
+	err = MarkAndSweep(dcontext.Background(), inmemoryDriver, registry, GCOpts{
+		DryRun:          false,
+		RemoveUntagged:  true,
+		RemoveReferrers: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	after := allBlobs(t, registry)
+	if len(before) != len(after) {
+		t.Fatalf("Garbage collection affected blobs storage: %d != %d", len(before), len(after))
+	}
+
+	afterManifests := allManifests(t, manifestService)
+	for _, dgst := range []digest.Digest{image1.manifestDigest, referrer, referrerOfReferrer} {
+		if _, ok := afterManifests[dgst]; !ok {
+			t.Fatalf("Manifest %s is missing", dgst)
+		}
+	}
+}
+
+func TestUntaggedReferrerOfUntaggedManifest(t *testing.T) {
+	for _, removeReferrers := range []bool{false, true} {
+		ctx := dcontext.Background()
+		inmemoryDriver := inmemory.New()
+
+		registry := createRegistry(t, inmemoryDriver)
+		repo := makeRepository(t, registry, "foo/referrers/untagged")
+		manifestService := makeManifestService(t, repo)
+
+		image1 := uploadRandomOCIImage(t, repo)
+		referrer := uploadReferrer(t, repo, image1)
+
+		err := repo.Tags(ctx).Tag(ctx, "test", distribution.Descriptor{Digest: image1.manifestDigest})
+		if err != nil {
+			t.Fatalf("Failed to tag manifest: %v", err)
+		}
+		err = repo.Tags(ctx).Untag(ctx, "test")
+		if err != nil {
+			t.Fatalf("Failed to delete tag: %v", err)
+		}
+
+		// Run GC
+		err = MarkAndSweep(dcontext.Background(), inmemoryDriver, registry, GCOpts{
+			DryRun:          false,
+			RemoveUntagged:  true,
+			RemoveReferrers: removeReferrers,
+		})
+		if err != nil {
+			t.Fatalf("Failed mark and sweep: %v", err)
+		}
+
+		afterManifests := allManifests(t, manifestService)
+		if _, ok := afterManifests[image1.manifestDigest]; ok {
+			t.Fatalf("Untagged manifest %s was not deleted", image1.manifestDigest)
+		}
+
+		_, ok := afterManifests[referrer]
+		if removeReferrers && ok {
+			t.Fatalf("Referrer %s was not deleted along with its subject", referrer)
+		}
+		if !removeReferrers && !ok {
+			t.Fatalf("Referrer %s was deleted without RemoveReferrers", referrer)
+		}
+
+		referrersPath, err := pathFor(manifestReferrersPathSpec{name: "foo/referrers/untagged", subject: image1.manifestDigest})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = inmemoryDriver.Stat(ctx, referrersPath)
+		if _, notFound := err.(driver.PathNotFoundError); removeReferrers != notFound {
+			t.Fatalf("Unexpected state of referrers index %s: %v", referrersPath, err)
+		}
+	}
+}
+
+func mustGetManifest(t *testing.T, manifestService distribution.ManifestService, dgst digest.Digest) distribution.Manifest {
+	manifest, err := manifestService.Get(dcontext.Background(), dgst)
+	if err != nil {
+		t.Fatalf("Failed to get manifest %s: %v", dgst, err)
+	}
+	return manifest
+}
+
+func TestOnlineGCKeepsRecentContent(t *testing.T) {
+	ctx := dcontext.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "foo/online")
+	manifestService := makeManifestService(t, repo)
+
+	orphans, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatalf("Failed to create random digest: %v", err)
+	}
+	if err = testutil.UploadBlobs(repo, orphans); err != nil {
+		t.Fatalf("Failed to upload blob: %v", err)
+	}
+
+	// an untagged manifest, as pushed just before being tagged
+	image1 := uploadRandomOCIImage(t, repo)
+	err = repo.Tags(ctx).Tag(ctx, "test", distribution.Descriptor{Digest: image1.manifestDigest})
+	if err != nil {
+		t.Fatalf("Failed to tag manifest: %v", err)
+	}
+	err = repo.Tags(ctx).Untag(ctx, "test")
+	if err != nil {
+		t.Fatalf("Failed to delete tag: %v", err)
+	}
+
+	before := allBlobs(t, registry)
+
+	// Run GC
+	err = MarkAndSweep(dcontext.Background(), inmemoryDriver, registry, GCOpts{
+		DryRun:         false,
+		RemoveUntagged: true,
+		GracePeriod:    time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	after := allBlobs(t, registry)
+	if len(before) != len(after) {
+		t.Fatalf("Garbage collection affected blobs within the grace period: %d != %d", len(before), len(after))
+	}
+	if _, ok := allManifests(t, manifestService)[image1.manifestDigest]; !ok {
+		t.Fatalf("Manifest within the grace period was deleted")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	// Run GC with all content outside of the grace period
+	err = MarkAndSweep(dcontext.Background(), inmemoryDriver, registry, GCOpts{
+		DryRun:         false,
+		RemoveUntagged: true,
+		GracePeriod:    time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	after = allBlobs(t, registry)
+	if len(after) != 0 {
+		t.Fatalf("Garbage collection did not delete content outside of the grace period: %d blobs left", len(after))
+	}
+}
+
+func TestOnlineGCKeepsRecentlyLinkedBlob(t *testing.T) {
+	ctx := dcontext.Background()
+	inmemoryDriver := inmemory.New()
+
+	cacheProvider := memory.NewInMemoryBlobDescriptorCacheProvider(memory.UnlimitedSize)
+	registry := createRegistry(t, inmemoryDriver, BlobDescriptorCacheProvider(cacheProvider))
+	repo1 := makeRepository(t, registry, "foo/online/first")
+	repo2 := makeRepository(t, registry, "foo/online/second")
+
+	orphans, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatalf("Failed to create random digest: %v", err)
+	}
+	if err = testutil.UploadBlobs(repo1, orphans); err != nil {
+		t.Fatalf("Failed to upload blob: %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	// linking the blob into another repository keeps it, even though its
+	// data is older than the grace period
+	for _, rs := range orphans {
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = testutil.UploadBlobs(repo2, orphans); err != nil {
+		t.Fatalf("Failed to upload blob: %v", err)
+	}
+
+	err = MarkAndSweep(dcontext.Background(), inmemoryDriver, registry, GCOpts{
+		DryRun:      false,
+		GracePeriod: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	blobs := allBlobs(t, registry)
+	for dgst := range orphans {
+		if _, ok := blobs[dgst]; !ok {
+			t.Fatalf("Recently linked blob was deleted: %v", dgst)
+		}
+		// populate the cache
+		if _, err := repo1.Blobs(ctx).Stat(ctx, dgst); err != nil {
+			t.Fatalf("Failed to stat blob: %v", err)
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	err = MarkAndSweep(dcontext.Background(), inmemoryDriver, registry, GCOpts{
+		DryRun:      false,
+		GracePeriod: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	blobs = allBlobs(t, registry)
+	for dgst := range orphans {
+		if _, ok := blobs[dgst]; ok {
+			t.Fatalf("Orphan layer is present: %v", dgst)
+		}
+		if _, err := repo1.Blobs(ctx).Stat(ctx, dgst); err != distribution.ErrBlobUnknown {
+			t.Fatalf("Expected swept blob to be cleared from the cache, got %v", err)
+		}
+	}
+}
+
+func TestConcurrentMarkAndSweep(t *testing.T) {
+	ctx := dcontext.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+
+	var kept []image
+	var orphans []digest.Digest
+	for i := 0; i < 8; i++ {
+		repo := makeRepository(t, registry, fmt.Sprintf("concurrent/repo%d", i))
+
+		image := uploadRandomOCIImage(t, repo)
+		err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: image.manifestDigest})
+		if err != nil {
+			t.Fatalf("Failed to tag manifest: %v", err)
+		}
+		kept = append(kept, image)
+
+		layers, err := testutil.CreateRandomLayers(1)
+		if err != nil {
+			t.Fatalf("Failed to create random digest: %v", err)
+		}
+		if err = testutil.UploadBlobs(repo, layers); err != nil {
+			t.Fatalf("Failed to upload blob: %v", err)
+		}
+		for dgst := range layers {
+			orphans = append(orphans, dgst)
+		}
+	}
+
+	err := MarkAndSweep(dcontext.Background(), inmemoryDriver, registry, GCOpts{
+		DryRun:           false,
+		RemoveUntagged:   true,
+		Concurrency:      4,
+		ProgressInterval: 2,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	blobs := allBlobs(t, registry)
+	for _, image := range kept {
+		if _, ok := blobs[image.manifestDigest]; !ok {
+			t.Fatalf("Tagged manifest is missing: %v", image.manifestDigest)
+		}
+		for dgst := range image.layers {
+			if _, ok := blobs[dgst]; !ok {
+				t.Fatalf("Referenced layer is missing: %v", dgst)
+			}
+		}
+	}
+	for _, dgst := range orphans {
+		if _, ok := blobs[dgst]; ok {
+			t.Fatalf("Orphan layer is present: %v", dgst)
+		}
+	}
+}
+
+// interruptedNamespace fails to construct the named repository, interrupting
+// a garbage collection.
+type interruptedNamespace struct {
+	distribution.Namespace
+	interrupt string
+}
+
+func (n interruptedNamespace) Enumerate(ctx context.Context, ingester func(string) error) error {
+	return n.Namespace.(distribution.RepositoryEnumerator).Enumerate(ctx, ingester)
+}
+
+func (n interruptedNamespace) Repository(ctx context.Context, name reference.Named) (distribution.Repository, error) {
+	if name.Name() == n.interrupt {
+		return nil, errors.New("interrupted")
+	}
+	return n.Namespace.Repository(ctx, name)
+}
+
+func TestMarkAndSweepResumesFromCheckpoint(t *testing.T) {
+	ctx := dcontext.Background()
+	inmemoryDriver := inmemory.New()
+	checkpoint := filepath.Join(t.TempDir(), "gc.checkpoint")
+
+	registry := createRegistry(t, inmemoryDriver)
+
+	var kept []image
+	for i := 0; i < 3; i++ {
+		repo := makeRepository(t, registry, fmt.Sprintf("resume/repo%d", i))
+
+		image := uploadRandomOCIImage(t, repo)
+		err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: image.manifestDigest})
+		if err != nil {
+			t.Fatalf("Failed to tag manifest: %v", err)
+		}
+		kept = append(kept, image)
+	}
+
+	orphan := makeRepository(t, registry, "resume/repo0")
+	orphans, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatalf("Failed to create random digest: %v", err)
+	}
+	if err = testutil.UploadBlobs(orphan, orphans); err != nil {
+		t.Fatalf("Failed to upload blob: %v", err)
+	}
+
+	opts := GCOpts{
+		DryRun:           false,
+		ProgressInterval: 1,
+		Checkpoint:       checkpoint,
+	}
+
+	err = MarkAndSweep(ctx, inmemoryDriver, interruptedNamespace{Namespace: registry, interrupt: "resume/repo2"}, opts)
+	if err == nil {
+		t.Fatalf("Expected interrupted mark and sweep to fail")
+	}
+
+	p, err := os.ReadFile(checkpoint)
+	if err != nil {
+		t.Fatalf("Failed to read checkpoint: %v", err)
+	}
+	var saved gcCheckpoint
+	if err := json.Unmarshal(p, &saved); err != nil {
+		t.Fatalf("Failed to parse checkpoint: %v", err)
+	}
+	if len(saved.Repositories) != 2 || saved.Complete {
+		t.Fatalf("Unexpected checkpoint: %d repositories, complete %v", len(saved.Repositories), saved.Complete)
+	}
+
+	// manifests of the repositories marked before the interruption are no
+	// longer reachable, which would have them swept without the checkpoint
+	err = MarkAndSweep(ctx, inmemoryDriver, interruptedNamespace{Namespace: registry, interrupt: "resume/repo0"}, opts)
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	blobs := allBlobs(t, registry)
+	for _, image := range kept {
+		if _, ok := blobs[image.manifestDigest]; !ok {
+			t.Fatalf("Tagged manifest is missing: %v", image.manifestDigest)
+		}
+	}
+	for dgst := range orphans {
+		if _, ok := blobs[dgst]; ok {
+			t.Fatalf("Orphan layer is present: %v", dgst)
+		}
+	}
+
+	if _, err := os.Stat(checkpoint); !os.IsNotExist(err) {
+		t.Fatalf("Expected checkpoint to be removed, got %v", err)
+	}
+}
+
+func TestOnlineGCResumeKeepsContentPushedSinceInterruption(t *testing.T) {
+	ctx := dcontext.Background()
+	inmemoryDriver := inmemory.New()
+	checkpoint := filepath.Join(t.TempDir(), "gc.checkpoint")
+	gracePeriod := 100 * time.Millisecond
+
+	registry := createRegistry(t, inmemoryDriver)
+	for i := 0; i < 2; i++ {
+		repo := makeRepository(t, registry, fmt.Sprintf("resume/repo%d", i))
+		image := uploadRandomOCIImage(t, repo)
+		err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: image.manifestDigest})
+		if err != nil {
+			t.Fatalf("Failed to tag manifest: %v", err)
+		}
+	}
+
+	opts := GCOpts{
+		GracePeriod:      gracePeriod,
+		ProgressInterval: 1,
+		Checkpoint:       checkpoint,
+		Output:           io.Discard,
+	}
+
+	err := MarkAndSweep(ctx, inmemoryDriver, interruptedNamespace{Namespace: registry, interrupt: "resume/repo1"}, opts)
+	if err == nil {
+		t.Fatalf("Expected interrupted mark and sweep to fail")
+	}
+
+	// content pushed to a repository marked before the interruption
+	repo := makeRepository(t, registry, "resume/repo0")
+	pushed := uploadRandomOCIImage(t, repo)
+	err = repo.Tags(ctx).Tag(ctx, "pushed", distribution.Descriptor{Digest: pushed.manifestDigest})
+	if err != nil {
+		t.Fatalf("Failed to tag manifest: %v", err)
+	}
+
+	// the content is older than a grace period when resuming
+	time.Sleep(2 * gracePeriod)
+
+	err = MarkAndSweep(ctx, inmemoryDriver, registry, opts)
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	blobs := allBlobs(t, registry)
+	if _, ok := blobs[pushed.manifestDigest]; !ok {
+		t.Fatalf("Manifest pushed since the interruption was swept: %v", pushed.manifestDigest)
+	}
+	for dgst := range pushed.layers {
+		if _, ok := blobs[dgst]; !ok {
+			t.Fatalf("Layer pushed since the interruption was swept: %v", dgst)
+		}
+	}
+}
+
+func TestCheckpointLeavesOutRepositoriesBeingMarked(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "gc.checkpoint")
+
+	state := newMarkState()
+	state.mark("marked", "sha256:marked")
+	state.repositoryMarked("marked", []ManifestDel{{Name: "marked", Digest: "sha256:untagged"}}, nil)
+	state.mark("marking", "sha256:marking")
+
+	if err := saveCheckpoint(checkpoint, GCOpts{}, state); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := os.ReadFile(checkpoint)
+	if err != nil {
+		t.Fatalf("Failed to read checkpoint: %v", err)
+	}
+	var saved gcCheckpoint
+	if err := json.Unmarshal(p, &saved); err != nil {
+		t.Fatalf("Failed to parse checkpoint: %v", err)
+	}
+	if len(saved.Repositories) != 1 || saved.Repositories[0] != "marked" {
+		t.Fatalf("Unexpected repositories in checkpoint: %v", saved.Repositories)
+	}
+	if len(saved.Marked) != 1 || saved.Marked[0] != "sha256:marked" {
+		t.Fatalf("Unexpected marked digests in checkpoint: %v", saved.Marked)
+	}
+	if len(saved.Manifests) != 1 || !saved.Started.Equal(state.started) {
+		t.Fatalf("Unexpected checkpoint: %+v", saved)
+	}
+}
+
+func TestMarkAndSweepCheckpointOptionsMismatch(t *testing.T) {
+	inmemoryDriver := inmemory.New()
+	checkpoint := filepath.Join(t.TempDir(), "gc.checkpoint")
+
+	registry := createRegistry(t, inmemoryDriver)
+	uploadRandomOCIImage(t, makeRepository(t, registry, "resume/mismatch"))
+
+	err := os.WriteFile(checkpoint, []byte(`{"removeUntagged":true}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = MarkAndSweep(dcontext.Background(), inmemoryDriver, registry, GCOpts{Checkpoint: checkpoint})
+	if err == nil {
+		t.Fatalf("Expected mark and sweep with mismatching checkpoint to fail")
+	}
+}
+
+func TestGCPlan(t *testing.T) {
+	ctx := dcontext.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "plan/repo")
+
+	kept := uploadRandomOCIImage(t, repo)
+	err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: kept.manifestDigest})
+	if err != nil {
+		t.Fatalf("Failed to tag manifest: %v", err)
+	}
+
+	untagged := uploadRandomOCIImage(t, repo)
+	err = repo.Tags(ctx).Tag(ctx, "old", distribution.Descriptor{Digest: untagged.manifestDigest})
+	if err != nil {
+		t.Fatalf("Failed to tag manifest: %v", err)
+	}
+	// the index of the moved tag still references the untagged manifest
+	err = repo.Tags(ctx).Tag(ctx, "old", distribution.Descriptor{Digest: kept.manifestDigest})
+	if err != nil {
+		t.Fatalf("Failed to tag manifest: %v", err)
+	}
+
+	before := allBlobs(t, registry)
+
+	plan, err := PlanGarbageCollection(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveUntagged: true,
+		Output:         io.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Failed to plan garbage collection: %v", err)
+	}
+
+	if len(plan.Repositories) != 1 || plan.Repositories[0] != "plan/repo" {
+		t.Fatalf("Unexpected repositories in plan: %v", plan.Repositories)
+	}
+	if len(plan.Manifests) != 1 || plan.Manifests[0].Digest != untagged.manifestDigest {
+		t.Fatalf("Unexpected manifests in plan: %v", plan.Manifests)
+	}
+	if tags := plan.Manifests[0].Tags; len(tags) != 1 || tags[0] != "old" {
+		t.Fatalf("Unexpected tags of planned manifest: %v", tags)
+	}
+	if len(allBlobs(t, registry)) != len(before) {
+		t.Fatalf("Planning deleted blobs")
+	}
+
+	planned := make(map[digest.Digest]struct{})
+	var total int64
+	for _, blob := range plan.Blobs {
+		desc, err := registry.BlobStatter().Stat(ctx, blob.Digest)
+		if err != nil {
+			t.Fatalf("Failed to stat planned blob %s: %v", blob.Digest, err)
+		}
+		if blob.Size != desc.Size {
+			t.Fatalf("Unexpected size of planned blob %s: %d != %d", blob.Digest, blob.Size, desc.Size)
+		}
+		planned[blob.Digest] = struct{}{}
+		total += blob.Size
+	}
+	if plan.ReclaimedBytes != total {
+		t.Fatalf("Unexpected reclaimed bytes: %d != %d", plan.ReclaimedBytes, total)
+	}
+	if _, ok := planned[untagged.manifestDigest]; !ok {
+		t.Fatalf("Untagged manifest %s is not planned for deletion", untagged.manifestDigest)
+	}
+	for dgst := range untagged.layers {
+		if _, ok := planned[dgst]; !ok {
+			t.Fatalf("Layer %s of untagged manifest is not planned for deletion", dgst)
+		}
+	}
+	if _, ok := planned[kept.manifestDigest]; ok {
+		t.Fatalf("Tagged manifest %s is planned for deletion", kept.manifestDigest)
+	}
+
+	// the plan survives a round trip through its JSON form
+	p, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded GCPlan
+	if err := json.Unmarshal(p, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	// content which became unreferenced after planning is not deleted
+	orphans, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatalf("Failed to create random digest: %v", err)
+	}
+	if err = testutil.UploadBlobs(repo, orphans); err != nil {
+		t.Fatalf("Failed to upload blob: %v", err)
+	}
+
+	err = ApplyGCPlan(ctx, inmemoryDriver, registry, &decoded, GCOpts{})
+	if err != nil {
+		t.Fatalf("Failed to apply plan: %v", err)
+	}
+
+	after := allBlobs(t, registry)
+	for dgst := range before {
+		_, ok := after[dgst]
+		if _, deleted := planned[dgst]; deleted == ok {
+			t.Fatalf("Unexpected state of blob %s after applying plan: present %t, planned %t", dgst, ok, deleted)
+		}
+	}
+	for dgst := range orphans {
+		if _, ok := after[dgst]; !ok {
+			t.Fatalf("Blob %s not listed in the plan was deleted", dgst)
+		}
+	}
+	if _, ok := allManifests(t, makeManifestService(t, repo))[untagged.manifestDigest]; ok {
+		t.Fatalf("Untagged manifest %s was not deleted", untagged.manifestDigest)
+	}
+}
+
+type gcListener struct {
+	mu        sync.Mutex
+	manifests map[string]digest.Digest
+	blobs     map[digest.Digest]struct{}
+}
+
+func (l *gcListener) ManifestDeleted(repo reference.Named, dgst digest.Digest) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.manifests[repo.Name()] = dgst
+	return nil
+}
+
+func (l *gcListener) BlobSwept(dgst digest.Digest) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.blobs[dgst] = struct{}{}
+	return nil
+}
+
+func TestGCPlanClearsCachedDescriptors(t *testing.T) {
+	ctx := dcontext.Background()
+	inmemoryDriver := inmemory.New()
+
+	cacheProvider := memory.NewInMemoryBlobDescriptorCacheProvider(memory.UnlimitedSize)
+	registry := createRegistry(t, inmemoryDriver, BlobDescriptorCacheProvider(cacheProvider))
+	repo := makeRepository(t, registry, "plan/cached")
+
+	orphans, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatalf("Failed to create random digest: %v", err)
+	}
+	if err = testutil.UploadBlobs(repo, orphans); err != nil {
+		t.Fatalf("Failed to upload blob: %v", err)
+	}
+	for dgst := range orphans {
+		// populate the cache
+		if _, err := repo.Blobs(ctx).Stat(ctx, dgst); err != nil {
+			t.Fatalf("Failed to stat blob: %v", err)
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	plan, err := PlanGarbageCollection(ctx, inmemoryDriver, registry, GCOpts{
+		GracePeriod: 10 * time.Millisecond,
+		Output:      io.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Failed to plan garbage collection: %v", err)
+	}
+
+	// the repositories of the swept blobs are part of the plan file
+	p, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded GCPlan
+	if err := json.Unmarshal(p, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	for dgst := range orphans {
+		if repos := decoded.LinkedIn[dgst]; len(repos) != 1 || repos[0] != "plan/cached" {
+			t.Fatalf("Unexpected repositories of blob %s in plan: %v", dgst, repos)
+		}
+	}
+
+	err = ApplyGCPlan(ctx, inmemoryDriver, registry, &decoded, GCOpts{})
+	if err != nil {
+		t.Fatalf("Failed to apply plan: %v", err)
+	}
+	for dgst := range orphans {
+		if _, err := repo.Blobs(ctx).Stat(ctx, dgst); err != distribution.ErrBlobUnknown {
+			t.Fatalf("Expected swept blob to be cleared from the cache, got %v", err)
+		}
+	}
+}
+
+func TestGCPlanKeepsRetaggedManifests(t *testing.T) {
+	ctx := dcontext.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "plan/retagged")
+	stable := uploadRandomOCIImage(t, repo)
+	err := repo.Tags(ctx).Tag(ctx, "stable", distribution.Descriptor{Digest: stable.manifestDigest})
+	if err != nil {
+		t.Fatalf("Failed to tag manifest: %v", err)
+	}
+	image := uploadRandomOCIImage(t, repo)
+
+	plan, err := PlanGarbageCollection(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveUntagged: true,
+		Output:         io.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Failed to plan garbage collection: %v", err)
+	}
+	if len(plan.Manifests) != 1 || plan.Manifests[0].Digest != image.manifestDigest {
+		t.Fatalf("Unexpected manifests in plan: %v", plan.Manifests)
+	}
+
+	// the manifest is tagged after the plan was made
+	err = repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: image.manifestDigest})
+	if err != nil {
+		t.Fatalf("Failed to tag manifest: %v", err)
+	}
+
+	err = ApplyGCPlan(ctx, inmemoryDriver, registry, plan, GCOpts{})
+	if err != nil {
+		t.Fatalf("Failed to apply plan: %v", err)
+	}
+
+	if _, ok := allManifests(t, makeManifestService(t, repo))[image.manifestDigest]; !ok {
+		t.Fatalf("Tagged manifest %s was deleted", image.manifestDigest)
+	}
+	blobs := allBlobs(t, registry)
+	for dgst := range image.layers {
+		if _, ok := blobs[dgst]; !ok {
+			t.Fatalf("Layer %s of tagged manifest was deleted", dgst)
+		}
+	}
+	if _, ok := blobs[image.manifestDigest]; !ok {
+		t.Fatalf("Blob of tagged manifest %s was deleted", image.manifestDigest)
+	}
+}
+
+func TestGCPlanKeepsBlobsLinkedSincePlanning(t *testing.T) {
+	ctx := dcontext.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "plan/linked/first")
+
+	orphans, err := testutil.CreateRandomLayers(2)
+	if err != nil {
+		t.Fatalf("Failed to create random digest: %v", err)
+	}
+	if err = testutil.UploadBlobs(repo, orphans); err != nil {
+		t.Fatalf("Failed to upload blob: %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	plan, err := PlanGarbageCollection(ctx, inmemoryDriver, registry, GCOpts{
+		GracePeriod: 10 * time.Millisecond,
+		Output:      io.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Failed to plan garbage collection: %v", err)
+	}
+	if len(plan.Blobs) != 2 || plan.Cutoff == nil {
+		t.Fatalf("Unexpected plan: %+v", plan)
+	}
+
+	// the plan is applied from its serialized form, as by the command
+	p, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan = &GCPlan{}
+	if err := json.Unmarshal(p, plan); err != nil {
+		t.Fatal(err)
+	}
+
+	// one of the blobs is linked into a new repository once the plan is made
+	linked := getAnyKey(orphans)
+	rs := orphans[linked]
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	second := makeRepository(t, registry, "plan/linked/second")
+	if err = testutil.UploadBlobs(second, map[digest.Digest]io.ReadSeeker{linked: rs}); err != nil {
+		t.Fatalf("Failed to upload blob: %v", err)
+	}
+
+	err = ApplyGCPlan(ctx, inmemoryDriver, registry, plan, GCOpts{})
+	if err != nil {
+		t.Fatalf("Failed to apply plan: %v", err)
+	}
+
+	blobs := allBlobs(t, registry)
+	for dgst := range orphans {
+		if _, ok := blobs[dgst]; ok != (dgst == linked) {
+			t.Fatalf("Unexpected presence of blob %s: %v", dgst, ok)
+		}
+	}
+}
+
+func TestGCListener(t *testing.T) {
+	ctx := dcontext.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "listener/repo")
+
+	kept := uploadRandomOCIImage(t, repo)
+	err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: kept.manifestDigest})
+	if err != nil {
+		t.Fatalf("Failed to tag manifest: %v", err)
+	}
+	untagged := uploadRandomOCIImage(t, repo)
+
+	listener := &gcListener{
+		manifests: make(map[string]digest.Digest),
+		blobs:     make(map[digest.Digest]struct{}),
+	}
+	err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveUntagged: true,
+		Concurrency:    4,
+		Output:         io.Discard,
+		Listener:       listener,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	if len(listener.manifests) != 1 || listener.manifests["listener/repo"] != untagged.manifestDigest {
+		t.Fatalf("Unexpected deleted manifests: %v", listener.manifests)
+	}
+	if _, ok := listener.blobs[untagged.manifestDigest]; !ok {
+		t.Fatalf("Deletion of manifest blob %s not notified", untagged.manifestDigest)
+	}
+	for dgst := range untagged.layers {
+		if _, ok := listener.blobs[dgst]; !ok {
+			t.Fatalf("Deletion of layer %s not notified", dgst)
+		}
+	}
+	for dgst := range kept.layers {
+		if _, ok := listener.blobs[dgst]; ok {
+			t.Fatalf("Unexpected deletion of kept layer %s", dgst)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// gcCheckpoint is the progress of the mark phase of a garbage collection, as
+// saved to a checkpoint file.
+type gcCheckpoint struct {
+	// RemoveUntagged and RemoveReferrers are the options the mark phase
+	// depends on, which must match when resuming.
+	RemoveUntagged  bool `json:"removeUntagged"`
+	RemoveReferrers bool `json:"removeReferrers"`
+
+	// Started is the time the collection started, from which the grace
+	// period of a resumed collection is counted.
+	Started time.Time `json:"started"`
+
+	Repositories []string        `json:"repositories"`
+	Marked       []digest.Digest `json:"marked"`
+	Manifests    []ManifestDel   `json:"manifests"`
+	Referrers    []referrerDel   `json:"referrers"`
+	Complete     bool            `json:"complete"`
+}
+
+// loadCheckpoint restores the mark state from the checkpoint file of the
+// collection. A missing file yields an empty state.
+func (gc *garbageCollector) loadCheckpoint() (*markState, error) {
+	path, opts := gc.opts.Checkpoint, gc.opts
+	state := newMarkState()
+
+	p, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+
+	var checkpoint gcCheckpoint
+	if err := json.Unmarshal(p, &checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %v", path, err)
+	}
+
+	if checkpoint.RemoveUntagged != opts.RemoveUntagged || checkpoint.RemoveReferrers != opts.RemoveReferrers {
+		return nil, fmt.Errorf("checkpoint %s was saved with different options", path)
+	}
+
+	for _, repoName := range checkpoint.Repositories {
+		state.repositories[repoName] = struct{}{}
+	}
+	for _, dgst := range checkpoint.Marked {
+		state.markSet[dgst] = struct{}{}
+	}
+	state.manifestArr = append(state.manifestArr, checkpoint.Manifests...)
+	state.referrerArr = append(state.referrerArr, checkpoint.Referrers...)
+	state.complete = checkpoint.Complete
+	if !checkpoint.Started.IsZero() {
+		state.started = checkpoint.Started
+	}
+
+	gc.emit("resuming from checkpoint %s, %d repositories marked", path, len(state.repositories))
+	return state, nil
+}
+
+// saveCheckpoint atomically replaces the checkpoint file at path with the
+// mark state of the repositories which have been marked, leaving out those
+// being marked, which are marked again on resume. The caller must hold the
+// lock of the state.
+func saveCheckpoint(path string, opts GCOpts, state *markState) error {
+	pending := make(map[digest.Digest]struct{})
+	for _, digests := range state.pending {
+		for _, dgst := range digests {
+			pending[dgst] = struct{}{}
+		}
+	}
+
+	checkpoint := gcCheckpoint{
+		RemoveUntagged:  opts.RemoveUntagged,
+		RemoveReferrers: opts.RemoveReferrers,
+		Started:         state.started,
+		Repositories:    make([]string, 0, len(state.repositories)),
+		Marked:          make([]digest.Digest, 0, len(state.markSet)),
+		Manifests:       state.manifestArr,
+		Referrers:       state.referrerArr,
+		Complete:        state.complete,
+	}
+	for repoName := range state.repositories {
+		checkpoint.Repositories = append(checkpoint.Repositories, repoName)
+	}
+	for dgst := range state.markSet {
+		if _, ok := pending[dgst]; ok {
+			continue
+		}
+		checkpoint.Marked = append(checkpoint.Marked, dgst)
+	}
+
+	p, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(p); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// removeCheckpoint removes the checkpoint file at path, if any.
+func removeCheckpoint(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
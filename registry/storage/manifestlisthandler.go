@@ -74,6 +74,12 @@ func (ms *manifestListHandler) Put(ctx context.Context, manifestList distributio
 func (ms *manifestListHandler) verifyManifest(ctx context.Context, mnfst distribution.Manifest, skipDependencyVerification bool) error {
 	var errs distribution.ErrManifestVerification
 
+	if index, ok := mnfst.(*ocischema.DeserializedImageIndex); ok {
+		if err := verifySubject(index.Subject); err != nil {
+			return distribution.ErrManifestVerification{err}
+		}
+	}
+
 	if !skipDependencyVerification {
 		// This manifest service is different from the blob service
 		// returned by Blob. It uses a linked blob store to ensure that
@@ -128,15 +128,23 @@ func (ms *manifestStore) Get(ctx context.Context, dgst digest.Digest, options ..
 func (ms *manifestStore) Put(ctx context.Context, manifest distribution.Manifest, options ...distribution.ManifestServiceOption) (digest.Digest, error) {
 	dcontext.GetLogger(ms.ctx).Debug("(*manifestStore).Put")
 
-	switch manifest.(type) {
+	switch m := manifest.(type) {
 	case *schema2.DeserializedManifest:
 		return ms.schema2Handler.Put(ctx, manifest, ms.skipDependencyVerification)
 	case *ocischema.DeserializedManifest:
-		return ms.ocischemaHandler.Put(ctx, manifest, ms.skipDependencyVerification)
+		revision, err := ms.ocischemaHandler.Put(ctx, manifest, ms.skipDependencyVerification)
+		if err != nil {
+			return "", err
+		}
+		return revision, ms.linkReferrer(ctx, m.Subject, revision)
 	case *manifestlist.DeserializedManifestList:
 		return ms.manifestListHandler.Put(ctx, manifest, ms.skipDependencyVerification)
 	case *ocischema.DeserializedImageIndex:
-		return ms.ocischemaIndexHandler.Put(ctx, manifest, ms.skipDependencyVerification)
+		revision, err := ms.ocischemaIndexHandler.Put(ctx, manifest, ms.skipDependencyVerification)
+		if err != nil {
+			return "", err
+		}
+		return revision, ms.linkReferrer(ctx, m.Subject, revision)
 	}
 
 	return "", fmt.Errorf("unrecognized manifest type %T", manifest)
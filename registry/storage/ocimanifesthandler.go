@@ -69,6 +69,10 @@ func (ms *ocischemaManifestHandler) verifyManifest(ctx context.Context, mnfst oc
 		return fmt.Errorf("unrecognized manifest schema version %d", mnfst.Manifest.SchemaVersion)
 	}
 
+	if err := verifySubject(mnfst.Subject); err != nil {
+		return distribution.ErrManifestVerification{err}
+	}
+
 	if skipDependencyVerification {
 		return nil
 	}
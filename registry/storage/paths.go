@@ -35,6 +35,10 @@ const (
 //	        │   ├── revisions
 //	        │   │   └── <manifest digest path>
 //	        │   │       └── link
+//	        │   ├── referrers
+//	        │   │   └── <subject digest path>
+//	        │   │       └── <referrer digest path>
+//	        │   │           └── link
 //	        │   └── tags
 //	        │       └── <tag>
 //	        │           ├── current
@@ -73,7 +77,9 @@ const (
 // implied as to the ordering of changes to a manifest. The tag store provides
 // support for name, tag lookups of manifests, using "current/link" under a
 // named tag directory. An index is maintained to support deletions of all
-// revisions of a given manifest tag.
+// revisions of a given manifest tag. Manifests carrying a subject are
+// additionally linked under the referrers directory of their subject, so
+// that they can be found from the manifest they describe.
 //
 // We cover the path formats implemented by this path mapper below.
 //
@@ -88,6 +94,11 @@ const (
 //	manifestRevisionPathSpec:      <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/
 //	manifestRevisionLinkPathSpec:  <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/link
 //
+//	Referrers:
+//
+//	manifestReferrersPathSpec:     <root>/v2/repositories/<name>/_manifests/referrers/<algorithm>/<hex digest>/
+//	manifestReferrerLinkPathSpec:  <root>/v2/repositories/<name>/_manifests/referrers/<algorithm>/<hex digest>/<algorithm>/<hex digest>/link
+//
 //	Tags:
 //
 //	manifestTagsPathSpec:                  <root>/v2/repositories/<name>/_manifests/tags/
@@ -114,6 +125,10 @@ const (
 //	blobPathSpec:                   <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>
 //	blobDataPathSpec:               <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/data
 //
+//	Quotas:
+//
+//	quotaUsagePathSpec:             <root>/v2/quotas/<algorithm>/<hex digest of namespace>/usage
+//
 // For more information on the semantic meaning of each path and their
 // contents, please see the path spec documentation.
 func pathFor(spec pathSpec) (string, error) {
@@ -154,6 +169,28 @@ func pathFor(spec pathSpec) (string, error) {
 		}
 
 		return path.Join(root, "link"), nil
+	case manifestReferrersPathSpec:
+		components, err := digestPathComponents(v.subject, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(append(append(repoPrefix, v.name, "_manifests", "referrers"), components...)...), nil
+	case manifestReferrerLinkPathSpec:
+		root, err := pathFor(manifestReferrersPathSpec{
+			name:    v.name,
+			subject: v.subject,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		components, err := digestPathComponents(v.revision, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, path.Join(components...), "link"), nil
 	case manifestTagsPathSpec:
 		return path.Join(append(repoPrefix, v.name, "_manifests", "tags")...), nil
 	case manifestTagPathSpec:
@@ -250,6 +287,9 @@ func pathFor(spec pathSpec) (string, error) {
 		return path.Join(append(repoPrefix, v.name, "_uploads", v.id, "hashstates", string(v.alg), offset)...), nil
 	case repositoriesRootPathSpec:
 		return path.Join(repoPrefix...), nil
+	case quotaUsagePathSpec:
+		dgst := digest.FromString(v.namespace)
+		return path.Join(append(rootPrefix, "quotas", dgst.Algorithm().String(), dgst.Encoded(), "usage")...), nil
 	default:
 		// TODO(sday): This is an internal error. Ensure it doesn't escape (panic?).
 		return "", fmt.Errorf("unknown path spec: %#v", v)
@@ -298,6 +338,26 @@ type manifestRevisionLinkPathSpec struct {
 
 func (manifestRevisionLinkPathSpec) pathSpec() {}
 
+// manifestReferrersPathSpec describes the directory path holding the links
+// to all manifests which declare the given manifest as their subject.
+type manifestReferrersPathSpec struct {
+	name    string
+	subject digest.Digest
+}
+
+func (manifestReferrersPathSpec) pathSpec() {}
+
+// manifestReferrerLinkPathSpec describes the link recording that the manifest
+// revision refers to the subject. The contents of this file should just be
+// the digest of the referrer.
+type manifestReferrerLinkPathSpec struct {
+	name     string
+	subject  digest.Digest
+	revision digest.Digest
+}
+
+func (manifestReferrerLinkPathSpec) pathSpec() {}
+
 // manifestTagsPathSpec describes the path elements required to point to the
 // manifest tags directory.
 type manifestTagsPathSpec struct {
@@ -450,6 +510,15 @@ type repositoriesRootPathSpec struct{}
 
 func (repositoriesRootPathSpec) pathSpec() {}
 
+// quotaUsagePathSpec describes the path of the usage of the quota of a
+// namespace. As namespaces are repository name prefixes, which may end with a
+// slash, the path is keyed by the digest of the namespace.
+type quotaUsagePathSpec struct {
+	namespace string
+}
+
+func (quotaUsagePathSpec) pathSpec() {}
+
 // digestPathComponents provides a consistent path breakdown for a given
 // digest. For a generic digest, it will be as follows:
 //
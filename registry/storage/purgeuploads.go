@@ -7,6 +7,7 @@ import (
 	"time"
 
 	storageDriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/reference"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
@@ -26,10 +27,16 @@ func newUploadData() uploadData {
 	}
 }
 
+// UploadPurgeListener is notified of the uploads deleted by PurgeUploads.
+type UploadPurgeListener interface {
+	UploadPurged(repo reference.Named, id string) error
+}
+
 // PurgeUploads deletes files from the upload directory
 // created before olderThan.  The list of files deleted and errors
-// encountered are returned
-func PurgeUploads(ctx context.Context, driver storageDriver.StorageDriver, olderThan time.Time, actuallyDelete bool) ([]string, []error) {
+// encountered are returned. The listeners are notified of each
+// deleted upload.
+func PurgeUploads(ctx context.Context, driver storageDriver.StorageDriver, olderThan time.Time, actuallyDelete bool, listeners ...UploadPurgeListener) ([]string, []error) {
 	logrus.Infof("PurgeUploads starting: olderThan=%s, actuallyDelete=%t", olderThan, actuallyDelete)
 	uploadData, errors := getOutstandingUploads(ctx, driver)
 	var deleted []string
@@ -43,6 +50,9 @@ func PurgeUploads(ctx context.Context, driver storageDriver.StorageDriver, older
 			}
 			if err == nil {
 				deleted = append(deleted, uploadData.containingDir)
+				if actuallyDelete {
+					notifyUploadPurged(uploadData.containingDir, listeners)
+				}
 			} else {
 				errors = append(errors, err)
 			}
@@ -53,6 +63,34 @@ func PurgeUploads(ctx context.Context, driver storageDriver.StorageDriver, older
 	return deleted, errors
 }
 
+// notifyUploadPurged notifies the listeners of the deletion of the upload
+// directory dir.
+func notifyUploadPurged(dir string, listeners []UploadPurgeListener) {
+	if len(listeners) == 0 {
+		return
+	}
+
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return
+	}
+	repoName, id, ok := strings.Cut(strings.TrimPrefix(dir, root+"/"), "/_uploads/")
+	if !ok {
+		return
+	}
+	named, err := reference.WithName(repoName)
+	if err != nil {
+		logrus.Errorf("error dispatching purge of upload %s to listeners: %v", dir, err)
+		return
+	}
+
+	for _, listener := range listeners {
+		if err := listener.UploadPurged(named, id); err != nil {
+			logrus.Errorf("error dispatching purge of upload %s to listener: %v", dir, err)
+		}
+	}
+}
+
 // getOutstandingUploads walks the upload directory, collecting files
 // which could be eligible for deletion.  The only reliable way to
 // classify the age of a file is with the date stored in the startedAt
@@ -9,6 +9,7 @@ import (
 
 	"github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/distribution/reference"
 	"github.com/google/uuid"
 )
 
@@ -105,6 +106,35 @@ func TestPurgeSome(t *testing.T) {
 	}
 }
 
+type purgeListener []string
+
+func (l *purgeListener) UploadPurged(repo reference.Named, id string) error {
+	*l = append(*l, repo.Name()+" "+id)
+	return nil
+}
+
+func TestPurgeListener(t *testing.T) {
+	oneHourAgo := time.Now().Add(-1 * time.Hour)
+	fs, ctx := testUploadFS(t, 0, "", oneHourAgo)
+	id := uuid.NewString()
+	addUploads(ctx, t, fs, id, "library/test-repo", oneHourAgo)
+
+	var listener purgeListener
+	if _, errs := PurgeUploads(ctx, fs, time.Now(), false, &listener); len(errs) != 0 {
+		t.Fatal("Unexpected errors:", errs)
+	}
+	if len(listener) != 0 {
+		t.Fatalf("Unexpected notifications of a dry run: %v", listener)
+	}
+
+	if _, errs := PurgeUploads(ctx, fs, time.Now(), true, &listener); len(errs) != 0 {
+		t.Fatal("Unexpected errors:", errs)
+	}
+	if len(listener) != 1 || listener[0] != "library/test-repo "+id {
+		t.Fatalf("Unexpected notifications: %v", listener)
+	}
+}
+
 func TestPurgeOnlyUploads(t *testing.T) {
 	oldUploadCount := 5
 	oneHourAgo := time.Now().Add(-1 * time.Hour)
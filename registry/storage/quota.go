@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
+)
+
+// Quota limits the content stored in the repositories of a namespace.
+type Quota struct {
+	// Namespace is the path prefix of the names of the repositories the
+	// quota applies to, such as "team" for "team/app" and "team/tools/app".
+	// A repository is accounted to the quota with the longest matching
+	// namespace.
+	Namespace string
+
+	// MaxBytes is the maximum total size of the layers linked into the
+	// repositories. Zero means unlimited.
+	MaxBytes int64
+
+	// MaxManifests is the maximum number of manifests stored in the
+	// repositories. Zero means unlimited.
+	MaxManifests int64
+}
+
+// QuotaUsage is the content stored in the repositories of a namespace. A blob
+// linked into several repositories is accounted once for each of them.
+type QuotaUsage struct {
+	Bytes     int64 `json:"bytes"`
+	Manifests int64 `json:"manifests"`
+}
+
+// QuotaTracker accounts the usage of the quotas of namespaces, so that it can
+// be checked without walking the storage. The usage is stored in the storage
+// driver and updated incrementally as content is pushed and deleted through
+// the API. Content deleted by garbage collection is accounted by rebuilding
+// the usage once the sweep is done; retention only removes tags, which does
+// not change the usage until their manifests are collected. Updates are
+// serialized within a process only, so the usage may drift when several
+// registry instances share the storage, or when content is deleted by other
+// means. Rebuild recomputes it from the storage.
+type QuotaTracker struct {
+	driver driver.StorageDriver
+	quotas []Quota
+
+	mu sync.Mutex
+}
+
+// NewQuotaTracker returns a QuotaTracker accounting the usage of the quotas
+// in the storage driver.
+func NewQuotaTracker(storageDriver driver.StorageDriver, quotas []Quota) *QuotaTracker {
+	return &QuotaTracker{
+		driver: storageDriver,
+		quotas: quotas,
+	}
+}
+
+// quotaFor returns the quota of the named repository, or nil if the
+// repository has no quota.
+func quotaFor(quotas []Quota, repoName string) *Quota {
+	var found *Quota
+	for i, quota := range quotas {
+		namespace := strings.TrimSuffix(quota.Namespace, "/")
+		if repoName != namespace && !strings.HasPrefix(repoName, namespace+"/") {
+			continue
+		}
+		if found == nil || len(quota.Namespace) > len(found.Namespace) {
+			found = &quotas[i]
+		}
+	}
+	return found
+}
+
+// Reserve adds bytes and manifests to the usage of the quota of the named
+// repository, unless that would exceed the quota, in which case it returns
+// distribution.ErrQuotaExceeded.
+func (qt *QuotaTracker) Reserve(ctx context.Context, repoName string, bytes, manifests int64) error {
+	return qt.update(ctx, repoName, bytes, manifests, true)
+}
+
+// Add adds bytes and manifests, which may be negative, to the usage of the
+// quota of the named repository, regardless of the quota.
+func (qt *QuotaTracker) Add(ctx context.Context, repoName string, bytes, manifests int64) error {
+	return qt.update(ctx, repoName, bytes, manifests, false)
+}
+
+// update is a read-modify-write of the usage stored in the storage driver,
+// which offers no compare-and-swap. It is best-effort: concurrent updates by
+// several registry instances may overwrite each other, losing increments or
+// letting a namespace exceed its quota, until the usage is rebuilt.
+func (qt *QuotaTracker) update(ctx context.Context, repoName string, bytes, manifests int64, check bool) error {
+	quota := quotaFor(qt.quotas, repoName)
+	if quota == nil || (bytes == 0 && manifests == 0) {
+		return nil
+	}
+
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+
+	usage, err := readQuotaUsage(ctx, qt.driver, quota.Namespace)
+	if err != nil {
+		return err
+	}
+
+	if check {
+		if quota.MaxBytes > 0 && bytes > 0 && usage.Bytes+bytes > quota.MaxBytes {
+			return distribution.ErrQuotaExceeded{
+				Namespace: quota.Namespace,
+				Reason:    fmt.Sprintf("%d bytes used, %d more requested, %d allowed", usage.Bytes, bytes, quota.MaxBytes),
+			}
+		}
+		if quota.MaxManifests > 0 && manifests > 0 && usage.Manifests+manifests > quota.MaxManifests {
+			return distribution.ErrQuotaExceeded{
+				Namespace: quota.Namespace,
+				Reason:    fmt.Sprintf("%d manifests stored, %d allowed", usage.Manifests, quota.MaxManifests),
+			}
+		}
+	}
+
+	usage.Bytes = max(usage.Bytes+bytes, 0)
+	usage.Manifests = max(usage.Manifests+manifests, 0)
+	return writeQuotaUsage(ctx, qt.driver, quota.Namespace, usage)
+}
+
+// Usage returns the usage of the quota of the namespace.
+func (qt *QuotaTracker) Usage(ctx context.Context, namespace string) (QuotaUsage, error) {
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+
+	return readQuotaUsage(ctx, qt.driver, namespace)
+}
+
+func readQuotaUsage(ctx context.Context, storageDriver driver.StorageDriver, namespace string) (QuotaUsage, error) {
+	var usage QuotaUsage
+
+	usagePath, err := pathFor(quotaUsagePathSpec{namespace: namespace})
+	if err != nil {
+		return usage, err
+	}
+
+	p, err := storageDriver.GetContent(ctx, usagePath)
+	if err != nil {
+		if isPathNotFound(err) {
+			return usage, nil
+		}
+		return usage, err
+	}
+
+	if err := json.Unmarshal(p, &usage); err != nil {
+		return usage, fmt.Errorf("invalid usage of the quota of namespace %q: %v", namespace, err)
+	}
+	return usage, nil
+}
+
+func writeQuotaUsage(ctx context.Context, storageDriver driver.StorageDriver, namespace string, usage QuotaUsage) error {
+	usagePath, err := pathFor(quotaUsagePathSpec{namespace: namespace})
+	if err != nil {
+		return err
+	}
+
+	p, err := json.Marshal(usage)
+	if err != nil {
+		return err
+	}
+	return storageDriver.PutContent(ctx, usagePath, p)
+}
+
+// RepositoryUsage returns the content stored in the named repository, as
+// accounted by quotas.
+func RepositoryUsage(ctx context.Context, registry distribution.Namespace, repoName string) (QuotaUsage, error) {
+	var usage QuotaUsage
+
+	named, err := reference.WithName(repoName)
+	if err != nil {
+		return usage, err
+	}
+	repository, err := registry.Repository(ctx, named)
+	if err != nil {
+		return usage, err
+	}
+
+	blobService := repository.Blobs(ctx)
+	blobEnumerator, ok := blobService.(distribution.BlobEnumerator)
+	if !ok {
+		return usage, fmt.Errorf("unable to convert BlobService into BlobEnumerator")
+	}
+	err = blobEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+		desc, err := blobService.Stat(ctx, dgst)
+		if err != nil {
+			if err == distribution.ErrBlobUnknown {
+				return nil
+			}
+			return err
+		}
+		usage.Bytes += desc.Size
+		return nil
+	})
+	if err != nil && !isPathNotFound(err) {
+		return usage, err
+	}
+
+	manifestService, err := repository.Manifests(ctx)
+	if err != nil {
+		return usage, err
+	}
+	manifestEnumerator, ok := manifestService.(distribution.ManifestEnumerator)
+	if !ok {
+		return usage, fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
+	}
+	err = manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+		usage.Manifests++
+		return nil
+	})
+	if err != nil && !isPathNotFound(err) {
+		return usage, err
+	}
+
+	return usage, nil
+}
+
+// Rebuild recomputes the usage of the quotas by walking the repositories of
+// the registry, and replaces the stored usage with it. Content pushed while
+// the repositories are walked may be missing from the rebuilt usage.
+func (qt *QuotaTracker) Rebuild(ctx context.Context, registry distribution.Namespace) (map[string]QuotaUsage, error) {
+	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+
+	usages := make(map[string]QuotaUsage, len(qt.quotas))
+	for _, quota := range qt.quotas {
+		usages[quota.Namespace] = QuotaUsage{}
+	}
+
+	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		quota := quotaFor(qt.quotas, repoName)
+		if quota == nil {
+			return nil
+		}
+
+		repoUsage, err := RepositoryUsage(ctx, registry, repoName)
+		if err != nil {
+			return fmt.Errorf("failed to compute usage of %s: %v", repoName, err)
+		}
+
+		usage := usages[quota.Namespace]
+		usage.Bytes += repoUsage.Bytes
+		usage.Manifests += repoUsage.Manifests
+		usages[quota.Namespace] = usage
+		return nil
+	})
+	if err != nil && !isPathNotFound(err) {
+		return nil, err
+	}
+
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+
+	for namespace, usage := range usages {
+		if err := writeQuotaUsage(ctx, qt.driver, namespace, usage); err != nil {
+			return nil, err
+		}
+	}
+	return usages, nil
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"io"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/internal/dcontext"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+)
+
+func TestQuotaFor(t *testing.T) {
+	quotas := []Quota{
+		{Namespace: "team"},
+		{Namespace: "team/ci/"},
+	}
+
+	for repoName, expected := range map[string]string{
+		"team":            "team",
+		"team/app":        "team",
+		"team/ci/app":     "team/ci/",
+		"team/cinema/app": "team",
+		"teams/app":       "",
+		"other/app":       "",
+	} {
+		quota := quotaFor(quotas, repoName)
+		switch {
+		case quota == nil && expected != "":
+			t.Errorf("expected %s to be accounted to %s, got no quota", repoName, expected)
+		case quota != nil && quota.Namespace != expected:
+			t.Errorf("expected %s to be accounted to %q, got %s", repoName, expected, quota.Namespace)
+		}
+	}
+}
+
+func TestQuotaTracker(t *testing.T) {
+	ctx := dcontext.Background()
+	tracker := NewQuotaTracker(inmemory.New(), []Quota{
+		{Namespace: "team", MaxBytes: 100, MaxManifests: 2},
+	})
+
+	if err := tracker.Reserve(ctx, "team/app", 60, 1); err != nil {
+		t.Fatalf("Failed to reserve quota: %v", err)
+	}
+	if err := tracker.Reserve(ctx, "team/other", 40, 1); err != nil {
+		t.Fatalf("Failed to reserve quota: %v", err)
+	}
+
+	err := tracker.Reserve(ctx, "team/app", 1, 0)
+	if _, ok := err.(distribution.ErrQuotaExceeded); !ok {
+		t.Fatalf("Expected byte quota to be exceeded, got %v", err)
+	}
+	err = tracker.Reserve(ctx, "team/app", 0, 1)
+	if _, ok := err.(distribution.ErrQuotaExceeded); !ok {
+		t.Fatalf("Expected manifest quota to be exceeded, got %v", err)
+	}
+
+	// repositories outside of any namespace are not limited
+	if err := tracker.Reserve(ctx, "other/app", 1000, 10); err != nil {
+		t.Fatalf("Failed to reserve quota: %v", err)
+	}
+
+	if err := tracker.Add(ctx, "team/app", -60, -1); err != nil {
+		t.Fatalf("Failed to release quota: %v", err)
+	}
+	if err := tracker.Reserve(ctx, "team/app", 50, 1); err != nil {
+		t.Fatalf("Failed to reserve released quota: %v", err)
+	}
+
+	usage, err := tracker.Usage(ctx, "team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage != (QuotaUsage{Bytes: 90, Manifests: 2}) {
+		t.Fatalf("Unexpected usage: %+v", usage)
+	}
+}
+
+func TestQuotaTrackerRebuild(t *testing.T) {
+	ctx := dcontext.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "team/app")
+	other := makeRepository(t, registry, "other/app")
+
+	image := uploadRandomOCIImage(t, repo)
+	uploadRandomOCIImage(t, other)
+
+	// the config and layers of the image are linked into the repository
+	var expected QuotaUsage
+	for _, desc := range image.manifest.References() {
+		desc, err := repo.Blobs(ctx).Stat(ctx, desc.Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected.Bytes += desc.Size
+	}
+	expected.Manifests = 1
+
+	quotas := []Quota{{Namespace: "team"}}
+	usages, err := NewQuotaTracker(inmemoryDriver, quotas).Rebuild(ctx, registry)
+	if err != nil {
+		t.Fatalf("Failed to rebuild quota usage: %v", err)
+	}
+	if len(usages) != 1 || usages["team"] != expected {
+		t.Fatalf("Expected usage %+v, got %+v", expected, usages)
+	}
+
+	usage, err := NewQuotaTracker(inmemoryDriver, quotas).Usage(ctx, "team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage != expected {
+		t.Fatalf("Expected stored usage %+v, got %+v", expected, usage)
+	}
+}
+
+func TestGarbageCollectionRebuildsQuotaUsage(t *testing.T) {
+	ctx := dcontext.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "team/app")
+	uploadRandomOCIImage(t, repo)
+
+	quotas := NewQuotaTracker(inmemoryDriver, []Quota{{Namespace: "team"}})
+	usages, err := quotas.Rebuild(ctx, registry)
+	if err != nil {
+		t.Fatalf("Failed to rebuild quota usage: %v", err)
+	}
+	if usages["team"].Manifests != 1 {
+		t.Fatalf("Unexpected usage: %+v", usages["team"])
+	}
+
+	// the untagged image is collected
+	err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveUntagged: true,
+		Output:         io.Discard,
+		Quotas:         quotas,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	usage, err := quotas.Usage(ctx, "team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage != (QuotaUsage{}) {
+		t.Fatalf("Expected no usage after garbage collection, got %+v", usage)
+	}
+}
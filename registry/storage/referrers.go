@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
+)
+
+var _ distribution.ReferrersEnumerator = &registry{}
+
+// EnumerateReferrers calls ingester with the descriptor of each manifest in
+// the named repository which declares subject as its subject. The subject
+// itself does not need to exist. Referrers whose revision has since been
+// deleted are skipped.
+func (reg *registry) EnumerateReferrers(ctx context.Context, name reference.Named, subject digest.Digest, ingester func(distribution.Descriptor) error) error {
+	rootPath, err := pathFor(manifestReferrersPathSpec{
+		name:    name.Name(),
+		subject: subject,
+	})
+	if err != nil {
+		return err
+	}
+
+	repo, err := reg.Repository(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	manifestService, err := repo.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = reg.blobStore.driver.Walk(ctx, rootPath, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() {
+			return nil
+		}
+
+		_, fileName := path.Split(fileInfo.Path())
+		if fileName != "link" {
+			return nil
+		}
+
+		revision, err := reg.blobStore.readlink(ctx, fileInfo.Path())
+		if err != nil {
+			return err
+		}
+
+		mnfst, err := manifestService.Get(ctx, revision)
+		if err != nil {
+			if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+				return nil
+			}
+			return err
+		}
+
+		desc, err := referrerDescriptor(revision, mnfst)
+		if err != nil {
+			return err
+		}
+
+		return ingester(desc)
+	})
+
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+
+	return err
+}
+
+// linkReferrer records in the referrers index of the repository that the
+// manifest revision refers to subject. It is a no-op if subject is nil.
+func (ms *manifestStore) linkReferrer(ctx context.Context, subject *distribution.Descriptor, revision digest.Digest) error {
+	if subject == nil {
+		return nil
+	}
+
+	referrerPath, err := pathFor(manifestReferrerLinkPathSpec{
+		name:     ms.repository.Named().Name(),
+		subject:  subject.Digest,
+		revision: revision,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ms.blobStore.link(ctx, referrerPath, revision)
+}
+
+// verifySubject ensures that the subject of a manifest, if any, is a valid
+// descriptor of a manifest. The subject itself is not required to exist in
+// the repository, as referrers may be pushed before the content they refer
+// to.
+func verifySubject(subject *distribution.Descriptor) error {
+	if subject == nil {
+		return nil
+	}
+
+	if err := subject.Digest.Validate(); err != nil {
+		return distribution.ErrManifestSubjectInvalid{Digest: subject.Digest, Reason: err}
+	}
+
+	if subject.Size <= 0 {
+		return distribution.ErrManifestSubjectInvalid{Digest: subject.Digest, Reason: fmt.Errorf("invalid size %d", subject.Size)}
+	}
+
+	for _, mediaType := range distribution.ManifestMediaTypes() {
+		if subject.MediaType == mediaType {
+			return nil
+		}
+	}
+
+	return distribution.ErrManifestSubjectInvalid{Digest: subject.Digest, Reason: fmt.Errorf("unsupported media type %q", subject.MediaType)}
+}
+
+// referrerDescriptor builds the descriptor of a referrer as returned by the
+// referrers API. For image manifests without an explicit artifact type, the
+// media type of the config is used instead, as required by the OCI
+// distribution specification.
+func referrerDescriptor(revision digest.Digest, mnfst distribution.Manifest) (distribution.Descriptor, error) {
+	mediaType, payload, err := mnfst.Payload()
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	desc := distribution.Descriptor{
+		MediaType: mediaType,
+		Digest:    revision,
+		Size:      int64(len(payload)),
+	}
+
+	switch m := mnfst.(type) {
+	case *ocischema.DeserializedManifest:
+		desc.ArtifactType = m.ArtifactType
+		if desc.ArtifactType == "" {
+			desc.ArtifactType = m.Config.MediaType
+		}
+		desc.Annotations = m.Annotations
+	case *ocischema.DeserializedImageIndex:
+		desc.ArtifactType = m.ArtifactType
+		desc.Annotations = m.Annotations
+	}
+
+	return desc, nil
+}
@@ -0,0 +1,251 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/ocischema"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const testSignatureArtifactType = "application/vnd.example.signature.v1+json"
+
+func TestReferrers(t *testing.T) {
+	ctx := context.Background()
+	registry := createRegistry(t, inmemory.New())
+	repo := makeRepository(t, registry, "foo/referrers")
+	manifestService := makeManifestService(t, repo)
+
+	referrers, ok := registry.(distribution.ReferrersEnumerator)
+	if !ok {
+		t.Fatalf("registry does not implement distribution.ReferrersEnumerator")
+	}
+
+	config, err := repo.Blobs(ctx).Put(ctx, v1.MediaTypeImageConfig, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.MediaType = v1.MediaTypeImageConfig
+
+	image, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config:    config,
+		Layers:    []distribution.Descriptor{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imageDigest, err := manifestService.Put(ctx, image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, imagePayload, err := image.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject := distribution.Descriptor{
+		MediaType: v1.MediaTypeImageManifest,
+		Digest:    imageDigest,
+		Size:      int64(len(imagePayload)),
+	}
+
+	signature, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned:    ocischema.SchemaVersion,
+		ArtifactType: testSignatureArtifactType,
+		Config:       config,
+		Layers:       []distribution.Descriptor{},
+		Subject:      &subject,
+		Annotations:  map[string]string{"signed-by": "test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signatureDigest, err := manifestService.Put(ctx, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sbom, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config:    config,
+		Layers:    []distribution.Descriptor{},
+		Subject:   &subject,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sbomDigest, err := manifestService.Put(ctx, sbom)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collect := func(subject digest.Digest) map[digest.Digest]distribution.Descriptor {
+		found := make(map[digest.Digest]distribution.Descriptor)
+		err := referrers.EnumerateReferrers(ctx, repo.Named(), subject, func(desc distribution.Descriptor) error {
+			found[desc.Digest] = desc
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error enumerating referrers: %v", err)
+		}
+		return found
+	}
+
+	found := collect(imageDigest)
+	if len(found) != 2 {
+		t.Fatalf("expected 2 referrers, got %d", len(found))
+	}
+
+	desc, ok := found[signatureDigest]
+	if !ok {
+		t.Fatalf("signature %s not found in referrers", signatureDigest)
+	}
+	if desc.MediaType != v1.MediaTypeImageManifest {
+		t.Errorf("unexpected media type: %q", desc.MediaType)
+	}
+	if desc.ArtifactType != testSignatureArtifactType {
+		t.Errorf("unexpected artifact type: %q", desc.ArtifactType)
+	}
+	if _, payload, _ := signature.Payload(); desc.Size != int64(len(payload)) {
+		t.Errorf("unexpected size: %d != %d", desc.Size, len(payload))
+	}
+	if desc.Annotations["signed-by"] != "test" {
+		t.Errorf("annotations not carried over: %v", desc.Annotations)
+	}
+
+	// without an explicit artifact type, the config media type is used.
+	if desc := found[sbomDigest]; desc.ArtifactType != v1.MediaTypeImageConfig {
+		t.Errorf("unexpected artifact type: %q", desc.ArtifactType)
+	}
+
+	if found := collect(signatureDigest); len(found) != 0 {
+		t.Errorf("expected no referrers for %s, got %d", signatureDigest, len(found))
+	}
+
+	// deleted referrers are no longer listed
+	if err := manifestService.Delete(ctx, sbomDigest); err != nil {
+		t.Fatal(err)
+	}
+
+	found = collect(imageDigest)
+	if _, ok := found[sbomDigest]; ok || len(found) != 1 {
+		t.Errorf("expected only the signature to be listed after delete, got %v", found)
+	}
+}
+
+func TestReferrersIndexSubject(t *testing.T) {
+	ctx := context.Background()
+	registry := createRegistry(t, inmemory.New())
+	repo := makeRepository(t, registry, "foo/referrers-index")
+	manifestService := makeManifestService(t, repo)
+
+	// the subject does not need to be present in the repository
+	subject := distribution.Descriptor{
+		MediaType: v1.MediaTypeImageManifest,
+		Digest:    digest.FromString("missing"),
+		Size:      42,
+	}
+
+	p, err := json.Marshal(ocischema.ImageIndex{
+		Versioned:    ocischema.IndexSchemaVersion,
+		Manifests:    []distribution.Descriptor{},
+		Subject:      &subject,
+		ArtifactType: testSignatureArtifactType,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := &ocischema.DeserializedImageIndex{}
+	if err := index.UnmarshalJSON(p); err != nil {
+		t.Fatal(err)
+	}
+
+	indexDigest, err := manifestService.Put(ctx, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found []distribution.Descriptor
+	err = registry.(distribution.ReferrersEnumerator).EnumerateReferrers(ctx, repo.Named(), subject.Digest, func(desc distribution.Descriptor) error {
+		found = append(found, desc)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found) != 1 || found[0].Digest != indexDigest {
+		t.Fatalf("expected index %s as only referrer, got %v", indexDigest, found)
+	}
+	if found[0].MediaType != v1.MediaTypeImageIndex || found[0].ArtifactType != testSignatureArtifactType {
+		t.Errorf("unexpected referrer descriptor: %#v", found[0])
+	}
+}
+
+func TestVerifySubject(t *testing.T) {
+	for _, testcase := range []struct {
+		subject *distribution.Descriptor
+		valid   bool
+	}{
+		{
+			subject: nil,
+			valid:   true,
+		},
+		{
+			subject: &distribution.Descriptor{
+				MediaType: v1.MediaTypeImageManifest,
+				Digest:    digest.FromString("manifest"),
+				Size:      10,
+			},
+			valid: true,
+		},
+		{
+			subject: &distribution.Descriptor{
+				MediaType: v1.MediaTypeImageIndex,
+				Digest:    digest.FromString("index"),
+				Size:      10,
+			},
+			valid: true,
+		},
+		{
+			subject: &distribution.Descriptor{
+				MediaType: v1.MediaTypeImageManifest,
+				Digest:    "sha256:invalid",
+				Size:      10,
+			},
+		},
+		{
+			subject: &distribution.Descriptor{
+				MediaType: v1.MediaTypeImageManifest,
+				Digest:    digest.FromString("manifest"),
+			},
+		},
+		{
+			subject: &distribution.Descriptor{
+				MediaType: v1.MediaTypeImageLayerGzip,
+				Digest:    digest.FromString("layer"),
+				Size:      10,
+			},
+		},
+	} {
+		err := verifySubject(testcase.subject)
+		if testcase.valid && err != nil {
+			t.Errorf("unexpected error verifying subject %v: %v", testcase.subject, err)
+		}
+		if !testcase.valid {
+			if _, ok := err.(distribution.ErrManifestSubjectInvalid); !ok {
+				t.Errorf("expected ErrManifestSubjectInvalid for subject %v, got %v", testcase.subject, err)
+			}
+		}
+	}
+}
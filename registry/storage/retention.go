@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/internal/dcontext"
+	"github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
+)
+
+// RetentionRule selects tags of repositories for removal.
+type RetentionRule struct {
+	// Repositories restricts the rule to the repositories matching any of
+	// the expressions. If empty, the rule applies to all repositories.
+	Repositories []*regexp.Regexp
+
+	// Tags restricts the rule to the tags matching any of the expressions.
+	// If empty, the rule applies to all tags.
+	Tags []*regexp.Regexp
+
+	// Keep are expressions of tags which are never removed, neither by the
+	// rule nor by the other rules applying to the repository.
+	Keep []*regexp.Regexp
+
+	// KeepLast is the number of most recently updated tags kept by the rule,
+	// among the tags it applies to which are not otherwise kept.
+	KeepLast int
+
+	// MaxAge is the time since they were last updated after which tags are
+	// removed. If zero, tags are removed regardless of their age.
+	MaxAge time.Duration
+}
+
+// RetentionOpts contains options for EnforceRetention.
+type RetentionOpts struct {
+	// DryRun only reports the tags which would be removed.
+	DryRun bool
+
+	// Rules are the retention rules. A tag is removed if any rule selects
+	// it, unless a rule keeps it.
+	Rules []RetentionRule
+}
+
+// RemovedTag is a tag removed by the retention rules.
+type RemovedTag struct {
+	Repository string
+	Tag        string
+	Digest     digest.Digest
+
+	// Updated is the time the tag was last updated.
+	Updated time.Time
+}
+
+// taggedAt is a tag along with the time it was last updated.
+type taggedAt struct {
+	tag     string
+	digest  digest.Digest
+	updated time.Time
+}
+
+// EnforceRetention evaluates the retention rules against the tags of every
+// repository of the registry, and removes the tags selected by any rule
+// through the tag service of the repository. The age of a tag is that of its
+// current link in the storage driver. It returns the removed tags or, on a
+// dry run, the tags which would have been removed.
+func EnforceRetention(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, opts RetentionOpts) ([]RemovedTag, error) {
+	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+
+	now := time.Now()
+
+	var removed []RemovedTag
+	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		var rules []RetentionRule
+		for _, rule := range opts.Rules {
+			if len(rule.Repositories) == 0 || matchesAny(rule.Repositories, repoName) {
+				rules = append(rules, rule)
+			}
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+
+		repoRemoved, err := enforceRepositoryRetention(ctx, storageDriver, registry, repoName, rules, now, opts.DryRun)
+		if err != nil {
+			return fmt.Errorf("failed to enforce retention of %s: %v", repoName, err)
+		}
+		removed = append(removed, repoRemoved...)
+		return nil
+	})
+	if isPathNotFound(err) {
+		// the registry has no repositories
+		return removed, nil
+	}
+
+	return removed, err
+}
+
+func enforceRepositoryRetention(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, repoName string, rules []RetentionRule, now time.Time, dryRun bool) ([]RemovedTag, error) {
+	named, err := reference.WithName(repoName)
+	if err != nil {
+		return nil, err
+	}
+	repository, err := registry.Repository(ctx, named)
+	if err != nil {
+		return nil, err
+	}
+	tagService := repository.Tags(ctx)
+
+	allTags, err := tagService.All(ctx)
+	if err != nil {
+		if _, ok := err.(distribution.ErrRepositoryUnknown); ok {
+			// the repository has no tags
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	tags := make([]taggedAt, 0, len(allTags))
+	for _, tag := range allTags {
+		currentPath, err := pathFor(manifestTagCurrentPathSpec{name: repoName, tag: tag})
+		if err != nil {
+			return nil, err
+		}
+		fi, err := storageDriver.Stat(ctx, currentPath)
+		if err != nil {
+			if isPathNotFound(err) {
+				// the tag was removed since it was listed
+				continue
+			}
+			return nil, err
+		}
+		desc, err := tagService.Get(ctx, tag)
+		if err != nil {
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				continue
+			}
+			return nil, err
+		}
+		tags = append(tags, taggedAt{tag: tag, digest: desc.Digest, updated: fi.ModTime()})
+	}
+
+	// the tags kept by any rule are left out before the rules are applied
+	var keep []*regexp.Regexp
+	for _, rule := range rules {
+		keep = append(keep, rule.Keep...)
+	}
+	candidates := make([]taggedAt, 0, len(tags))
+	for _, t := range tags {
+		if !matchesAny(keep, t.tag) {
+			candidates = append(candidates, t)
+		}
+	}
+
+	selected := make(map[string]taggedAt)
+	for _, rule := range rules {
+		for _, t := range rule.expired(candidates, now) {
+			selected[t.tag] = t
+		}
+	}
+
+	removed := make([]RemovedTag, 0, len(selected))
+	for _, t := range selected {
+		removed = append(removed, RemovedTag{
+			Repository: repoName,
+			Tag:        t.tag,
+			Digest:     t.digest,
+			Updated:    t.updated,
+		})
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		return removed[i].Tag < removed[j].Tag
+	})
+
+	if dryRun {
+		return removed, nil
+	}
+
+	for i, t := range removed {
+		dcontext.GetLogger(ctx).Infof("removing tag %s:%s", repoName, t.Tag)
+		if err := tagService.Untag(ctx, t.Tag); err != nil && !isPathNotFound(err) {
+			return removed[:i], fmt.Errorf("failed to remove tag %s: %v", t.Tag, err)
+		}
+	}
+	return removed, nil
+}
+
+// expired returns the tags selected for removal by the rule.
+func (rule *RetentionRule) expired(tags []taggedAt, now time.Time) []taggedAt {
+	candidates := make([]taggedAt, 0, len(tags))
+	for _, t := range tags {
+		if len(rule.Tags) > 0 && !matchesAny(rule.Tags, t.tag) {
+			continue
+		}
+		if matchesAny(rule.Keep, t.tag) {
+			continue
+		}
+		candidates = append(candidates, t)
+	}
+
+	// most recently updated first
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].updated.Equal(candidates[j].updated) {
+			return candidates[i].tag < candidates[j].tag
+		}
+		return candidates[i].updated.After(candidates[j].updated)
+	})
+
+	var expired []taggedAt
+	for i, t := range candidates {
+		if i < rule.KeepLast {
+			continue
+		}
+		if rule.MaxAge > 0 && now.Sub(t.updated) <= rule.MaxAge {
+			continue
+		}
+		expired = append(expired, t)
+	}
+	return expired
+}
+
+func matchesAny(expressions []*regexp.Regexp, s string) bool {
+	for _, re := range expressions {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
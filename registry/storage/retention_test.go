@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/internal/dcontext"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+)
+
+func TestRetentionRuleExpired(t *testing.T) {
+	now := time.Now()
+	tags := []taggedAt{
+		{tag: "latest", updated: now.Add(-time.Hour)},
+		{tag: "v1", updated: now.Add(-90 * 24 * time.Hour)},
+		{tag: "pr-1", updated: now.Add(-30 * 24 * time.Hour)},
+		{tag: "pr-2", updated: now.Add(-20 * 24 * time.Hour)},
+		{tag: "pr-3", updated: now.Add(-time.Hour)},
+		{tag: "build-1", updated: now.Add(-3 * time.Hour)},
+		{tag: "build-2", updated: now.Add(-2 * time.Hour)},
+	}
+
+	for _, testcase := range []struct {
+		name     string
+		rule     RetentionRule
+		expected []string
+	}{
+		{
+			name:     "keep last",
+			rule:     RetentionRule{KeepLast: 3},
+			expected: []string{"build-1", "pr-1", "pr-2", "v1"},
+		},
+		{
+			name: "keep last with keep expression",
+			rule: RetentionRule{
+				Keep:     []*regexp.Regexp{regexp.MustCompile(`^v\d+`)},
+				KeepLast: 3,
+			},
+			expected: []string{"build-1", "pr-1", "pr-2"},
+		},
+		{
+			name: "max age of matching tags",
+			rule: RetentionRule{
+				Tags:   []*regexp.Regexp{regexp.MustCompile(`^pr-`)},
+				MaxAge: 14 * 24 * time.Hour,
+			},
+			expected: []string{"pr-1", "pr-2"},
+		},
+		{
+			name: "keep last and max age",
+			rule: RetentionRule{
+				Tags:     []*regexp.Regexp{regexp.MustCompile(`^pr-`)},
+				KeepLast: 2,
+				MaxAge:   14 * 24 * time.Hour,
+			},
+			expected: []string{"pr-1"},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			expired := make(map[string]struct{})
+			for _, tag := range testcase.rule.expired(tags, now) {
+				expired[tag.tag] = struct{}{}
+			}
+			if len(expired) != len(testcase.expected) {
+				t.Fatalf("expected %v to be expired, got %v", testcase.expected, expired)
+			}
+			for _, tag := range testcase.expected {
+				if _, ok := expired[tag]; !ok {
+					t.Fatalf("expected %v to be expired, got %v", testcase.expected, expired)
+				}
+			}
+		})
+	}
+}
+
+func TestEnforceRetention(t *testing.T) {
+	ctx := dcontext.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "retention/repo")
+	other := makeRepository(t, registry, "retention/other")
+
+	image := uploadRandomOCIImage(t, repo)
+	for _, tag := range []string{"v1", "old", "new"} {
+		if err := repo.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+			t.Fatalf("Failed to tag manifest: %v", err)
+		}
+		// tags are ordered by the modification time of their link
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	otherImage := uploadRandomOCIImage(t, other)
+	if err := other.Tags(ctx).Tag(ctx, "old", distribution.Descriptor{Digest: otherImage.manifestDigest}); err != nil {
+		t.Fatalf("Failed to tag manifest: %v", err)
+	}
+
+	opts := RetentionOpts{
+		DryRun: true,
+		Rules: []RetentionRule{
+			{
+				Repositories: []*regexp.Regexp{regexp.MustCompile(`^retention/repo$`)},
+				Keep:         []*regexp.Regexp{regexp.MustCompile(`^v\d+`)},
+				KeepLast:     1,
+			},
+		},
+	}
+
+	removed, err := EnforceRetention(ctx, inmemoryDriver, registry, opts)
+	if err != nil {
+		t.Fatalf("Failed to enforce retention: %v", err)
+	}
+	if len(removed) != 1 || removed[0].Repository != "retention/repo" || removed[0].Tag != "old" || removed[0].Digest != image.manifestDigest {
+		t.Fatalf("Unexpected tags eligible for removal: %v", removed)
+	}
+	if _, err := repo.Tags(ctx).Get(ctx, "old"); err != nil {
+		t.Fatalf("Tag removed by a dry run: %v", err)
+	}
+
+	opts.DryRun = false
+	removed, err = EnforceRetention(ctx, inmemoryDriver, registry, opts)
+	if err != nil {
+		t.Fatalf("Failed to enforce retention: %v", err)
+	}
+	if len(removed) != 1 || removed[0].Tag != "old" {
+		t.Fatalf("Unexpected tags removed: %v", removed)
+	}
+
+	tags, err := repo.Tags(ctx).All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0] != "new" || tags[1] != "v1" {
+		t.Fatalf("Unexpected remaining tags: %v", tags)
+	}
+	if _, err := other.Tags(ctx).Get(ctx, "old"); err != nil {
+		t.Fatalf("Tag of a repository without rules was removed: %v", err)
+	}
+}
+
+func TestEnforceRetentionKeepsAcrossRules(t *testing.T) {
+	ctx := dcontext.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "retention/rules")
+
+	image := uploadRandomOCIImage(t, repo)
+	for _, tag := range []string{"release-1-rc", "build-1-rc"} {
+		if err := repo.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+			t.Fatalf("Failed to tag manifest: %v", err)
+		}
+	}
+
+	// the release tag kept by the first rule is not removed by the second
+	opts := RetentionOpts{
+		DryRun: true,
+		Rules: []RetentionRule{
+			{
+				Keep:     []*regexp.Regexp{regexp.MustCompile(`^release-`)},
+				KeepLast: 10,
+			},
+			{
+				Tags: []*regexp.Regexp{regexp.MustCompile(`-rc$`)},
+			},
+		},
+	}
+
+	removed, err := EnforceRetention(ctx, inmemoryDriver, registry, opts)
+	if err != nil {
+		t.Fatalf("Failed to enforce retention: %v", err)
+	}
+	if len(removed) != 1 || removed[0].Tag != "build-1-rc" {
+		t.Fatalf("Unexpected tags eligible for removal: %v", removed)
+	}
+}
@@ -84,6 +84,27 @@ func (v Vacuum) RemoveManifest(name string, dgst digest.Digest, tags []string) e
 	return v.driver.Delete(v.ctx, manifestPath)
 }
 
+// RemoveReferrers removes the index of the manifests referring to the
+// given manifest from the filesystem. The referrers themselves are left in
+// place.
+func (v Vacuum) RemoveReferrers(name string, subject digest.Digest) error {
+	referrersPath, err := pathFor(manifestReferrersPathSpec{name: name, subject: subject})
+	if err != nil {
+		return err
+	}
+
+	dcontext.GetLogger(v.ctx).Infof("deleting referrers index: %s", referrersPath)
+	err = v.driver.Delete(v.ctx, referrersPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
 // RemoveRepository removes a repository directory from the
 // filesystem
 func (v Vacuum) RemoveRepository(repoName string) error {